@@ -0,0 +1,97 @@
+// Copyright 2012 - 2018 The ASCIIToSVG Contributors
+// All rights reserved.
+
+package asciitosvg
+
+// NodeKind is the kind of a Node.
+type NodeKind int
+
+const (
+	// BoxNode is a closed polygon.
+	BoxNode NodeKind = iota
+	// LineNode is an open path.
+	LineNode
+	// TextNode is a line of text.
+	TextNode
+)
+
+func (k NodeKind) String() string {
+	switch k {
+	case BoxNode:
+		return "Box"
+	case LineNode:
+		return "Line"
+	case TextNode:
+		return "Text"
+	}
+	return "Unknown"
+}
+
+// A Node is the representation of an object for other renderers than the SVG one. Unlike Object,
+// it only holds what is needed to draw the object, and it is not tied to how the grid is scanned.
+type Node struct {
+	// Kind is the kind of the object.
+	Kind NodeKind
+	// Points are the grid coordinates of the corners of a box, in clockwise order starting at
+	// its top left, or of the start, the corners, and the end of a line. Rounded corners are
+	// hinted as RoundedCorner. A text has a single point, at its start.
+	Points []Point
+	// Text is the text of a text node.
+	Text string
+	// Tag is the tag of the object, if any.
+	Tag string
+	// Options are the options of the tag of the object, if any, which include its style.
+	Options map[string]interface{}
+	// Dashed is true for boxes and lines drawn with dashes, entirely or in part.
+	Dashed bool
+	// StartMarker and EndMarker are true for lines with a marker at their start or end.
+	StartMarker, EndMarker bool
+}
+
+// AST returns the nodes of the objects of c, in the same order.
+func AST(c Canvas) []Node {
+	objs, options := c.Objects(), c.Options()
+	nodes := make([]Node, 0, len(objs))
+	for _, o := range objs {
+		n := Node{Tag: o.Tag()}
+		// The options are copied, so that renderers changing them don't change the canvas.
+		if opts, ok := options[n.Tag]; ok && n.Tag != "" {
+			n.Options = make(map[string]interface{}, len(opts))
+			for k, v := range opts {
+				n.Options[k] = v
+			}
+		}
+		points := o.Points()
+		switch {
+		case o.IsText():
+			n.Kind = TextNode
+			n.Points = []Point{{X: points[0].X, Y: points[0].Y}}
+			n.Text = string(o.Text())
+			nodes = append(nodes, n)
+			continue
+		case o.IsClosed():
+			n.Kind = BoxNode
+		default:
+			n.Kind = LineNode
+			n.StartMarker = points[0].Hint == StartMarker
+			n.EndMarker = points[len(points)-1].Hint == EndMarker
+		}
+		n.Dashed = o.IsDashed()
+
+		rounded := map[Point]bool{}
+		for _, p := range points {
+			if p.Hint == RoundedCorner {
+				rounded[Point{X: p.X, Y: p.Y}] = true
+			}
+		}
+		for _, p := range o.Corners() {
+			corner := Point{X: p.X, Y: p.Y}
+			if rounded[corner] {
+				corner.Hint = RoundedCorner
+			}
+			n.Points = append(n.Points, corner)
+		}
+		nodes = append(nodes, n)
+	}
+	return nodes
+}
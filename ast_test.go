@@ -0,0 +1,90 @@
+// Copyright 2012 - 2018 The ASCIIToSVG Contributors
+// All rights reserved.
+
+package asciitosvg
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/maruel/ut"
+)
+
+func TestCanvasAST(t *testing.T) {
+	t.Parallel()
+	input := []string{
+		"      +------+",
+		"      |Editor|-------------+--------+",
+		"      +------+             |        |",
+		"          |                |        v",
+		"          v                |   +--------+",
+		"      +------+             |   |Document|",
+		"      |Window|             |   +--------+",
+		"      +------+             |",
+		"         |                 |",
+		"   +-----+-------+         |",
+		"   |             |         |",
+		"   v             v         |",
+		"+------+     +------+      |",
+		"|Window|     |Window|      |",
+		"+------+     +------+      |",
+		"                |          |",
+		"                v          |",
+		"              +----+       |",
+		"              |View|       |",
+		"              +----+       |",
+		"                |          |",
+		"                v          |",
+		"            .--------.     |",
+		"            |Document|<----+",
+		"            '--------'",
+		"",
+		"[6,0]: {\"stroke\":\"#f00\"}",
+	}
+	c, err := NewCanvas([]byte(strings.Join(input, "\n")), 9, true)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	nodes := AST(c)
+	ut.AssertEqual(t, len(c.Objects()), len(nodes))
+
+	counts := map[NodeKind]int{}
+	for _, n := range nodes {
+		counts[n.Kind]++
+	}
+	ut.AssertEqual(t, map[NodeKind]int{BoxNode: 7, LineNode: 8, TextNode: 7}, counts)
+
+	// The first box is tagged by the definition.
+	ut.AssertEqual(t, Node{
+		Kind:    BoxNode,
+		Points:  []Point{{X: 6, Y: 0}, {X: 13, Y: 0}, {X: 13, Y: 2}, {X: 6, Y: 2}},
+		Tag:     "6,0",
+		Options: map[string]interface{}{"stroke": "#f00"},
+	}, nodes[0])
+
+	// Changing the options of a node doesn't change those of the canvas.
+	nodes[0].Options["stroke"] = "#00f"
+	ut.AssertEqual(t, "#f00", c.Options()["6,0"]["stroke"])
+
+	// The last box has rounded corners, and the line into it ends in a marker.
+	var box, line Node
+	for _, n := range nodes {
+		if n.Kind == BoxNode {
+			box = n
+		}
+		if n.Kind == LineNode && n.Points[len(n.Points)-1] == (Point{X: 22, Y: 23}) {
+			line = n
+		}
+	}
+	ut.AssertEqual(t, []Point{
+		{X: 12, Y: 22, Hint: RoundedCorner},
+		{X: 21, Y: 22, Hint: RoundedCorner},
+		{X: 21, Y: 24, Hint: RoundedCorner},
+		{X: 12, Y: 24, Hint: RoundedCorner},
+	}, box.Points)
+	ut.AssertEqual(t, false, line.StartMarker)
+	ut.AssertEqual(t, true, line.EndMarker)
+
+	ut.AssertEqual(t, Node{Kind: TextNode, Points: []Point{{X: 7, Y: 1}}, Text: "Editor"}, nodes[15])
+	ut.AssertEqual(t, "Line", LineNode.String())
+}
@@ -0,0 +1,125 @@
+// Copyright 2012 - 2018 The ASCIIToSVG Contributors
+// All rights reserved.
+
+package asciitosvg
+
+import "image"
+
+// maxTail is the length in cells of the longest tail of a speech bubble.
+const maxTail = 3
+
+// A bubble is a box with a short diagonal tail attached to one of its walls, as in "\" below a
+// box, drawn as a speech bubble pointing with its tail.
+type bubble struct {
+	// box and stub are the indices of the box and of the line of its tail.
+	box, stub int
+	// wall is the cell of the wall of the box that the tail extends, which the outline of the
+	// bubble replaces by tip, the last cell of the tail.
+	wall, tip Point
+}
+
+// outline returns the points of the outline of the box of the bubble, with its tail.
+func (b bubble) outline(points []Point) []Point {
+	out := make([]Point, len(points))
+	for i, p := range points {
+		if p.X == b.wall.X && p.Y == b.wall.Y {
+			p = Point{X: b.tip.X, Y: b.tip.Y}
+		}
+		out[i] = p
+	}
+	return out
+}
+
+// findBubbles returns the bubbles among the objects of c for which keep returns true: boxes with a
+// line made of one to maxTail diagonal cells running straight away from a cell of their wall.
+// The line may also run along the wall before leaving it, as it is scanned from the wall.
+func findBubbles(c Canvas, keep func(Object) bool) []bubble {
+	objs := c.Objects()
+	walls := map[image.Point]int{}
+	for i, o := range objs {
+		if o.IsClosed() && !o.IsText() && keep(o) {
+			for _, p := range FullPoints(o) {
+				walls[image.Point{X: p.X, Y: p.Y}] = i
+			}
+		}
+	}
+
+	// attach returns the bubble of the line i if tail, ordered from the wall outward, is a tail
+	// extending a cell of the wall of box.
+	attach := func(i int, tail []Point, text []rune) (bubble, bool) {
+		if len(tail) == 0 || len(tail) > maxTail {
+			return bubble{}, false
+		}
+		for _, r := range text {
+			if r != text[0] || r != '/' && r != '\\' {
+				return bubble{}, false
+			}
+		}
+		var steps []image.Point
+		if len(tail) > 1 {
+			steps = []image.Point{{X: tail[1].X - tail[0].X, Y: tail[1].Y - tail[0].Y}}
+		} else if text[0] == '\\' {
+			steps = []image.Point{{X: 1, Y: 1}, {X: -1, Y: -1}}
+		} else {
+			steps = []image.Point{{X: -1, Y: 1}, {X: 1, Y: -1}}
+		}
+		for _, d := range steps {
+			for k := 1; k < len(tail); k++ {
+				if tail[k].X-tail[k-1].X != d.X || tail[k].Y-tail[k-1].Y != d.Y {
+					return bubble{}, false
+				}
+			}
+			wall := Point{X: tail[0].X - d.X, Y: tail[0].Y - d.Y}
+			if box, ok := walls[image.Point{X: wall.X, Y: wall.Y}]; ok && !objs[box].HasPoint(tail[0]) {
+				return bubble{box: box, stub: i, wall: wall, tip: tail[len(tail)-1]}, true
+			}
+		}
+		return bubble{}, false
+	}
+
+	var out []bubble
+	used := map[int]bool{}
+	for i, o := range objs {
+		if o.IsClosed() || o.IsText() || !keep(o) {
+			continue
+		}
+		points, text := FullPoints(o), o.Text()
+		if len(points) != len(text) {
+			continue
+		}
+		// The tail is the run of cells off the walls at either end of the line.
+		first, last := -1, -1
+		for k, p := range points {
+			if _, ok := walls[image.Point{X: p.X, Y: p.Y}]; !ok {
+				if first < 0 {
+					first = k
+				}
+				last = k
+			}
+		}
+		if first < 0 || first != 0 && last != len(points)-1 {
+			continue
+		}
+		contiguous := true
+		for k := first; k <= last; k++ {
+			_, on := walls[image.Point{X: points[k].X, Y: points[k].Y}]
+			contiguous = contiguous && !on
+		}
+		if !contiguous {
+			continue
+		}
+		tail, runes := points[first:last+1], text[first:last+1]
+		b, ok := bubble{}, false
+		if last == len(points)-1 {
+			b, ok = attach(i, tail, runes)
+		}
+		if !ok && first == 0 {
+			b, ok = attach(i, reversePoints(tail), runes)
+		}
+		if ok && !used[b.box] {
+			used[b.box] = true
+			out = append(out, b)
+		}
+	}
+	return out
+}
@@ -31,11 +31,93 @@ type Canvas interface {
 	EnclosingObjects(p Point) []Object
 }
 
+// Updater is implemented by the canvases returned by NewCanvas and Parse, which can be updated in
+// place when their diagram is edited.
+type Updater interface {
+	// Update replaces the underlying grid with newData, in which only the rows changedRows have
+	// changed, and finds the objects of the changed region anew.
+	Update(changedRows []int, newData []byte) error
+}
+
 // NewCanvas returns a new Canvas, initialized from the provided data. If tabWidth is set to a non-negative
 // value, that value will be used to convert tabs to spaces within the grid. Creation of the Canvas
 // can fail if the diagram contains invalid UTF-8 sequences.
 func NewCanvas(data []byte, tabWidth int, noBlur bool) (Canvas, error) {
+	return Parse(data, ParseOptions{TabWidth: tabWidth, NoBlur: noBlur})
+}
+
+// ParseOptions controls how a diagram is parsed into a Canvas. The zero value parses with the
+// defaults.
+type ParseOptions struct {
+	// TabWidth is the width that tabs are expanded to within the grid. If zero, 8 is used.
+	TabWidth int
+	// NoBlur omits the drop-shadow filter from the default options of closed objects.
+	NoBlur bool
+	// GapTolerance is the number of blank cells that may separate the end of a line from the wall
+	// of a box for the line to still be connected to it. Such lines are extended across the gap.
+	// Lines ending in a marker are never extended.
+	GapTolerance int
+	// KeepIndent starts text preceded only by whitespace on its line at the left edge of the
+	// grid, so that the text includes its indentation.
+	KeepIndent bool
+	// CharStyles maps characters to the styles of the objects drawn with them.
+	CharStyles map[rune]CharStyle
+	// Simplify limits the points of lines and polygons to the points needed to draw them: their
+	// ends, their corners, and the points with a rendering hint. FullPoints still returns all of
+	// their points.
+	Simplify bool
+	// Width and Height force the size of the grid in cells, padding the diagram with spaces or
+	// truncating it, so that diagrams are rendered at a uniform size. If zero, the size of the
+	// diagram is used.
+	Width, Height int
+	// MaxCells is the maximum number of cells, the width times the height of the diagram, that
+	// the grid may have. Larger diagrams are rejected before the grid is allocated, protecting
+	// services that parse untrusted input. If zero, there is no limit.
+	MaxCells int
+	// SpacedDashes recognizes runs of at least three dashes separated by single spaces, like
+	// "- - -", as dashed horizontal lines, rather than leaving them out of the diagram.
+	SpacedDashes bool
+	// CloseBoxes closes the boxes drawn with their top and both sides but missing their bottom
+	// side entirely, by turning the last row of their sides into the bottom side, provided that
+	// it is blank between the sides. Such boxes are otherwise parsed as open lines.
+	CloseBoxes bool
+	// MinObjectCells drops the lines and polygons of fewer cells than that, such as stray
+	// characters of noisy input parsed as tiny fragments of lines, along with their cells. Text
+	// is kept, since short labels are common. If zero, all objects are kept.
+	MinObjectCells int
+	// MergeText merges the text that follows other text on its row after at most that many blank
+	// cells into a single text object, spanning the blank cells, so that words spread across a
+	// row form one label. Text is otherwise split after 3 blank cells. If zero, text isn't
+	// merged.
+	MergeText int
+}
+
+// CharStyle is the style of the objects drawn with a character.
+type CharStyle struct {
+	// As is the character that the character is parsed as, e.g. '-' to draw horizontal lines
+	// with it. If zero, the character is parsed as itself.
+	As rune
+	// Options are applied to the lines and polygons drawn with the character that aren't
+	// otherwise tagged, as if set by a tag definition.
+	Options map[string]interface{}
+}
+
+const defaultTabWidth = 8
+
+// minPolygonPoints is the number of points of the smallest closed path, a 2x2 box. A path running
+// straight down from its start, such as a vertical line or a divider starting at a corner, reaches
+// the point below its start with fewer points, and stays open.
+const minPolygonPoints = 4
+
+// Parse returns a new Canvas, initialized from the provided data according to opts. Creation of
+// the Canvas can fail if the diagram contains invalid UTF-8 sequences.
+func Parse(data []byte, opts ParseOptions) (Canvas, error) {
+	if opts.TabWidth == 0 {
+		opts.TabWidth = defaultTabWidth
+	}
+
 	c := &canvas{
+		opts: opts,
 		options: map[string]map[string]interface{}{
 			"__a2s__closed__options__": map[string]interface{}{
 				"fill":   "#fff",
@@ -43,52 +125,492 @@ func NewCanvas(data []byte, tabWidth int, noBlur bool) (Canvas, error) {
 			},
 		},
 	}
-	if noBlur {
+	if opts.NoBlur {
 		c.options["__a2s__closed__options__"] = map[string]interface{}{
 			"fill": "#fff",
 		}
 	}
 
-	lines := bytes.Split(data, []byte("\n"))
-	c.size.Y = len(lines)
+	lines, defs, width, err := splitLines(data, opts.TabWidth)
+	if err != nil {
+		return nil, err
+	}
+	// Check the size the grid will have once resized, before padding it to a forced size.
+	size := image.Point{X: width, Y: len(lines)}
+	if opts.Width > 0 {
+		size.X = opts.Width
+	}
+	if opts.Height > 0 {
+		size.Y = opts.Height
+	}
+	if opts.MaxCells > 0 && size.X*size.Y > opts.MaxCells {
+		return nil, fmt.Errorf("diagram of %dx%d cells exceeds the maximum of %d cells", size.X, size.Y, opts.MaxCells)
+	}
+	lines, width = resize(lines, width, opts.Width, opts.Height)
+	c.size = image.Point{X: width, Y: len(lines)}
+
+	c.grid = make([]char, c.size.X*c.size.Y)
+	c.visited = make([]bool, c.size.X*c.size.Y)
+	for y, line := range lines {
+		c.setRow(y, line)
+	}
+	if opts.CloseBoxes {
+		c.closeBoxes()
+	}
+
+	if err := c.findObjects(0, c.size.Y); err != nil {
+		return nil, err
+	}
+	c.defs = defs
+	if err := c.applyStyles(); err != nil {
+		return nil, err
+	}
+	c.simplify()
+	return c, nil
+}
+
+// splitLines splits data into the lines of the grid, with their tabs expanded to tabWidth. Tag
+// definitions are stripped from the grid, so that they are neither rendered nor mistaken for parts
+// of the diagram; they are returned separately, to be applied once all objects have been found.
+// width is the length in runes of the longest line.
+func splitLines(data []byte, tabWidth int) (lines, defs [][]byte, width int, err error) {
+	// Lines may end with "\r\n" as on Windows, or with a lone "\r" as on classic Mac OS.
+	data = bytes.Replace(data, []byte("\r\n"), []byte("\n"), -1)
+	data = bytes.Replace(data, []byte("\r"), []byte("\n"), -1)
+	lines = bytes.Split(data, []byte("\n"))
+	for i, line := range lines {
+		if tagDefRE.Match(line) {
+			defs = append(defs, line)
+			lines[i] = nil
+		}
+	}
 
 	// Diagrams will often not be padded to a uniform width. To overcome this, we scan over
 	// each line and figure out which is the longest. This becomes the width of the canvas.
 	for i, line := range lines {
 		if ok := utf8.Valid(line); !ok {
-			return nil, fmt.Errorf("invalid UTF-8 encoding on line %d", i)
+			pos, index := invalidOffset(line)
+			return nil, nil, 0, fmt.Errorf("invalid UTF-8 encoding on line %d at byte offset %d; rune offset %d", i, pos, index)
 		}
 
 		l, err := expandTabs(line, tabWidth)
 		if err != nil {
-			return nil, err
+			return nil, nil, 0, err
 		}
 
 		lines[i] = l
 
-		if i := utf8.RuneCount(lines[i]); i > c.size.X {
-			c.size.X = i
+		if w := lineWidth(l); w > width {
+			width = w
 		}
 	}
+	return lines, defs, width, nil
+}
 
-	c.grid = make([]char, c.size.X*c.size.Y)
-	c.visited = make([]bool, c.size.X*c.size.Y)
-	for y, line := range lines {
-		x := 0
-		for len(line) > 0 {
-			r, l := utf8.DecodeRune(line)
-			c.grid[y*c.size.X+x] = char(r)
+// resize truncates lines to the width and height forced by ParseOptions, or pads them with blank
+// lines, and returns them along with their width.
+func resize(lines [][]byte, width, forceWidth, forceHeight int) ([][]byte, int) {
+	if forceWidth > 0 {
+		width = forceWidth
+		for i, line := range lines {
+			// A double-width rune straddling the edge is dropped along with the rest.
+			for x, pos := 0, 0; pos < len(line); {
+				r, l := utf8.DecodeRune(line[pos:])
+				if x += runeWidth(r); x > width {
+					lines[i] = line[:pos]
+					break
+				}
+				pos += l
+			}
+		}
+	}
+	if forceHeight > 0 {
+		for len(lines) < forceHeight {
+			lines = append(lines, nil)
+		}
+		lines = lines[:forceHeight]
+	}
+	return lines, width
+}
+
+// lineWidth returns the number of cells taken by line.
+func lineWidth(line []byte) int {
+	width := 0
+	for _, r := range string(line) {
+		width += runeWidth(r)
+	}
+	return width
+}
+
+// setRow replaces row y of the grid with line, padding it with spaces to the width of the grid.
+func (c *canvas) setRow(y int, line []byte) {
+	for p := range c.styled {
+		if p.Y == y {
+			delete(c.styled, p)
+		}
+	}
+	for p := range c.spaced {
+		if p.Y == y {
+			delete(c.spaced, p)
+		}
+	}
+
+	x := 0
+	for len(line) > 0 {
+		r, l := utf8.DecodeRune(line)
+		if style, ok := c.opts.CharStyles[r]; ok {
+			if c.styled == nil {
+				c.styled = map[Point]rune{}
+			}
+			c.styled[Point{X: x, Y: y}] = r
+			if style.As != 0 {
+				r = style.As
+			}
+		}
+		c.grid[y*c.size.X+x] = char(r)
+		if runeWidth(r) == 2 {
 			x++
-			line = line[l:]
+			c.grid[y*c.size.X+x] = wide
+		}
+		x++
+		line = line[l:]
+	}
+
+	for ; x < c.size.X; x++ {
+		c.grid[y*c.size.X+x] = ' '
+	}
+
+	if c.opts.SpacedDashes {
+		c.joinDashes(y)
+	}
+}
+
+// joinDashes records the cells of the runs of at least three dashes separated by single spaces on
+// row y, so that the spaces are scanned as part of the runs and the lines they form are dashed. The
+// grid is left as it is. Dashes that are part of a solid line are left alone.
+func (c *canvas) joinDashes(y int) {
+	row := c.grid[y*c.size.X : (y+1)*c.size.X]
+	for x := 0; x < len(row); x++ {
+		if row[x] != '-' || x > 0 && row[x-1] == '-' {
+			continue
+		}
+		end := x
+		for end+2 < len(row) && row[end+1] == ' ' && row[end+2] == '-' {
+			end += 2
+		}
+		if end-x >= 4 && (end+1 == len(row) || row[end+1] != '-') {
+			if c.spaced == nil {
+				c.spaced = map[Point]bool{}
+			}
+			for k := x; k <= end; k++ {
+				c.spaced[Point{X: k, Y: y}] = true
+			}
 		}
+		x = end
+	}
+}
 
-		for ; x < c.size.X; x++ {
-			c.grid[y*c.size.X+x] = ' '
+// closeBoxes draws the missing bottom side of the boxes that only have their top and both sides,
+// each side running down from a corner at an end of the top side to the same row, over the last
+// row of the sides. Boxes whose last row isn't blank between the sides are left open.
+func (c *canvas) closeBoxes() {
+	for y := 0; y < c.size.Y; y++ {
+		for x := 0; x < c.size.X; x++ {
+			if !c.at(Point{X: x, Y: y}).isCorner() {
+				continue
+			}
+			// The top side runs to the next corner on the row.
+			right := x + 1
+			for right < c.size.X && c.at(Point{X: right, Y: y}).isHorizontal() {
+				right++
+			}
+			if right == x+1 || right == c.size.X || !c.at(Point{X: right, Y: y}).isCorner() {
+				continue
+			}
+			// Both sides must run down to the same row and stop there.
+			side := func(x int) int {
+				bottom := y
+				for bottom+1 < c.size.Y && c.at(Point{X: x, Y: bottom + 1}).isVertical() {
+					bottom++
+				}
+				if bottom+1 < c.size.Y && c.at(Point{X: x, Y: bottom + 1}).isCorner() {
+					return y
+				}
+				return bottom
+			}
+			bottom := side(x)
+			if bottom < y+2 || side(right) != bottom {
+				continue
+			}
+			blank := true
+			for k := x + 1; k < right; k++ {
+				blank = blank && c.at(Point{X: k, Y: bottom}).isSpace()
+			}
+			if !blank {
+				continue
+			}
+			for k := x; k <= right; k++ {
+				c.grid[bottom*c.size.X+k] = '-'
+			}
+			c.grid[bottom*c.size.X+x] = bottomCorner(c.at(Point{X: x, Y: y}))
+			c.grid[bottom*c.size.X+right] = bottomCorner(c.at(Point{X: right, Y: y}))
 		}
 	}
+}
 
-	c.findObjects()
-	return c, nil
+// bottomCorner returns the bottom corner matching the top corner ch: rounded if ch is.
+func bottomCorner(ch char) char {
+	if ch.isRoundedCorner() {
+		return '\''
+	}
+	return '+'
+}
+
+// applyStyles applies the character styles and tag definitions to the objects of the canvas.
+func (c *canvas) applyStyles() error {
+	if c.styled != nil {
+		c.applyCharStyles(c.styled)
+	}
+	for _, def := range c.defs {
+		if err := c.applyTagDefinition(def); err != nil {
+			return err
+		}
+	}
+	return c.applyPreformatted()
+}
+
+// applyPreformatted replaces the objects within the boxes with the a2s:pre option by the text of
+// their rows, verbatim, so that text aligned with spaces, like a table, keeps its layout. Each run
+// of text on a row, including its inner spaces, becomes a single text object. The references
+// tagging the boxes, and the lines partly within them, are kept as they are.
+func (c *canvas) applyPreformatted() error {
+	var boxes []Object
+	for _, o := range c.objects {
+		if pre, _ := c.options[o.Tag()]["a2s:pre"].(bool); pre && o.IsClosed() && !o.IsText() {
+			boxes = append(boxes, o)
+		}
+	}
+	for _, box := range boxes {
+		r := Bounds(box)
+		interior := image.Rect(r.Min.X+1, r.Min.Y+1, r.Max.X-1, r.Max.Y-1)
+		// The cells of the objects kept are left out of the text.
+		taken := map[image.Point]bool{}
+		kept := c.objects[:0]
+		for _, o := range c.objects {
+			if !IsReference(o) && Bounds(o).In(interior) {
+				continue
+			}
+			kept = append(kept, o)
+			for _, p := range o.Points() {
+				taken[image.Point{X: p.X, Y: p.Y}] = true
+			}
+		}
+		c.objects = kept
+
+		for y := interior.Min.Y; y < interior.Max.Y; y++ {
+			var run []Point
+			for x := interior.Min.X; x <= interior.Max.X; x++ {
+				p := Point{X: x, Y: y}
+				if x < interior.Max.X && !taken[image.Point{X: x, Y: y}] && box.HasPoint(p) {
+					run = append(run, p)
+					continue
+				}
+				for len(run) != 0 && c.at(run[len(run)-1]).isSpace() {
+					run = run[:len(run)-1]
+				}
+				for len(run) != 0 && c.at(run[0]).isSpace() {
+					run = run[1:]
+				}
+				if len(run) != 0 {
+					obj := &object{points: run, isText: true}
+					if err := obj.seal(c); err != nil {
+						return err
+					}
+					c.objects = append(c.objects, obj)
+				}
+				run = nil
+			}
+		}
+	}
+	if len(boxes) != 0 {
+		sort.Sort(c.objects)
+	}
+	return nil
+}
+
+// Update replaces the diagram of the canvas with newData, in which only the rows changedRows
+// differ from the diagram the canvas was created from. Only the region of the grid connected to
+// the changed rows is scanned anew; the objects outside of it are kept as they are. If the size of
+// the grid or the tag definitions changed, the whole diagram is parsed anew.
+func (c *canvas) Update(changedRows []int, newData []byte) error {
+	lines, defs, width, err := splitLines(newData, c.opts.TabWidth)
+	if err != nil {
+		return err
+	}
+	lines, width = resize(lines, width, c.opts.Width, c.opts.Height)
+	// Closing a box may change rows away from the changed ones.
+	if width != c.size.X || len(lines) != c.size.Y || !equalLines(defs, c.defs) || c.opts.CloseBoxes {
+		n, err := Parse(newData, c.opts)
+		if err != nil {
+			return err
+		}
+		*c = *n.(*canvas)
+		return nil
+	}
+
+	// Check all of the rows before changing anything, and scan a copy of the canvas anew so that
+	// the canvas is left as it was on failure.
+	for _, y := range changedRows {
+		if y < 0 || y >= c.size.Y {
+			return fmt.Errorf("row %d is out of range", y)
+		}
+	}
+	n := c.clone()
+	if err := n.rescan(changedRows, lines); err != nil {
+		return err
+	}
+	*c = *n
+	return nil
+}
+
+// clone returns a copy of the canvas that can be scanned anew without altering the canvas.
+func (c *canvas) clone() *canvas {
+	n := *c
+	n.grid = append([]char(nil), c.grid...)
+	n.visited = append([]bool(nil), c.visited...)
+	n.objects = append(objects(nil), c.objects...)
+	n.options = make(map[string]map[string]interface{}, len(c.options))
+	for k, v := range c.options {
+		n.options[k] = v
+	}
+	if c.styled != nil {
+		n.styled = make(map[Point]rune, len(c.styled))
+		for k, v := range c.styled {
+			n.styled[k] = v
+		}
+	}
+	if c.spaced != nil {
+		n.spaced = make(map[Point]bool, len(c.spaced))
+		for k, v := range c.spaced {
+			n.spaced[k] = v
+		}
+	}
+	return &n
+}
+
+// rescan replaces the rows changedRows of the grid by those of lines, and scans the region of the
+// grid connected to them anew.
+func (c *canvas) rescan(changedRows []int, lines [][]byte) error {
+	// Lines and polygons may connect to the rows above and below a changed row.
+	top, bottom := c.size.Y, 0
+	for _, y := range changedRows {
+		c.setRow(y, lines[y])
+		if y-1 < top {
+			top = y - 1
+		}
+		if y+2 > bottom {
+			bottom = y + 2
+		}
+	}
+	if top < 0 {
+		top = 0
+	}
+	if bottom > c.size.Y {
+		bottom = c.size.Y
+	}
+	if top >= bottom {
+		return nil
+	}
+
+	// Grow the region until it covers all of the rows of the objects it touches, so that
+	// polygons are scanned along with the objects they contain, and until no cell links across
+	// its edges, so that the objects found anew aren't cut off by the objects kept around it.
+	for grown := true; grown; {
+		grown = false
+		for _, o := range c.objects {
+			r := Bounds(o)
+			if r.Max.Y <= top || r.Min.Y >= bottom {
+				continue
+			}
+			if r.Min.Y < top {
+				top = r.Min.Y
+				grown = true
+			}
+			if r.Max.Y > bottom {
+				bottom = r.Max.Y
+				grown = true
+			}
+		}
+		if top > 0 && c.linksAcross(top-1) {
+			top--
+			grown = true
+		}
+		if bottom < c.size.Y && c.linksAcross(bottom-1) {
+			bottom++
+			grown = true
+		}
+	}
+
+	kept := c.objects[:0]
+	for _, o := range c.objects {
+		if r := Bounds(o); r.Max.Y <= top || r.Min.Y >= bottom {
+			kept = append(kept, o)
+		}
+	}
+	c.objects = kept
+	for i := top * c.size.X; i < bottom*c.size.X; i++ {
+		c.visited[i] = false
+	}
+
+	if err := c.findObjects(top, bottom); err != nil {
+		return err
+	}
+	if err := c.applyStyles(); err != nil {
+		return err
+	}
+	c.simplify()
+	return nil
+}
+
+// linksAcross returns true if a cell of row y links to a cell of the row below it, or the other
+// way around.
+func (c *canvas) linksAcross(y int) bool {
+	for x := 0; x < c.size.X; x++ {
+		for _, n := range c.links(Point{X: x, Y: y}) {
+			if n.Y > y {
+				return true
+			}
+		}
+		for _, n := range c.links(Point{X: x, Y: y + 1}) {
+			if n.Y <= y {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// simplify simplifies the points of all objects, if requested.
+func (c *canvas) simplify() {
+	if !c.opts.Simplify {
+		return
+	}
+	for _, o := range c.objects {
+		o.(*object).simplify()
+	}
+}
+
+// equalLines returns true if a and b hold the same lines.
+func equalLines(a, b [][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
 }
 
 // The expandTabs function pads tab characters to the specified width of spaces for the provided
@@ -103,16 +625,18 @@ func expandTabs(line []byte, tabWidth int) ([]byte, error) {
 	out := make([]byte, 0, len(line))
 
 	// pos tracks our position in the input byte slice, while index tracks our position in the
-	// resulting output slice.
+	// resulting output slice, and column the cell of the grid it is at.
 	pos := 0
 	index := 0
-	for _, c := range line {
-		if c == '\t' {
+	column := 0
+	for pos < len(line) {
+		if line[pos] == '\t' {
 			// Loop over the remaining space count for this particular tabstop until
 			// the next, replacing each position with a space.
-			for s := tabWidth - (pos % tabWidth); s > 0; s-- {
+			for s := tabWidth - (column % tabWidth); s > 0; s-- {
 				out = append(out, ' ')
 				index++
+				column++
 			}
 			pos++
 		} else {
@@ -121,7 +645,7 @@ func expandTabs(line []byte, tabWidth int) ([]byte, error) {
 			// at this position to get its length in bytes, plop that rune back into our
 			// output slice, and account accordingly.
 			r, l := utf8.DecodeRune(line[pos:])
-			if r == utf8.RuneError {
+			if r == utf8.RuneError && l == 1 {
 				return nil, fmt.Errorf("invalid rune at byte offset %d; rune offset %d", pos, index)
 			}
 
@@ -131,12 +655,43 @@ func expandTabs(line []byte, tabWidth int) ([]byte, error) {
 
 			pos += l
 			index++
+			column += runeWidth(r)
 		}
 	}
 
 	return out, nil
 }
 
+// invalidOffset returns the byte offset and the rune offset of the first invalid UTF-8 sequence of
+// line.
+func invalidOffset(line []byte) (int, int) {
+	pos := 0
+	index := 0
+	for pos < len(line) {
+		r, l := utf8.DecodeRune(line[pos:])
+		if r == utf8.RuneError && l == 1 {
+			break
+		}
+		pos += l
+		index++
+	}
+	return pos, index
+}
+
+// indent prepends the points of the indentation of text to its points, if the text is preceded
+// only by unvisited whitespace on its line.
+func (c *canvas) indent(points []Point) []Point {
+	start := points[0]
+	out := make([]Point, 0, start.X+len(points))
+	for p := (Point{Y: start.Y}); p.X < start.X; p.X++ {
+		if c.isVisited(p) || !c.at(p).isSpace() {
+			return points
+		}
+		out = append(out, p)
+	}
+	return append(out, points...)
+}
+
 // canvas is the parsed source data.
 type canvas struct {
 	// (0,0) is top left.
@@ -145,6 +700,13 @@ type canvas struct {
 	objects objects
 	size    image.Point
 	options map[string]map[string]interface{}
+	opts    ParseOptions
+	// styled holds the original characters of the cells drawn with styled characters.
+	styled map[Point]rune
+	// spaced holds the cells of the runs of dashes separated by spaces, which are dashed lines.
+	spaced map[Point]bool
+	// defs holds the tag definition lines stripped from the grid.
+	defs [][]byte
 }
 
 func (c *canvas) String() string {
@@ -183,25 +745,83 @@ func (c *canvas) EnclosingObjects(p Point) []Object {
 	return q
 }
 
-// findObjects finds all objects (lines, polygons, and text) within the underlying grid.
-func (c *canvas) findObjects() {
+// ObjectAt returns the topmost object of c with a point at p, or nil if there is none, in the order
+// objects are rendered: text is drawn above lines, which are drawn above polygons. Among objects of
+// the same kind, the last one drawn is the topmost.
+func ObjectAt(c Canvas, p Point) Object {
+	var text, line, polygon Object
+	for _, o := range c.Objects() {
+		for _, q := range FullPoints(o) {
+			if q.X != p.X || q.Y != p.Y {
+				continue
+			}
+			switch {
+			case o.IsText():
+				text = o
+			case o.IsClosed():
+				polygon = o
+			default:
+				line = o
+			}
+			break
+		}
+	}
+	switch {
+	case text != nil:
+		return text
+	case line != nil:
+		return line
+	}
+	return polygon
+}
+
+// newPolygon returns a sealed polygon of the cycle of points, starting at its top left point and
+// proceeding clockwise, as scanPath would.
+func (c *canvas) newPolygon(cycle []Point) (Object, error) {
+	start := 0
+	for i, p := range cycle {
+		if p.Y < cycle[start].Y || p.Y == cycle[start].Y && p.X < cycle[start].X {
+			start = i
+		}
+	}
+	points := append(append([]Point{}, cycle[start:]...), cycle[:start]...)
+	if points[1].X == points[0].X {
+		// Counter-clockwise; reverse all but the start.
+		for i, j := 1, len(points)-1; i < j; i, j = i+1, j-1 {
+			points[i], points[j] = points[j], points[i]
+		}
+	}
+	o := &object{points: points}
+	if err := o.seal(c); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// findObjects finds all objects (lines, polygons, and text) starting within the rows top to
+// bottom, exclusive, of the underlying grid.
+func (c *canvas) findObjects(top, bottom int) error {
 	p := Point{}
+	from := len(c.objects)
 
 	// Find any new paths by starting with a point that wasn't yet visited, beginning at the top
 	// left of the grid.
-	for y := 0; y < c.size.Y; y++ {
+	for y := top; y < bottom; y++ {
 		p.Y = y
 		for x := 0; x < c.size.X; x++ {
 			p.X = x
 			if c.isVisited(p) {
 				continue
 			}
-			if ch := c.at(p); ch.isPathStart() {
+			if ch := c.at(p); ch.isPathStart() && !c.inWord(p) {
 				// Found the start of a one or multiple connected paths. Traverse all
 				// connecting points. This will generate multiple objects if multiple
 				// paths (either open or closed) are found.
 				c.visit(p)
-				objs := c.scanPath([]Point{p})
+				objs, err := c.scanPath([]Point{p})
+				if err != nil {
+					return err
+				}
 				for _, obj := range objs {
 					// For all points in all objects found, mark the points as visited.
 					for _, p := range obj.Points() {
@@ -213,8 +833,21 @@ func (c *canvas) findObjects() {
 		}
 	}
 
+	// Fragments too small to be anything but noise are dropped. Their cells stay visited, so
+	// that they aren't taken for text either.
+	if c.opts.MinObjectCells > 0 {
+		kept := c.objects[:from]
+		for _, o := range c.objects[from:] {
+			if len(FullPoints(o)) >= c.opts.MinObjectCells {
+				kept = append(kept, o)
+			}
+		}
+		c.objects = kept
+	}
+
 	// A second pass through the grid attempts to identify any text within the grid.
-	for y := 0; y < c.size.Y; y++ {
+	texts := len(c.objects)
+	for y := top; y < bottom; y++ {
 		p.Y = y
 		for x := 0; x < c.size.X; x++ {
 			p.X = x
@@ -222,7 +855,10 @@ func (c *canvas) findObjects() {
 				continue
 			}
 			if ch := c.at(p); ch.isTextStart() {
-				obj := c.scanText(p)
+				obj, err := c.scanText(p)
+				if err != nil {
+					return err
+				}
 
 				// scanText will return nil if the text at this area is simply
 				// setting options on a container object.
@@ -237,12 +873,43 @@ func (c *canvas) findObjects() {
 		}
 	}
 
+	if c.opts.MergeText > 0 {
+		if err := c.mergeText(texts); err != nil {
+			return err
+		}
+	}
+
 	sort.Sort(c.objects)
+	return nil
 }
 
 // scanPath tries to complete a total path (for lines or polygons) starting with some partial path.
-// It recurses when it finds multiple unvisited outgoing paths.
-func (c *canvas) scanPath(points []Point) objects {
+// It recurses when it finds multiple unvisited outgoing paths. The paths turning left at the
+// junctions of a polygon are scanned last, once the polygons on the other side of the junctions
+// are found.
+func (c *canvas) scanPath(points []Point) (objects, error) {
+	var deferred [][]Point
+	objs, err := c.scanBranch(points, &deferred)
+	for err == nil && len(deferred) != 0 {
+		p := deferred[0]
+		deferred = deferred[1:]
+		if c.isVisited(p[len(p)-1]) {
+			continue
+		}
+		c.visit(p[len(p)-1])
+		var r objects
+		r, err = c.scanBranch(p, &deferred)
+		objs = append(objs, r...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return objs, nil
+}
+
+// scanBranch completes the partial path of points for scanPath, adding the paths it defers to
+// deferred.
+func (c *canvas) scanBranch(points []Point, deferred *[][]Point) (objects, error) {
 	cur := points[len(points)-1]
 	next := c.next(cur)
 
@@ -252,28 +919,68 @@ func (c *canvas) scanPath(points []Point) objects {
 		if len(points) == 1 {
 			// Discard 'path' of 1 point. Do not mark point as visited.
 			c.unvisit(cur)
-			return nil
+			return nil, nil
+		}
+
+		// A path running back into a junction closes the polygon sharing that junction, or
+		// the wall leading to it, with the polygon found before it.
+		if o, err := c.closeAtJunction(points); err != nil || o != nil {
+			if err != nil {
+				return nil, err
+			}
+			return objects{o}, nil
 		}
 
 		// TODO(dhobsd): Determine if path is sharing the line with another path. If so,
 		// we may want to join the objects such that we don't get weird rendering artifacts.
-		o := &object{points: points}
-		o.seal(c)
-		return objects{o}
+		o := &object{points: c.closeGaps(points)}
+		if err := o.seal(c); err != nil {
+			return nil, err
+		}
+		return objects{o}, nil
 	}
 
 	// If we have hit a point that can create a closed path, create an object and close
 	// the path. Additionally, recurse to other progress directions in case e.g. an open
 	// path spawns from this point. Paths are always closed vertically.
-	if cur.X == points[0].X && cur.Y == points[0].Y+1 {
+	if len(points) >= minPolygonPoints && cur.X == points[0].X && cur.Y == points[0].Y+1 {
+		o := &object{points: points}
+		if err := o.seal(c); err != nil {
+			return nil, err
+		}
+		r, err := c.scanBranch([]Point{cur}, deferred)
+		if err != nil {
+			return nil, err
+		}
+		return append(objects{o}, r...), nil
+	}
+
+	// A line running straight down into a junction where it branches ends there, and the branches
+	// start at the junction, so that the line isn't drawn again as part of each branch.
+	if len(points) > 1 && len(next) > 1 && c.at(cur).isJunction() && cur.X == points[0].X && cur.Y == points[0].Y+len(points)-1 {
 		o := &object{points: points}
-		o.seal(c)
-		r := objects{o}
-		return append(r, c.scanPath([]Point{cur})...)
+		if err := o.seal(c); err != nil {
+			return nil, err
+		}
+		r, err := c.scanBranch([]Point{cur}, deferred)
+		if err != nil {
+			return nil, err
+		}
+		return append(objects{o}, r...), nil
 	}
 
 	// We scan depth-first instead of breadth-first, making it possible to find a
 	// closed path.
+	if len(points) > 1 && c.at(points[0]).isCorner() && c.at(cur).isJunction() {
+		var left []Point
+		next, left = byTurn(points[len(points)-2], cur, next)
+		for _, n := range left {
+			p2 := make([]Point, len(points)+1)
+			copy(p2, points)
+			p2[len(p2)-1] = n
+			*deferred = append(*deferred, p2)
+		}
+	}
 	var objs objects
 	for _, n := range next {
 		if c.isVisited(n) {
@@ -283,9 +990,104 @@ func (c *canvas) scanPath(points []Point) objects {
 		p2 := make([]Point, len(points)+1)
 		copy(p2, points)
 		p2[len(p2)-1] = n
-		objs = append(objs, c.scanPath(p2)...)
+		r, err := c.scanBranch(p2, deferred)
+		if err != nil {
+			return nil, err
+		}
+		objs = append(objs, r...)
+	}
+	return objs, nil
+}
+
+// byTurn sorts the points of next by the way they turn from the heading of prev to cur: the
+// point turning right first, then the others, except for the points turning left, which are
+// returned apart. Polygons are scanned clockwise from their top left corner, so that turning right
+// at the junctions of a path starting at a corner closes the smallest polygon first, leaving the
+// walls it shares to its neighbors. Turning left would scan a neighbor counter-clockwise.
+func byTurn(prev, cur Point, next []Point) ([]Point, []Point) {
+	hx, hy := cur.X-prev.X, cur.Y-prev.Y
+	var right, ahead, left []Point
+	for _, n := range next {
+		dx, dy := n.X-cur.X, n.Y-cur.Y
+		switch cross := hx*dy - hy*dx; {
+		case hx*dx+hy*dy != 0 || cross == 0:
+			ahead = append(ahead, n)
+		case cross > 0:
+			right = append(right, n)
+		default:
+			left = append(left, n)
+		}
+	}
+	return append(right, ahead...), left
+}
+
+// closeAtJunction returns the smallest polygon closed by the end of the path of points, or nil if
+// there is none. The end of the path closes a polygon if it connects to a junction the path went
+// through, as with polygons sharing a corner, or to a junction of polygons found before, from which
+// their walls lead back to a junction the path went through, as with polygons sharing walls.
+func (c *canvas) closeAtJunction(points []Point) (Object, error) {
+	index := map[Point]int{}
+	for i, p := range points {
+		index[Point{X: p.X, Y: p.Y}] = i
+	}
+	cur, prev := points[len(points)-1], points[len(points)-2]
+	// The polygon closing at the latest junction of the path, along the shortest route, is the
+	// smallest: any other encloses it.
+	best := -1
+	var shared []Point
+	consider := func(k int, route []Point) {
+		if len(points)-k+len(route) >= minPolygonPoints && (k > best || k == best && len(route) < len(shared)) {
+			best, shared = k, route
+		}
+	}
+	for _, j := range c.links(cur) {
+		if j.X == prev.X && j.Y == prev.Y || !c.at(j).isJunction() || !c.isVisited(j) {
+			continue
+		}
+		if k, ok := index[j]; ok {
+			consider(k, nil)
+			continue
+		}
+		// Search the shortest routes along the walls found before from j back to the path.
+		parent := map[Point]Point{j: j}
+		queue := []Point{j}
+		for len(queue) != 0 {
+			u := queue[0]
+			queue = queue[1:]
+			for _, n := range c.links(u) {
+				if k, ok := index[n]; ok {
+					if k != len(points)-1 && c.at(n).isJunction() {
+						var route []Point
+						for p := u; ; p = parent[p] {
+							route = append([]Point{p}, route...)
+							if p == j {
+								break
+							}
+						}
+						consider(k, route)
+					}
+					continue
+				}
+				if _, ok := parent[n]; ok || !c.isVisited(n) {
+					continue
+				}
+				parent[n] = u
+				queue = append(queue, n)
+			}
+		}
 	}
-	return objs
+	if best < 0 {
+		return nil, nil
+	}
+	cycle := make([]Point, 0, len(points)-best+len(shared))
+	for _, p := range points[best:] {
+		cycle = append(cycle, Point{X: p.X, Y: p.Y})
+	}
+	o, err := c.newPolygon(append(cycle, shared...))
+	if err != nil || !o.IsClosed() {
+		return nil, err
+	}
+	return o, nil
 }
 
 // The next returns the points that can be used to make progress, scanning (in order) horizontal
@@ -298,12 +1100,23 @@ func (c *canvas) next(pos Point) []Point {
 		panic(fmt.Errorf("internal error; revisiting %s", pos))
 	}
 
+	var out []Point
+	for _, n := range c.links(pos) {
+		if !c.isVisited(n) {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+// links returns the points pos connects to, visited or not, in the order described by next.
+func (c *canvas) links(pos Point) []Point {
 	var out []Point
 
 	ch := c.at(pos)
 	if ch.canHorizontal() {
 		nextHorizontal := func(p Point) {
-			if !c.isVisited(p) && c.at(p).canHorizontal() {
+			if c.at(p).canHorizontal() {
 				out = append(out, p)
 			}
 		}
@@ -320,7 +1133,7 @@ func (c *canvas) next(pos Point) []Point {
 	}
 	if ch.canVertical() {
 		nextVertical := func(p Point) {
-			if !c.isVisited(p) && c.at(p).canVertical() {
+			if c.at(p).canVertical() {
 				out = append(out, p)
 			}
 		}
@@ -337,7 +1150,7 @@ func (c *canvas) next(pos Point) []Point {
 	}
 	if c.canDiagonal(pos) {
 		nextDiagonal := func(from, to Point) {
-			if !c.isVisited(to) && c.at(to).canDiagonalFrom(c.at(from)) {
+			if c.at(to).canDiagonalFrom(c.at(from)) && alongDiagonals(c.at(from), c.at(to), from, to) {
 				out = append(out, to)
 			}
 		}
@@ -371,26 +1184,145 @@ func (c *canvas) next(pos Point) []Point {
 		}
 	}
 
-	return out
+	// Periods and apostrophes within words are text, whatever their neighbors.
+	words := out[:0]
+	for _, n := range out {
+		if !c.inWord(n) {
+			words = append(words, n)
+		}
+	}
+	return words
+}
+
+// closeGaps extends both ends of an open path across blank cells to a box wall, if the wall is
+// no further away than allowed by the gap tolerance.
+func (c *canvas) closeGaps(points []Point) []Point {
+	if c.opts.GapTolerance <= 0 {
+		return points
+	}
+
+	// gap returns the blank cells between end and the wall it is heading towards, starting
+	// from the one closest to end.
+	gap := func(end, prev Point) []Point {
+		if c.at(end).isArrow() {
+			return nil
+		}
+		dx, dy := end.X-prev.X, end.Y-prev.Y
+		if dx != 0 && dy != 0 {
+			return nil
+		}
+
+		var out []Point
+		p := end
+		for i := 0; i <= c.opts.GapTolerance; i++ {
+			p.X += dx
+			p.Y += dy
+			if p.X < 0 || p.Y < 0 || p.X >= c.size.X || p.Y >= c.size.Y {
+				return nil
+			}
+			ch := c.at(p)
+			if ch.isSpace() && !c.isVisited(p) {
+				out = append(out, Point{X: p.X, Y: p.Y})
+				continue
+			}
+
+			// Ticks and dots are letters as often as they are line decorations, so they
+			// don't count as a wall.
+			if ch.isTick() || ch.isDot() {
+				return nil
+			}
+			if ch.isCorner() || (dx != 0 && ch.isVertical()) || (dy != 0 && ch.isHorizontal()) {
+				return out
+			}
+			return nil
+		}
+		return nil
+	}
+
+	l := len(points)
+	if tail := gap(points[l-1], points[l-2]); tail != nil {
+		points = append(points, tail...)
+	}
+	if head := gap(points[0], points[1]); head != nil {
+		out := make([]Point, 0, len(head)+len(points))
+		for i := len(head) - 1; i >= 0; i-- {
+			out = append(out, head[i])
+		}
+		points = append(out, points...)
+	}
+	return points
 }
 
+// applyCharStyles tags the untagged lines and polygons drawn with styled characters with the
+// options of the first of their characters that is styled.
+func (c *canvas) applyCharStyles(styled map[Point]rune) {
+	for _, o := range c.objects {
+		if o.IsText() || o.Tag() != "" {
+			continue
+		}
+		for _, p := range FullPoints(o) {
+			if r, ok := styled[Point{X: p.X, Y: p.Y}]; ok {
+				tag := "__a2s__char__" + string(r) + "__"
+				c.options[tag] = c.opts.CharStyles[r].Options
+				o.SetTag(tag)
+				break
+			}
+		}
+	}
+}
+
+// Used for matching [name]: {...} tag definitions, which assign options to a tag. A definition
+// occupies a line of its own.
+var tagDefRE = regexp.MustCompile(`^\s*\[([^\]]+)\]\s*:\s*(\{.*)$`)
+
 // Used for matching [X, Y]: {...} tag definitions. These definitions target specific objects.
 var objTagRE = regexp.MustCompile(`(\d+)\s*,\s*(\d+)$`)
 
-// scanText extracts a line of text.
-func (c *canvas) scanText(start Point) Object {
+// applyTagDefinition assigns the options of a tag definition line to its tag. Anything following
+// the JSON object of the definition is ignored.
+func (c *canvas) applyTagDefinition(line []byte) error {
+	matches := tagDefRE.FindSubmatch(line)
+	t := string(matches[1])
+
+	// A tag definition targeting an object will not be found within any object; we need to do
+	// that calculation here.
+	if matches := objTagRE.FindStringSubmatch(t); matches != nil {
+		if targetX, err := strconv.ParseInt(matches[1], 10, 0); err == nil {
+			if targetY, err := strconv.ParseInt(matches[2], 10, 0); err == nil {
+				for i, o := range c.objects {
+					corner := o.Corners()[0]
+					if corner.X == int(targetX) && corner.Y == int(targetY) {
+						c.objects[i].SetTag(t)
+						break
+					}
+				}
+			}
+		}
+	}
+
+	var m map[string]interface{}
+	if err := json.NewDecoder(bytes.NewReader(matches[2])).Decode(&m); err != nil {
+		return fmt.Errorf("invalid definition of tag %q: %s", t, err)
+	}
+	c.options[t] = m
+	return nil
+}
+
+// scanText extracts a line of text. Text beginning with a bracketed tag name on its own within
+// an object, "[name]", is a reference which tags the enclosing object. Bracketed text followed
+// by anything else, or a reference outside of any object, is literal text.
+func (c *canvas) scanText(start Point) (Object, error) {
 	obj := &object{points: []Point{start}, isText: true}
 	whiteSpaceStreak := 0
 	cur := start
 
 	tagged := 0
 	tag := []rune{}
-	tagDef := []rune{}
 
 	for c.canRight(cur) {
 		if cur.X == start.X && c.at(cur).isObjectStartTag() {
 			tagged++
-		} else if cur.X > start.X && c.at(cur).isObjectEndTag() {
+		} else if tagged == 1 && cur.X > start.X && c.at(cur).isObjectEndTag() {
 			tagged++
 		}
 
@@ -403,7 +1335,8 @@ func (c *canvas) scanText(start Point) Object {
 		if !ch.isTextCont() {
 			break
 		}
-		if tagged == 0 && ch.isSpace() {
+		// Whitespace is significant within a tag name.
+		if tagged != 1 && ch.isSpace() {
 			whiteSpaceStreak++
 			// Stop when we see 3 consecutive whitespace points.
 			if whiteSpaceStreak > 2 {
@@ -415,63 +1348,38 @@ func (c *canvas) scanText(start Point) Object {
 
 		switch tagged {
 		case 1:
-			if !c.at(cur).isObjectEndTag() {
+			if !c.at(cur).isObjectEndTag() && ch != wide {
 				tag = append(tag, rune(ch))
 			}
 		case 2:
-			if c.at(cur).isTagDefinitionSeparator() {
-				tagged++
-			} else {
+			if !ch.isSpace() {
 				tagged = -1
 			}
-		case 3:
-			tagDef = append(tagDef, rune(ch))
 		}
 
 		obj.points = append(obj.points, cur)
 	}
 
-	// If we found a start and end tag marker, we either need to assign the tag to the object,
-	// or we need to assign the specified options to the global canvas option space.
+	// The loop above stops before considering the last character of the grid's row.
+	if tagged == 1 && cur.X > start.X && c.at(cur).isObjectEndTag() {
+		tagged++
+	}
+
+	// If we found a start and end tag marker, we need to assign the tag to the object.
 	if tagged == 2 {
 		t := string(tag)
 		if container := c.EnclosingObjects(start); container != nil {
 			container[0].SetTag(t)
-		}
-
-		// The tag applies to the text object as well so that properties like
-		// a2s:label can be set.
-		obj.SetTag(t)
-	} else if tagged == 3 {
-		t := string(tag)
 
-		// A tag definition targeting an object will not be found within any object; we need
-		// to do that calculation here.
-		if matches := objTagRE.FindStringSubmatch(t); matches != nil {
-			if targetX, err := strconv.ParseInt(matches[1], 10, 0); err == nil {
-				if targetY, err := strconv.ParseInt(matches[2], 10, 0); err == nil {
-					for i, o := range c.objects {
-						corner := o.Corners()[0]
-						if corner.X == int(targetX) && corner.Y == int(targetY) {
-							c.objects[i].SetTag(t)
-							break
-						}
-					}
-				}
-			}
-		}
-		// This is a tag definition. Parse the JSON and assign the options to the canvas.
-		var m interface{}
-		def := []byte(string(tagDef))
-		if err := json.Unmarshal(def, &m); err != nil {
-			// TODO(dhobsd): Gross.
-			panic(err)
+			// The tag applies to the text object as well so that properties like
+			// a2s:label can be set.
+			obj.SetTag(t)
+			obj.isReference = true
 		}
+	}
 
-		// The tag applies to the reference object as well, so that properties like
-		// a2s:delref can be set.
-		obj.SetTag(t)
-		c.options[t] = m.(map[string]interface{})
+	if c.opts.KeepIndent {
+		obj.points = c.indent(obj.points)
 	}
 
 	// Trim the right side of the text object.
@@ -479,12 +1387,62 @@ func (c *canvas) scanText(start Point) Object {
 		obj.points = obj.points[:len(obj.points)-1]
 	}
 
-	obj.seal(c)
-	return obj
+	if err := obj.seal(c); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// mergeText merges each text object from index from with the text object found before it on its
+// row, when they are separated by at most c.opts.MergeText blank cells. Text setting options on
+// its container is left alone.
+func (c *canvas) mergeText(from int) error {
+	kept := c.objects[:from]
+	for _, o := range c.objects[from:] {
+		cur := o.(*object)
+		if len(kept) > from && !cur.isReference {
+			prev := kept[len(kept)-1].(*object)
+			start, end := cur.points[0], prev.points[len(prev.points)-1]
+			if !prev.isReference && start.Y == end.Y && start.X-end.X-1 <= c.opts.MergeText {
+				points := append([]Point{}, prev.points...)
+				for p := (Point{X: end.X + 1, Y: end.Y}); p.X < start.X; p.X++ {
+					if c.isVisited(p) || !c.at(p).isSpace() {
+						points = nil
+						break
+					}
+					points = append(points, p)
+				}
+				if points != nil {
+					merged := &object{points: append(points, cur.points...), isText: true}
+					if err := merged.seal(c); err != nil {
+						return err
+					}
+					for _, p := range merged.points {
+						c.visit(p)
+					}
+					kept[len(kept)-1] = merged
+					continue
+				}
+			}
+		}
+		kept = append(kept, o)
+	}
+	c.objects = kept
+	return nil
 }
 
 func (c *canvas) at(p Point) char {
-	return c.grid[p.Y*c.size.X+p.X]
+	ch := c.grid[p.Y*c.size.X+p.X]
+	// The spaces between spaced dashes are scanned as dashes.
+	if ch == ' ' && c.isSpaced(p) {
+		return '-'
+	}
+	return ch
+}
+
+// isSpaced returns true if p is a cell of a run of dashes separated by spaces.
+func (c *canvas) isSpaced(p Point) bool {
+	return c.spaced[Point{X: p.X, Y: p.Y}]
 }
 
 func (c *canvas) isVisited(p Point) bool {
@@ -505,6 +1463,29 @@ func (c *canvas) unvisit(p Point) {
 	c.visited[o] = false
 }
 
+// inWord returns true if the point holds a period or an apostrophe between two letters or digits,
+// as in "v1.0" or "don't", which are part of the text rather than rounded corners.
+func (c *canvas) inWord(p Point) bool {
+	if !c.at(p).isRoundedCorner() || !c.canLeft(p) || !c.canRight(p) {
+		return false
+	}
+	return c.at(Point{X: p.X - 1, Y: p.Y}).isWord() && c.at(Point{X: p.X + 1, Y: p.Y}).isWord()
+}
+
+// alongDiagonals returns true if the step from the character at from to the character at to runs
+// along the slant of each of them that is a diagonal: a '/' is only continued to its north-east
+// or south-west, and a '\' to its north-west or south-east. The diagonals of adjacent rows are
+// otherwise connected even when parallel, e.g. at the ragged ends of rows of different lengths.
+func alongDiagonals(fromCh, toCh char, from, to Point) bool {
+	rising := (to.X-from.X)*(to.Y-from.Y) < 0
+	for _, ch := range []char{fromCh, toCh} {
+		if ch.isDiagonalNorthEast() && !rising || ch.isDiagonalSouthEast() && rising {
+			return false
+		}
+	}
+	return true
+}
+
 func (c *canvas) canLeft(p Point) bool {
 	return p.X > 0
 }
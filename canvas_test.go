@@ -4,21 +4,29 @@
 package asciitosvg
 
 import (
+	"bytes"
+	"image"
+	"math/rand"
+	"reflect"
+	"sort"
 	"strings"
 	"testing"
 
 	"github.com/maruel/ut"
 )
 
-func TestNewCanvas(t *testing.T) {
-	t.Parallel()
-	data := []struct {
-		input     []string
-		strings   []string
-		texts     []string
-		points    [][]Point
-		allPoints bool
-	}{
+// newCanvasTest is a diagram and the objects it is parsed into.
+type newCanvasTest struct {
+	input     []string
+	strings   []string
+	texts     []string
+	points    [][]Point
+	allPoints bool
+}
+
+// newCanvasTests returns the diagrams of TestNewCanvas, which other tests use as fixtures.
+func newCanvasTests() []newCanvasTest {
+	return []newCanvasTest{
 		// 0 Small box
 		{
 			[]string{
@@ -204,8 +212,8 @@ func TestNewCanvas(t *testing.T) {
 				"Path{[(31,4) (32,4) (33,4) (34,4) (35,4) (36,4) (37,4) (38,4) (39,4) (40,4) (40,5) (40,6) (39,6) (38,6) (37,6) (36,6) (35,6) (34,6) (33,6) (32,6) (31,6) (31,5)]}",
 				"Path{[(6,5) (7,5) (8,5) (9,5) (10,5) (11,5) (12,5) (13,5) (13,6) (13,7) (12,7) (11,7) (10,7) (9,7) (8,7) (7,7) (6,7) (6,6)]}",
 				"Path{[(9,8) (9,9)]}",
-				"Path{[(9,9) (8,9) (7,9) (6,9) (5,9) (4,9) (3,9) (3,10) (3,11)]}",
 				"Path{[(9,9) (10,9) (11,9) (12,9) (13,9) (14,9) (15,9) (16,9) (17,9) (17,10) (17,11)]}",
+				"Path{[(9,9) (8,9) (7,9) (6,9) (5,9) (4,9) (3,9) (3,10) (3,11)]}",
 				"Path{[(0,12) (1,12) (2,12) (3,12) (4,12) (5,12) (6,12) (7,12) (7,13) (7,14) (6,14) (5,14) (4,14) (3,14) (2,14) (1,14) (0,14) (0,13)]}",
 				"Path{[(13,12) (14,12) (15,12) (16,12) (17,12) (18,12) (19,12) (20,12) (20,13) (20,14) (19,14) (18,14) (17,14) (16,14) (15,14) (14,14) (13,14) (13,13)]}",
 				"Path{[(16,15) (16,16)]}",
@@ -232,8 +240,8 @@ func TestNewCanvas(t *testing.T) {
 				{{X: 31, Y: 4}, {X: 40, Y: 4}, {X: 40, Y: 6}, {X: 31, Y: 6}},
 				{{X: 6, Y: 5}, {X: 13, Y: 5}, {X: 13, Y: 7}, {X: 6, Y: 7}},
 				{{X: 9, Y: 8}, {X: 9, Y: 9}},
-				{{X: 9, Y: 9}, {X: 3, Y: 9}, {X: 3, Y: 11, Hint: 3}},
 				{{X: 9, Y: 9}, {X: 17, Y: 9}, {X: 17, Y: 11, Hint: 3}},
+				{{X: 9, Y: 9}, {X: 3, Y: 9}, {X: 3, Y: 11, Hint: 3}},
 				{{X: 0, Y: 12}, {X: 7, Y: 12}, {X: 7, Y: 14}, {X: 0, Y: 14}},
 				{{X: 13, Y: 12}, {X: 20, Y: 12}, {X: 20, Y: 14}, {X: 13, Y: 14}},
 				{{X: 16, Y: 15}, {X: 16, Y: 16, Hint: 3}},
@@ -431,8 +439,182 @@ func TestNewCanvas(t *testing.T) {
 			},
 			true,
 		},
+
+		// 14 Boxes sharing an edge
+		{
+			[]string{
+				"+-+-+",
+				"| | |",
+				"+-+-+",
+			},
+			[]string{
+				"Path{[(0,0) (1,0) (2,0) (2,1) (2,2) (1,2) (0,2) (0,1)]}",
+				"Path{[(2,0) (3,0) (4,0) (4,1) (4,2) (3,2) (2,2) (2,1)]}",
+			},
+			[]string{"", ""},
+			[][]Point{
+				{{X: 0, Y: 0}, {X: 2, Y: 0}, {X: 2, Y: 2}, {X: 0, Y: 2}},
+				{{X: 2, Y: 0}, {X: 4, Y: 0}, {X: 4, Y: 2}, {X: 2, Y: 2}},
+			},
+			false,
+		},
+
+		// 15 Markers immediately following corners
+		{
+			[]string{
+				"--+>   <.",
+				"  |     |",
+				"  '>    v",
+			},
+			[]string{
+				"Path{[(0,0) (1,0) (2,0) (3,0)]}",
+				"Path{[(0,0) (1,0) (2,0) (2,1) (2,2) (3,2)]}",
+				"Path{[(7,0) (8,0) (8,1) (8,2)]}",
+			},
+			[]string{"", "", ""},
+			[][]Point{
+				{
+					{X: 0, Y: 0, Hint: 0},
+					{X: 1, Y: 0, Hint: 0},
+					{X: 2, Y: 0, Hint: 0},
+					{X: 3, Y: 0, Hint: 3},
+				},
+				{
+					{X: 0, Y: 0, Hint: 0},
+					{X: 1, Y: 0, Hint: 0},
+					{X: 2, Y: 0, Hint: 0},
+					{X: 2, Y: 1, Hint: 0},
+					{X: 2, Y: 2, Hint: 1},
+					{X: 3, Y: 2, Hint: 3},
+				},
+				{
+					{X: 7, Y: 0, Hint: 2},
+					{X: 8, Y: 0, Hint: 1},
+					{X: 8, Y: 1, Hint: 0},
+					{X: 8, Y: 2, Hint: 3},
+				},
+			},
+			true,
+		},
+
+		// 16 Boxes sharing a corner
+		{
+			[]string{
+				"+--+",
+				"|  |",
+				"+--+--+",
+				"   |  |",
+				"   +--+",
+			},
+			[]string{
+				"Path{[(0,0) (1,0) (2,0) (3,0) (3,1) (3,2) (2,2) (1,2) (0,2) (0,1)]}",
+				"Path{[(3,2) (4,2) (5,2) (6,2) (6,3) (6,4) (5,4) (4,4) (3,4) (3,3)]}",
+			},
+			[]string{"", ""},
+			[][]Point{
+				{{X: 0, Y: 0}, {X: 3, Y: 0}, {X: 3, Y: 2}, {X: 0, Y: 2}},
+				{{X: 3, Y: 2}, {X: 6, Y: 2}, {X: 6, Y: 4}, {X: 3, Y: 4}},
+			},
+			false,
+		},
+
+		// 17 Parallel diagonals on rows of different lengths
+		{
+			[]string{
+				"  /",
+				" / /",
+				"/ /",
+				" /",
+			},
+			[]string{
+				"Path{[(2,0) (1,1) (0,2)]}",
+				"Path{[(3,1) (2,2) (1,3)]}",
+			},
+			[]string{"", ""},
+			nil,
+			false,
+		},
+
+		// 18 Periods and apostrophes within words next to lines
+		{
+			[]string{
+				"v1.0  don't",
+				"  |      |",
+				"  |      |",
+			},
+			[]string{
+				"Path{[(2,1) (2,2)]}",
+				"Path{[(9,1) (9,2)]}",
+				"Text{(0,0) \"v1.0  don't\"}",
+			},
+			nil,
+			nil,
+			false,
+		},
+
+		// 19 Adjacent boxes
+		{
+			[]string{
+				"+-++-+",
+				"| || |",
+				"+-++-+",
+			},
+			[]string{
+				"Path{[(0,0) (1,0) (2,0) (2,1) (2,2) (1,2) (0,2) (0,1)]}",
+				"Path{[(3,0) (4,0) (5,0) (5,1) (5,2) (4,2) (3,2) (3,1)]}",
+			},
+			[]string{"", ""},
+			[][]Point{
+				{{X: 0, Y: 0}, {X: 2, Y: 0}, {X: 2, Y: 2}, {X: 0, Y: 2}},
+				{{X: 3, Y: 0}, {X: 5, Y: 0}, {X: 5, Y: 2}, {X: 3, Y: 2}},
+			},
+			false,
+		},
+
+		// 20 Grid of boxes sharing walls
+		{
+			[]string{
+				"+-+-+",
+				"| | |",
+				"+-+-+",
+				"| | |",
+				"+-+-+",
+			},
+			[]string{
+				"Path{[(0,0) (1,0) (2,0) (2,1) (2,2) (1,2) (0,2) (0,1)]}",
+				"Path{[(2,0) (3,0) (4,0) (4,1) (4,2) (3,2) (2,2) (2,1)]}",
+				"Path{[(0,2) (1,2) (2,2) (2,3) (2,4) (1,4) (0,4) (0,3)]}",
+				"Path{[(2,2) (3,2) (4,2) (4,3) (4,4) (3,4) (2,4) (2,3)]}",
+			},
+			[]string{"", "", "", ""},
+			nil,
+			false,
+		},
+
+		// 21 Vertical lines, starting at a corner or not, aren't closed below their start
+		{
+			[]string{
+				"+ |",
+				"| |",
+				"| |",
+			},
+			[]string{
+				"Path{[(0,0) (0,1) (0,2)]}",
+				"Path{[(2,0) (2,1) (2,2)]}",
+			},
+			[]string{"", ""},
+			[][]Point{
+				{{X: 0, Y: 0}, {X: 0, Y: 2}},
+				{{X: 2, Y: 0}, {X: 2, Y: 2}},
+			},
+			false,
+		},
 	}
-	for i, line := range data {
+}
+
+func TestNewCanvas(t *testing.T) {
+	t.Parallel()
+	for i, line := range newCanvasTests() {
 		c, err := NewCanvas([]byte(strings.Join(line.input, "\n")), 9, true)
 		if err != nil {
 			t.Fatalf("Test %d: error creating canvas: %s", i, err)
@@ -472,43 +654,102 @@ func TestNewCanvasBroken(t *testing.T) {
 			[]string{"github.com/foo/bar"},
 			[][]Point{{{X: 0, Y: 0}, {X: 17, Y: 0}}},
 		},
+	}
+	for i, line := range data {
+		c, err := NewCanvas([]byte(strings.Join(line.input, "\n")), 9, true)
+		if err != nil {
+			t.Fatalf("Test %d: error creating canvas: %s", i, err)
+		}
+		objs := c.Objects()
+		if line.strings != nil {
+			ut.AssertEqualIndex(t, i, line.strings, getStrings(objs))
+		}
+		if line.texts != nil {
+			ut.AssertEqualIndex(t, i, line.texts, getTexts(objs))
+		}
+		if line.corners != nil {
+			ut.AssertEqualIndex(t, i, line.corners, getCorners(objs))
+		}
+	}
+}
+
+func TestScanTextTags(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		input   []string
+		strings []string
+		tags    []string
+	}{
+		// 0 Reference within a box
+		{
+			[]string{
+				"+------+",
+				"|[a]   |",
+				"+------+",
+			},
+			[]string{"Path{[(0,0) (1,0) (2,0) (3,0) (4,0) (5,0) (6,0) (7,0) (7,1) (7,2) (6,2) (5,2) (4,2) (3,2) (2,2) (1,2) (0,2) (0,1)]}", "Text{(1,1) \"[a]\"}"},
+			[]string{"a", "a"},
+		},
 
-		// 1 Merged boxes
+		// 1 Reference within a box, touching its border
 		{
 			[]string{
-				"+-+-+",
-				"| | |",
-				"+-+-+",
+				"+---+",
+				"|[a]|",
+				"+---+",
+			},
+			[]string{"Path{[(0,0) (1,0) (2,0) (3,0) (4,0) (4,1) (4,2) (3,2) (2,2) (1,2) (0,2) (0,1)]}", "Text{(1,1) \"[a]\"}"},
+			[]string{"a", "a"},
+		},
+
+		// 2 Bracketed text within a box
+		{
+			[]string{
+				"+----------+",
+				"|[a] Editor|",
+				"+----------+",
 			},
-			[]string{"Path{[(0,0) (1,0) (2,0) (3,0) (4,0) (4,1) (4,2) (3,2) (2,2) (1,2) (0,2) (0,1)]}", "Path{[(0,0) (1,0) (2,0) (3,0) (4,0) (4,1) (4,2) (3,2) (2,2) (2,1)]}"},
+			[]string{"Path{[(0,0) (1,0) (2,0) (3,0) (4,0) (5,0) (6,0) (7,0) (8,0) (9,0) (10,0) (11,0) (11,1) (11,2) (10,2) (9,2) (8,2) (7,2) (6,2) (5,2) (4,2) (3,2) (2,2) (1,2) (0,2) (0,1)]}", "Text{(1,1) \"[a] Editor\"}"},
 			[]string{"", ""},
-			// TODO(dhobsd): BROKEN.
-			[][]Point{
-				{{X: 0, Y: 0}, {X: 4, Y: 0}, {X: 4, Y: 2}, {X: 0, Y: 2}},
-				{{X: 0, Y: 0}, {X: 4, Y: 0}, {X: 4, Y: 2}, {X: 2, Y: 2}, {X: 2, Y: 1}},
+		},
+
+		// 3 Bracketed text at the top level
+		{
+			[]string{
+				"[note]",
+				" [x]   [y]",
 			},
+			[]string{"Text{(0,0) \"[note]\"}", "Text{(1,1) \"[x]\"}", "Text{(7,1) \"[y]\"}"},
+			[]string{"", "", ""},
 		},
 
-		// 2 Adjacent boxes
+		// 4 Definition
 		{
-			// TODO(dhobsd): BROKEN. This one is hard, as it can be seen as 3 boxes
-			// but that is not what is desired.
 			[]string{
-				"+-++-+",
-				"| || |",
-				"+-++-+",
+				"[a]: {\"fill\":\"#fff\"}",
 			},
+			[]string{},
+			[]string{},
+		},
+
+		// 5 Bracketed text followed by a colon, but no definition
+		{
 			[]string{
-				"Path{[(0,0) (1,0) (2,0) (3,0) (4,0) (5,0) (5,1) (5,2) (4,2) (3,2) (2,2) (1,2) (0,2) (0,1)]}",
-				"Path{[(0,0) (1,0) (2,0) (3,0) (4,0) (5,0) (5,1) (5,2) (4,2) (3,2) (2,2) (2,1)]}",
-				"Path{[(0,0) (1,0) (2,0) (3,0) (4,0) (5,0) (5,1) (5,2) (4,2) (3,2) (3,1)]}",
+				"[a]: see below",
 			},
-			[]string{"", "", ""},
-			[][]Point{
-				{{X: 0, Y: 0}, {X: 5, Y: 0}, {X: 5, Y: 2}, {X: 0, Y: 2}},
-				{{X: 0, Y: 0}, {X: 5, Y: 0}, {X: 5, Y: 2}, {X: 2, Y: 2}, {X: 2, Y: 1}},
-				{{X: 0, Y: 0}, {X: 5, Y: 0}, {X: 5, Y: 2}, {X: 3, Y: 2}, {X: 3, Y: 1}},
+			[]string{"Text{(0,0) \"[a]: see below\"}"},
+			[]string{""},
+		},
+
+		// 6 Reference after double-width text, which takes two cells per rune
+		{
+			[]string{
+				"+------------+",
+				"|\u4e2d\u6587   [a]  |",
+				"+------------+",
 			},
+			[]string{"Path{[(0,0) (1,0) (2,0) (3,0) (4,0) (5,0) (6,0) (7,0) (8,0) (9,0) (10,0) (11,0) (12,0) (13,0) (13,1) (13,2) (12,2) (11,2) (10,2) (9,2) (8,2) (7,2) (6,2) (5,2) (4,2) (3,2) (2,2) (1,2) (0,2) (0,1)]}", "Text{(1,1) \"\u4e2d\u6587\"}", "Text{(8,1) \"[a]\"}"},
+			[]string{"a", "", "a"},
 		},
 	}
 	for i, line := range data {
@@ -517,68 +758,864 @@ func TestNewCanvasBroken(t *testing.T) {
 			t.Fatalf("Test %d: error creating canvas: %s", i, err)
 		}
 		objs := c.Objects()
-		if line.strings != nil {
-			ut.AssertEqualIndex(t, i, line.strings, getStrings(objs))
-		}
-		if line.texts != nil {
-			ut.AssertEqualIndex(t, i, line.texts, getTexts(objs))
-		}
-		if line.corners != nil {
-			ut.AssertEqualIndex(t, i, line.corners, getCorners(objs))
-		}
+		ut.AssertEqualIndex(t, i, line.strings, getStrings(objs))
+		ut.AssertEqualIndex(t, i, line.tags, getTags(objs))
 	}
 }
 
-func TestPointsToCorners(t *testing.T) {
+func TestParseGapTolerance(t *testing.T) {
 	t.Parallel()
 	data := []struct {
-		in       []Point
-		expected []Point
-		closed   bool
+		input     []string
+		tolerance int
+		strings   []string
 	}{
+		// 0 One cell gap, no tolerance
 		{
-			[]Point{{X: 0, Y: 0}, {X: 1, Y: 0}},
-			[]Point{{X: 0, Y: 0}, {X: 1, Y: 0}},
-			false,
+			[]string{
+				"+--+",
+				"|  | ---",
+				"+--+",
+			},
+			0,
+			[]string{"Path{[(0,0) (1,0) (2,0) (3,0) (3,1) (3,2) (2,2) (1,2) (0,2) (0,1)]}", "Path{[(5,1) (6,1) (7,1)]}"},
 		},
+
+		// 1 One cell gap
 		{
-			[]Point{{X: 0, Y: 0}, {X: 1, Y: 0}, {X: 2, Y: 0}},
-			[]Point{{X: 0, Y: 0}, {X: 2, Y: 0}},
-			false,
+			[]string{
+				"+--+",
+				"|  | ---",
+				"+--+",
+			},
+			1,
+			[]string{"Path{[(0,0) (1,0) (2,0) (3,0) (3,1) (3,2) (2,2) (1,2) (0,2) (0,1)]}", "Path{[(4,1) (5,1) (6,1) (7,1)]}"},
 		},
+
+		// 2 Two cell gap on either side of the line
 		{
-			[]Point{{X: 0, Y: 0}, {X: 1, Y: 0}, {X: 1, Y: 1}},
-			[]Point{{X: 0, Y: 0}, {X: 1, Y: 0}, {X: 1, Y: 1}},
-			false,
+			[]string{
+				"+--+       +--+",
+				"|  |  ---  |  |",
+				"+--+       +--+",
+			},
+			1,
+			[]string{"Path{[(0,0) (1,0) (2,0) (3,0) (3,1) (3,2) (2,2) (1,2) (0,2) (0,1)]}", "Path{[(11,0) (12,0) (13,0) (14,0) (14,1) (14,2) (13,2) (12,2) (11,2) (11,1)]}", "Path{[(6,1) (7,1) (8,1)]}"},
 		},
+
+		// 3 Two cell gap on either side of the line, within tolerance
 		{
-			[]Point{
-				{X: 0, Y: 0}, {X: 1, Y: 0}, {X: 2, Y: 0}, {X: 2, Y: 1}, {X: 2, Y: 2},
-				{X: 1, Y: 2}, {X: 0, Y: 2}, {X: 0, Y: 1},
+			[]string{
+				"+--+       +--+",
+				"|  |  ---  |  |",
+				"+--+       +--+",
 			},
-			[]Point{{X: 0, Y: 0}, {X: 2, Y: 0}, {X: 2, Y: 2}, {X: 0, Y: 2}},
-			true,
+			2,
+			[]string{"Path{[(0,0) (1,0) (2,0) (3,0) (3,1) (3,2) (2,2) (1,2) (0,2) (0,1)]}", "Path{[(11,0) (12,0) (13,0) (14,0) (14,1) (14,2) (13,2) (12,2) (11,2) (11,1)]}", "Path{[(4,1) (5,1) (6,1) (7,1) (8,1) (9,1) (10,1)]}"},
 		},
+
+		// 4 Vertical gap
 		{
-			[]Point{{X: 0, Y: 0}, {X: 1, Y: 0}, {X: 1, Y: 1}, {X: 0, Y: 1}},
-			[]Point{{X: 0, Y: 0}, {X: 1, Y: 0}, {X: 1, Y: 1}, {X: 0, Y: 1}},
-			// TODO(dhobsd): Unexpected; broken.
-			false,
+			[]string{
+				"  |",
+				"  |",
+				"",
+				"+---+",
+			},
+			1,
+			[]string{"Path{[(2,0) (2,1) (2,2)]}", "Path{[(0,3) (1,3) (2,3) (3,3) (4,3)]}"},
+		},
+
+		// 5 Markers stay where they are
+		{
+			[]string{
+				"+--+",
+				"|  | <--",
+				"+--+",
+			},
+			1,
+			[]string{"Path{[(0,0) (1,0) (2,0) (3,0) (3,1) (3,2) (2,2) (1,2) (0,2) (0,1)]}", "Path{[(5,1) (6,1) (7,1)]}"},
+		},
+
+		// 6 Text is not a wall
+		{
+			[]string{
+				"--- foo",
+			},
+			1,
+			[]string{"Path{[(0,0) (1,0) (2,0)]}", "Text{(4,0) \"foo\"}"},
 		},
 	}
 	for i, line := range data {
-		p, c := pointsToCorners(line.in)
-		ut.AssertEqualIndex(t, i, line.expected, p)
-		ut.AssertEqualIndex(t, i, line.closed, c)
+		c, err := Parse([]byte(strings.Join(line.input, "\n")), ParseOptions{GapTolerance: line.tolerance})
+		if err != nil {
+			t.Fatalf("Test %d: error creating canvas: %s", i, err)
+		}
+		ut.AssertEqualIndex(t, i, line.strings, getStrings(c.Objects()))
 	}
 }
 
-func BenchmarkT(b *testing.B) {
-	data := []string{
-		"             +-----+-------+",
-		"             |     |       |",
-		"             |     |       |",
-		"        +----+-----+----   |",
+func TestParseTagDefinitions(t *testing.T) {
+	t.Parallel()
+	input := []string{
+		"+---+",
+		"|[a]|",
+		"+---+",
+		"",
+		"[a]: {\"fill\":\"#eee\"} trailing",
+		"[b]: {\"fill\":\"#ddd\"}",
+		"  [0,0]: {\"a2s:delref\":1}",
+	}
+	c, err := Parse([]byte(strings.Join(input, "\n")), ParseOptions{})
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	// The aligned separators of the definitions don't form a line.
+	expected := []string{"Path{[(0,0) (1,0) (2,0) (3,0) (4,0) (4,1) (4,2) (3,2) (2,2) (1,2) (0,2) (0,1)]}", "Text{(1,1) \"[a]\"}"}
+	ut.AssertEqual(t, expected, getStrings(c.Objects()))
+	ut.AssertEqual(t, []string{"0,0", "a"}, getTags(c.Objects()))
+	ut.AssertEqual(t, image.Point{5, 7}, c.Size())
+	ut.AssertEqual(t, "#eee", c.Options()["a"]["fill"])
+	ut.AssertEqual(t, "#ddd", c.Options()["b"]["fill"])
+	ut.AssertEqual(t, 1., c.Options()["0,0"]["a2s:delref"])
+
+	_, err = Parse([]byte("[a]: {\"fill\""), ParseOptions{})
+	ut.AssertEqual(t, true, err != nil)
+}
+
+func TestParseKeepIndent(t *testing.T) {
+	t.Parallel()
+	input := []string{
+		"   label",
+		"+---+ foo",
+		"|   |",
+		"+---+",
+	}
+	data := []struct {
+		keepIndent bool
+		strings    []string
+	}{
+		{false, []string{"Path{[(0,1) (1,1) (2,1) (3,1) (4,1) (4,2) (4,3) (3,3) (2,3) (1,3) (0,3) (0,2)]}", "Text{(3,0) \"label\"}", "Text{(6,1) \"foo\"}"}},
+		{true, []string{"Path{[(0,1) (1,1) (2,1) (3,1) (4,1) (4,2) (4,3) (3,3) (2,3) (1,3) (0,3) (0,2)]}", "Text{(0,0) \"   label\"}", "Text{(6,1) \"foo\"}"}},
+	}
+	for i, line := range data {
+		c, err := Parse([]byte(strings.Join(input, "\n")), ParseOptions{KeepIndent: line.keepIndent})
+		if err != nil {
+			t.Fatalf("Test %d: error creating canvas: %s", i, err)
+		}
+		ut.AssertEqualIndex(t, i, line.strings, getStrings(c.Objects()))
+	}
+}
+
+func TestParseCharStyles(t *testing.T) {
+	t.Parallel()
+	input := []string{
+		"+--+",
+		"|  |~~~>",
+		"+--+",
+	}
+	wavy := map[string]interface{}{"stroke-dasharray": "1 3"}
+	c, err := Parse([]byte(strings.Join(input, "\n")), ParseOptions{CharStyles: map[rune]CharStyle{'~': {As: '-', Options: wavy}}})
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	expected := []string{"Path{[(0,0) (1,0) (2,0) (3,0) (3,1) (3,2) (2,2) (1,2) (0,2) (0,1)]}", "Path{[(4,1) (5,1) (6,1) (7,1)]}"}
+	ut.AssertEqual(t, expected, getStrings(c.Objects()))
+	ut.AssertEqual(t, []string{"", "__a2s__char__~__"}, getTags(c.Objects()))
+	ut.AssertEqual(t, wavy, c.Options()["__a2s__char__~__"])
+
+	actual := string(CanvasToSVG(c, false, "", 9, 16))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<path id=\"open1\" marker-end=\"url(#Pointer)\" stroke-dasharray=\"1 3\" d="))
+}
+
+func TestParseSimplify(t *testing.T) {
+	t.Parallel()
+	input := []byte(strings.Join([]string{
+		".----.",
+		"|    |---->",
+		"'----'  |",
+		"        +--",
+		"        v",
+	}, "\n"))
+	full, err := Parse(input, ParseOptions{})
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	simple, err := Parse(input, ParseOptions{Simplify: true})
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	ut.AssertEqual(t, len(full.Objects()), len(simple.Objects()))
+	for i, o := range simple.Objects() {
+		f := full.Objects()[i]
+		ut.AssertEqualIndex(t, i, f.Points(), FullPoints(o))
+		ut.AssertEqualIndex(t, i, f.Corners(), o.Corners())
+		// Only the ends, the corners and the hinted points are left.
+		for _, p := range o.Points() {
+			corner := false
+			for _, c := range o.Corners() {
+				corner = corner || (c.X == p.X && c.Y == p.Y)
+			}
+			ut.AssertEqualIndex(t, i, true, corner || p.Hint != None)
+		}
+	}
+	ut.AssertEqual(t, []string{
+		"Path{[(0,0) (5,0) (5,2) (0,2)]}",
+		"Path{[(6,1) (10,1)]}",
+		"Path{[(8,2) (8,3)]}",
+		"Path{[(8,3) (10,3)]}",
+		"Path{[(8,3) (8,4)]}",
+	}, getStrings(simple.Objects()))
+	ut.AssertEqual(t, string(CanvasToSVG(full, false, "", 9, 16)), string(CanvasToSVG(simple, false, "", 9, 16)))
+}
+
+func TestParseSpacedDashes(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		input    []string
+		expected []string
+	}{
+		// 0 Spaced dashes
+		{
+			[]string{"- - - - -"},
+			[]string{"Path{[(0,0) (1,0) (2,0) (3,0) (4,0) (5,0) (6,0) (7,0) (8,0)]} dashed"},
+		},
+		// 1 Too few dashes, and dashes that aren't evenly spaced
+		{
+			[]string{"a - b - c", "-  -  -"},
+			[]string{"Text{(0,0) \"a - b - c\"}"},
+		},
+		// 2 Solid line followed by spaced dashes
+		{
+			[]string{"--- - -"},
+			[]string{"Path{[(0,0) (1,0) (2,0)]} solid"},
+		},
+	}
+	for i, line := range data {
+		c, err := Parse([]byte(strings.Join(line.input, "\n")), ParseOptions{SpacedDashes: true})
+		if err != nil {
+			t.Fatalf("Test %d: error creating canvas: %s", i, err)
+		}
+		var actual []string
+		for _, o := range c.Objects() {
+			s := o.String()
+			if !o.IsText() {
+				if o.IsDashed() {
+					s += " dashed"
+				} else {
+					s += " solid"
+				}
+			}
+			actual = append(actual, s)
+		}
+		ut.AssertEqualIndex(t, i, line.expected, actual)
+	}
+
+	// The grid keeps the spaces between the dashes.
+	c, err := Parse([]byte("- - -"), ParseOptions{SpacedDashes: true})
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	ut.AssertEqual(t, []char("- - -"), c.(*canvas).grid)
+}
+
+func TestParseCloseBoxes(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		input    []string
+		expected []string
+	}{
+		// 0 Box missing its bottom side
+		{
+			[]string{
+				"+-----+",
+				"| foo |",
+				"|     |",
+			},
+			[]string{
+				"Path{[(0,0) (1,0) (2,0) (3,0) (4,0) (5,0) (6,0) (6,1) (6,2) (5,2) (4,2) (3,2) (2,2) (1,2) (0,2) (0,1)]} closed",
+				"Text{(2,1) \"foo\"} open",
+			},
+		},
+		// 1 Rounded box
+		{
+			[]string{
+				".--.",
+				"|  |",
+				"|  |",
+			},
+			[]string{"Path{[(0,0) (1,0) (2,0) (3,0) (3,1) (3,2) (2,2) (1,2) (0,2) (0,1)]} closed"},
+		},
+		// 2 Closed box left as it is
+		{
+			[]string{
+				"+--+",
+				"|  |",
+				"+--+",
+			},
+			[]string{"Path{[(0,0) (1,0) (2,0) (3,0) (3,1) (3,2) (2,2) (1,2) (0,2) (0,1)]} closed"},
+		},
+		// 3 Sides of different lengths, and a last row that isn't blank
+		{
+			[]string{
+				"+--+  +--+",
+				"|  |  |  |",
+				"|     |ab|",
+			},
+			[]string{
+				"Path{[(0,0) (1,0) (2,0) (3,0) (3,1)]} open",
+				"Path{[(0,0) (0,1) (0,2)]} open",
+				"Path{[(6,0) (7,0) (8,0) (9,0) (9,1) (9,2)]} open",
+				"Path{[(6,0) (6,1) (6,2)]} open",
+				"Text{(7,2) \"ab\"} open",
+			},
+		},
+	}
+	for i, line := range data {
+		c, err := Parse([]byte(strings.Join(line.input, "\n")), ParseOptions{CloseBoxes: true})
+		if err != nil {
+			t.Fatalf("Test %d: error creating canvas: %s", i, err)
+		}
+		var actual []string
+		for _, o := range c.Objects() {
+			if o.IsClosed() {
+				actual = append(actual, o.String()+" closed")
+			} else {
+				actual = append(actual, o.String()+" open")
+			}
+		}
+		ut.AssertEqualIndex(t, i, line.expected, actual)
+	}
+}
+
+func TestParseMinObjectCells(t *testing.T) {
+	t.Parallel()
+	input := []string{
+		"+--+  |",
+		"|  |  |  --",
+		"+--+ ----",
+		"",
+		"x",
+	}
+	data := []struct {
+		min      int
+		expected []string
+	}{
+		{0, []string{"Path{[(0,0) (3,0) (3,2) (0,2)]}", "Path{[(6,0) (6,1)]}", "Path{[(9,1) (10,1)]}", "Path{[(5,2) (8,2)]}", "Text{(0,4) \"x\"}"}},
+		{3, []string{"Path{[(0,0) (3,0) (3,2) (0,2)]}", "Path{[(5,2) (8,2)]}", "Text{(0,4) \"x\"}"}},
+		{5, []string{"Path{[(0,0) (3,0) (3,2) (0,2)]}", "Text{(0,4) \"x\"}"}},
+	}
+	for i, line := range data {
+		c, err := Parse([]byte(strings.Join(input, "\n")), ParseOptions{MinObjectCells: line.min, Simplify: true})
+		if err != nil {
+			t.Fatalf("Test %d: error creating canvas: %s", i, err)
+		}
+		var actual []string
+		for _, o := range c.Objects() {
+			actual = append(actual, o.String())
+		}
+		ut.AssertEqualIndex(t, i, line.expected, actual)
+	}
+}
+
+func TestParseMergeText(t *testing.T) {
+	t.Parallel()
+	input := []string{
+		"a    b    c",
+		"",
+		"d -- e",
+	}
+	data := []struct {
+		merge    int
+		expected []string
+	}{
+		{0, []string{"Path{[(2,2) (3,2)]}", "Text{(0,0) \"a\"}", "Text{(5,0) \"b\"}", "Text{(10,0) \"c\"}", "Text{(0,2) \"d\"}", "Text{(5,2) \"e\"}"}},
+		{3, []string{"Path{[(2,2) (3,2)]}", "Text{(0,0) \"a\"}", "Text{(5,0) \"b\"}", "Text{(10,0) \"c\"}", "Text{(0,2) \"d\"}", "Text{(5,2) \"e\"}"}},
+		{4, []string{"Path{[(2,2) (3,2)]}", "Text{(0,0) \"a    b    c\"}", "Text{(0,2) \"d\"}", "Text{(5,2) \"e\"}"}},
+	}
+	for i, line := range data {
+		c, err := Parse([]byte(strings.Join(input, "\n")), ParseOptions{MergeText: line.merge})
+		if err != nil {
+			t.Fatalf("Test %d: error creating canvas: %s", i, err)
+		}
+		var actual []string
+		for _, o := range c.Objects() {
+			actual = append(actual, o.String())
+		}
+		ut.AssertEqualIndex(t, i, line.expected, actual)
+	}
+}
+
+func TestParsePreformatted(t *testing.T) {
+	t.Parallel()
+	input := []string{
+		"+----------------+",
+		"|[t]             |",
+		"| Name   | Size  |",
+		"| foo.go |   12  |",
+		"+----------------+",
+		"",
+		"[t]: {\"a2s:pre\":%s}",
+	}
+	data := []struct {
+		pre      string
+		expected []string
+	}{
+		// 0 Text scanned as usual
+		{
+			"false",
+			[]string{
+				"Path{[(0,0) (1,0) (2,0) (3,0) (4,0) (5,0) (6,0) (7,0) (8,0) (9,0) (10,0) (11,0) (12,0) (13,0) (14,0) (15,0) (16,0) (17,0) (17,1) (17,2) (17,3) (17,4) (16,4) (15,4) (14,4) (13,4) (12,4) (11,4) (10,4) (9,4) (8,4) (7,4) (6,4) (5,4) (4,4) (3,4) (2,4) (1,4) (0,4) (0,3) (0,2) (0,1)]}",
+				"Path{[(9,2) (9,3)]}",
+				"Text{(1,1) \"[t]\"}",
+				"Text{(2,2) \"Name\"}",
+				"Text{(11,2) \"Size\"}",
+				"Text{(2,3) \"foo.go\"}",
+				"Text{(13,3) \"12\"}",
+			},
+		},
+		// 1 Rows kept verbatim
+		{
+			"true",
+			[]string{
+				"Path{[(0,0) (1,0) (2,0) (3,0) (4,0) (5,0) (6,0) (7,0) (8,0) (9,0) (10,0) (11,0) (12,0) (13,0) (14,0) (15,0) (16,0) (17,0) (17,1) (17,2) (17,3) (17,4) (16,4) (15,4) (14,4) (13,4) (12,4) (11,4) (10,4) (9,4) (8,4) (7,4) (6,4) (5,4) (4,4) (3,4) (2,4) (1,4) (0,4) (0,3) (0,2) (0,1)]}",
+				"Text{(1,1) \"[t]\"}",
+				"Text{(2,2) \"Name   | Size\"}",
+				"Text{(2,3) \"foo.go |   12\"}",
+			},
+		},
+	}
+	for i, line := range data {
+		in := strings.Replace(strings.Join(input, "\n"), "%s", line.pre, 1)
+		c, err := Parse([]byte(in), ParseOptions{})
+		if err != nil {
+			t.Fatalf("Test %d: error creating canvas: %s", i, err)
+		}
+		ut.AssertEqualIndex(t, i, line.expected, getStrings(c.Objects()))
+	}
+	c, err := Parse([]byte(strings.Replace(strings.Join(input, "\n"), "%s", "true", 1)), ParseOptions{})
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	actual := string(CanvasToSVG(c, false, "", 9, 16))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<text id=\"obj3\" x=\"22.5\" y=\"56\" xml:space=\"preserve\" fill=\"#000\">foo.go |   12</text>"))
+
+	// Lines partly within the box aren't taken for text, and only the text of the box keeps its
+	// spaces.
+	c, err = Parse([]byte(strings.Join([]string{
+		"+-----------+",
+		"|[t]        |",
+		"| a  b  ----+--->",
+		"+-----------+",
+		"c  d",
+		"",
+		"[t]: {\"a2s:pre\":true}",
+	}, "\n")), ParseOptions{})
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	texts := getStrings(c.Objects())[3:]
+	ut.AssertEqual(t, []string{"Text{(1,1) \"[t]\"}", "Text{(2,2) \"a  b\"}", "Text{(0,4) \"c  d\"}"}, texts)
+	actual = string(CanvasToSVG(c, false, "", 9, 16))
+	ut.AssertEqual(t, true, strings.Contains(actual, "xml:space=\"preserve\" fill=\"#000\">a  b</text>"))
+	ut.AssertEqual(t, true, strings.Contains(actual, "fill=\"#000\">c  d</text>"))
+	ut.AssertEqual(t, 1, strings.Count(actual, "xml:space"))
+}
+
+func TestParseSize(t *testing.T) {
+	t.Parallel()
+	input := []byte("+--+\n|ab|\n+--+")
+	data := []struct {
+		width, height int
+		size          image.Point
+		strings       []string
+	}{
+		// 0 Natural size
+		{0, 0, image.Point{X: 4, Y: 3}, []string{"Path{[(0,0) (1,0) (2,0) (3,0) (3,1) (3,2) (2,2) (1,2) (0,2) (0,1)]}", "Text{(1,1) \"ab\"}"}},
+		// 1 Padded
+		{8, 5, image.Point{X: 8, Y: 5}, []string{"Path{[(0,0) (1,0) (2,0) (3,0) (3,1) (3,2) (2,2) (1,2) (0,2) (0,1)]}", "Text{(1,1) \"ab\"}"}},
+		// 2 Truncated
+		{3, 2, image.Point{X: 3, Y: 2}, []string{"Path{[(0,0) (1,0) (2,0)]}", "Path{[(0,0) (0,1)]}", "Text{(1,1) \"ab\"}"}},
+	}
+	for i, line := range data {
+		c, err := Parse(input, ParseOptions{Width: line.width, Height: line.height})
+		if err != nil {
+			t.Fatalf("Test %d: error creating canvas: %s", i, err)
+		}
+		ut.AssertEqualIndex(t, i, line.size, c.Size())
+		ut.AssertEqualIndex(t, i, line.strings, getStrings(c.Objects()))
+	}
+}
+
+func TestParseMaxCells(t *testing.T) {
+	t.Parallel()
+	input := []byte("+--+\n|  |\n+--+")
+	data := []struct {
+		maxCells int
+		err      string
+	}{
+		{0, ""},
+		{12, ""},
+		{11, "diagram of 4x3 cells exceeds the maximum of 11 cells"},
+	}
+	for i, line := range data {
+		_, err := Parse(input, ParseOptions{MaxCells: line.maxCells})
+		actual := ""
+		if err != nil {
+			actual = err.Error()
+		}
+		ut.AssertEqualIndex(t, i, line.err, actual)
+	}
+
+	// A single huge line is rejected before its grid is allocated.
+	_, err := Parse(bytes.Repeat([]byte{'-'}, 1<<20), ParseOptions{MaxCells: 1 << 16})
+	ut.AssertEqual(t, true, err != nil)
+
+	// So is a huge forced size, before the grid is padded to it.
+	_, err = Parse(input, ParseOptions{Height: 10000000, MaxCells: 100})
+	ut.AssertEqual(t, "diagram of 4x10000000 cells exceeds the maximum of 100 cells", err.Error())
+	_, err = Parse(input, ParseOptions{Width: 2, Height: 50, MaxCells: 100})
+	ut.AssertEqual(t, nil, err)
+}
+
+func TestParseLineEndings(t *testing.T) {
+	t.Parallel()
+	input := []string{
+		"+------+",
+		"| [a]  |--->",
+		"+------+",
+		"",
+		"[a]: {\"fill\":\"#eee\"}",
+	}
+	objects := func(data string) []string {
+		c, err := Parse([]byte(data), ParseOptions{})
+		if err != nil {
+			t.Fatalf("Error creating canvas: %s", err)
+		}
+		var out []string
+		for _, o := range c.Objects() {
+			out = append(out, o.String()+" "+o.Tag())
+		}
+		return out
+	}
+	expected := objects(strings.Join(input, "\n"))
+	data := []string{
+		// 0 Windows
+		strings.Join(input, "\r\n"),
+		// 1 Classic Mac OS
+		strings.Join(input, "\r"),
+		// 2 Mixed
+		input[0] + "\r\n" + input[1] + "\r" + input[2] + "\n" + input[3] + "\r\n" + input[4],
+	}
+	for i, line := range data {
+		ut.AssertEqualIndex(t, i, expected, objects(line))
+	}
+}
+
+func TestParseInvalidUTF8(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		input string
+		err   string
+	}{
+		{"+--+\n| \xff|", "invalid UTF-8 encoding on line 1 at byte offset 2; rune offset 2"},
+		{"+--+\n|\u00e9\xc3|", "invalid UTF-8 encoding on line 1 at byte offset 3; rune offset 2"},
+		// An encoded replacement character is valid.
+		{"+--+\n|\ufffd |", ""},
+	}
+	for i, line := range data {
+		_, err := Parse([]byte(line.input), ParseOptions{})
+		actual := ""
+		if err != nil {
+			actual = err.Error()
+		}
+		ut.AssertEqualIndex(t, i, line.err, actual)
+	}
+}
+
+func TestExpandTabs(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		in       string
+		expected string
+	}{
+		{"a\tb", "a   b"},
+		{"\t\tb", "        b"},
+		{"\u00e9\tb", "\u00e9   b"},
+		{"\u00e9\u00e9\u00e9\u00e9\tb", "\u00e9\u00e9\u00e9\u00e9    b"},
+		{"\u4e2d\tb", "\u4e2d  b"},
+	}
+	for i, line := range data {
+		actual, err := expandTabs([]byte(line.in), 4)
+		ut.AssertEqualIndex(t, i, nil, err)
+		ut.AssertEqualIndex(t, i, line.expected, string(actual))
+	}
+}
+
+func TestCanvasUpdate(t *testing.T) {
+	t.Parallel()
+	before := []string{
+		"+--+",
+		"|  |",
+		"+--+",
+		"",
+		"",
+		"+--+  foo",
+		"|  |",
+		"+--+",
+	}
+	data := []struct {
+		rows  []int
+		after []string
+	}{
+		// 0 Text added next to the lower box
+		{
+			[]int{6},
+			[]string{"+--+", "|  |", "+--+", "", "", "+--+  foo", "|  |  bar", "+--+"},
+		},
+		// 1 Lower box turned into a line
+		{
+			[]int{5, 6},
+			[]string{"+--+", "|  |", "+--+", "", "", "---   foo", "", "+--+"},
+		},
+		// 2 Boxes joined by a line
+		{
+			[]int{3, 4},
+			[]string{"+--+", "|  |", "+--+", " |", " |", "+--+  foo", "|  |", "+--+"},
+		},
+		// 3 Wider diagram
+		{
+			[]int{1},
+			[]string{"+--+", "|  |  a wide line", "+--+", "", "", "+--+  foo", "|  |", "+--+"},
+		},
+	}
+	for i, line := range data {
+		c, err := NewCanvas([]byte(strings.Join(before, "\n")), 9, true)
+		ut.AssertEqualIndex(t, i, nil, err)
+		first := c.Objects()[0]
+		after := []byte(strings.Join(line.after, "\n"))
+		ut.AssertEqualIndex(t, i, nil, c.(Updater).Update(line.rows, after))
+
+		expected, err := NewCanvas(after, 9, true)
+		ut.AssertEqualIndex(t, i, nil, err)
+		ut.AssertEqualIndex(t, i, getStrings(expected.Objects()), getStrings(c.Objects()))
+		ut.AssertEqualIndex(t, i, getTexts(expected.Objects()), getTexts(c.Objects()))
+		if i < 2 {
+			// The upper box is far from the changes and is kept as is.
+			ut.AssertEqualIndex(t, i, true, first == c.Objects()[0])
+		}
+	}
+
+	c, err := NewCanvas([]byte(strings.Join(before, "\n")), 9, true)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, "row 8 is out of range", c.(Updater).Update([]int{8}, []byte(strings.Join(before, "\n"))).Error())
+
+	// A failed update leaves the canvas as it was, even if some of the rows were valid.
+	grid, objs := c.String(), getStrings(c.Objects())
+	after := []byte(strings.Join(data[0].after, "\n"))
+	ut.AssertEqual(t, "row 8 is out of range", c.(Updater).Update([]int{6, 8}, after).Error())
+	ut.AssertEqual(t, grid, c.String())
+	ut.AssertEqual(t, objs, getStrings(c.Objects()))
+}
+
+func TestCanvasUpdateRandom(t *testing.T) {
+	t.Parallel()
+	// Random edits of the fixture diagrams, and of random diagrams packing text against lines,
+	// are updated incrementally into the objects that the edited diagram is parsed into. Objects
+	// starting at the same point may be listed in either order.
+	const chars = "+-|+-|.'v> a"
+	r := rand.New(rand.NewSource(1))
+	var diagrams [][]string
+	for _, line := range newCanvasTests() {
+		diagrams = append(diagrams, line.input)
+	}
+	for i := 0; i < 500; i++ {
+		lines := make([]string, 6+r.Intn(4))
+		for y := range lines {
+			row := make([]byte, 5)
+			for x := range row {
+				row[x] = chars[r.Intn(len(chars))]
+			}
+			lines[y] = string(row)
+		}
+		diagrams = append(diagrams, lines)
+	}
+	sorted := func(objs []Object) []string {
+		s := getStrings(objs)
+		sort.Strings(s)
+		return s
+	}
+	for i, input := range diagrams {
+		before := strings.Join(input, "\n")
+		c, err := NewCanvas([]byte(before), 9, true)
+		ut.AssertEqualIndex(t, i, nil, err)
+		size := c.Size()
+		for k := 0; k < 20; k++ {
+			lines := append([]string(nil), input...)
+			var rows []int
+			for n := r.Intn(3) + 1; n > 0; n-- {
+				// Rows with tabs, references or wide runes are left alone, so that the edit
+				// keeps the width of the diagram.
+				y := r.Intn(size.Y)
+				if strings.ContainsAny(lines[y], "\t[") || len(lines[y]) != len([]rune(lines[y])) {
+					continue
+				}
+				row := []byte(lines[y] + strings.Repeat(" ", size.X-len(lines[y])))
+				row[r.Intn(size.X)] = chars[r.Intn(len(chars))]
+				lines[y] = string(row)
+				rows = append(rows, y)
+			}
+			after := strings.Join(lines, "\n")
+			c, err := NewCanvas([]byte(before), 9, true)
+			ut.AssertEqualIndex(t, i, nil, err)
+			if err := c.(Updater).Update(rows, []byte(after)); err != nil {
+				t.Fatalf("Test %d: error updating into %q: %s", i, after, err)
+			}
+			expected, err := NewCanvas([]byte(after), 9, true)
+			ut.AssertEqualIndex(t, i, nil, err)
+			if e, a := sorted(expected.Objects()), sorted(c.Objects()); !reflect.DeepEqual(e, a) {
+				t.Fatalf("Test %d: update of %q into %q:\nexpected: %v\nactual:   %v", i, before, after, e, a)
+			}
+		}
+	}
+}
+
+func TestObjectAt(t *testing.T) {
+	t.Parallel()
+	input := []string{
+		"+-----+",
+		"| foo |---->",
+		"+-----+",
+	}
+	c, err := NewCanvas([]byte(strings.Join(input, "\n")), 9, true)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	data := []struct {
+		p        Point
+		expected string
+	}{
+		// 0 Line cell
+		{Point{X: 9, Y: 1}, "Path{[(7,1) (8,1) (9,1) (10,1) (11,1)]}"},
+		// 1 Text cell, within a box
+		{Point{X: 3, Y: 1}, "Text{(2,1) \"foo\"}"},
+		// 2 Box cell
+		{Point{X: 0, Y: 0}, "Path{[(0,0) (1,0) (2,0) (3,0) (4,0) (5,0) (6,0) (6,1) (6,2) (5,2) (4,2) (3,2) (2,2) (1,2) (0,2) (0,1)]}"},
+		// 3 Empty cell inside the box
+		{Point{X: 1, Y: 1}, ""},
+		// 4 Empty cell outside the box
+		{Point{X: 9, Y: 0}, ""},
+	}
+	for i, line := range data {
+		actual := ""
+		if o := ObjectAt(c, line.p); o != nil {
+			actual = o.String()
+		}
+		ut.AssertEqualIndex(t, i, line.expected, actual)
+	}
+}
+
+func TestDepth(t *testing.T) {
+	t.Parallel()
+	// The "Inner boxes" diagram of TestNewCanvas.
+	input := []string{
+		"+-----+",
+		"|     |",
+		"| +-+ |",
+		"| | | |",
+		"| +-+ |",
+		"|     |",
+		"+-----+",
+	}
+	c, err := NewCanvas([]byte(strings.Join(input, "\n")), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	var depths []int
+	for _, o := range c.Objects() {
+		depths = append(depths, Depth(o))
+	}
+	ut.AssertEqual(t, []int{0, 1}, depths)
+}
+
+func TestPointsToCorners(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		in       []Point
+		expected []Point
+		closed   bool
+	}{
+		{
+			[]Point{{X: 0, Y: 0}, {X: 1, Y: 0}},
+			[]Point{{X: 0, Y: 0}, {X: 1, Y: 0}},
+			false,
+		},
+		{
+			[]Point{{X: 0, Y: 0}, {X: 1, Y: 0}, {X: 2, Y: 0}},
+			[]Point{{X: 0, Y: 0}, {X: 2, Y: 0}},
+			false,
+		},
+		{
+			[]Point{{X: 0, Y: 0}, {X: 1, Y: 0}, {X: 1, Y: 1}},
+			[]Point{{X: 0, Y: 0}, {X: 1, Y: 0}, {X: 1, Y: 1}},
+			false,
+		},
+		{
+			[]Point{
+				{X: 0, Y: 0}, {X: 1, Y: 0}, {X: 2, Y: 0}, {X: 2, Y: 1}, {X: 2, Y: 2},
+				{X: 1, Y: 2}, {X: 0, Y: 2}, {X: 0, Y: 1},
+			},
+			[]Point{{X: 0, Y: 0}, {X: 2, Y: 0}, {X: 2, Y: 2}, {X: 0, Y: 2}},
+			true,
+		},
+		{
+			[]Point{{X: 0, Y: 0}, {X: 1, Y: 0}, {X: 1, Y: 1}, {X: 0, Y: 1}},
+			[]Point{{X: 0, Y: 0}, {X: 1, Y: 0}, {X: 1, Y: 1}, {X: 0, Y: 1}},
+			// TODO(dhobsd): Unexpected; broken.
+			false,
+		},
+	}
+	for i, line := range data {
+		p, c, err := pointsToCorners(line.in)
+		ut.AssertEqualIndex(t, i, nil, err)
+		ut.AssertEqualIndex(t, i, line.expected, p)
+		ut.AssertEqualIndex(t, i, line.closed, c)
+	}
+}
+
+func TestPointsToCornersDiscontiguous(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		in  []Point
+		err string
+	}{
+		{
+			[]Point{{X: 0, Y: 0}, {X: 2, Y: 0}, {X: 3, Y: 0}},
+			"discontiguous points (0,0) and (2,0)",
+		},
+		{
+			[]Point{{X: 0, Y: 0}, {X: 1, Y: 0}, {X: 2, Y: 0}, {X: 2, Y: 1}, {X: 4, Y: 3}},
+			"discontiguous points (2,1) and (4,3)",
+		},
+	}
+	for i, line := range data {
+		_, _, err := pointsToCorners(line.in)
+		ut.AssertEqualIndex(t, i, line.err, err.Error())
+	}
+
+	// Sealing an object with such points fails rather than panics.
+	c, err := NewCanvas([]byte("----"), 9, true)
+	ut.AssertEqual(t, nil, err)
+	o := &object{points: []Point{{X: 0, Y: 0}, {X: 1, Y: 0}, {X: 3, Y: 0}}}
+	ut.AssertEqual(t, "discontiguous points (1,0) and (3,0)", o.seal(c.(*canvas)).Error())
+}
+
+func BenchmarkT(b *testing.B) {
+	data := []string{
+		"             +-----+-------+",
+		"             |     |       |",
+		"             |     |       |",
+		"        +----+-----+----   |",
 		"--------+----+-----+-------+---+",
 		"        |    |     |       |   |",
 		"        |    |     |       |   |     |   |",
@@ -649,6 +1686,14 @@ func getStrings(objs []Object) []string {
 	return out
 }
 
+func getTags(objs []Object) []string {
+	out := []string{}
+	for _, obj := range objs {
+		out = append(out, obj.Tag())
+	}
+	return out
+}
+
 func getCorners(objs []Object) [][]Point {
 	out := make([][]Point, len(objs))
 	for i, obj := range objs {
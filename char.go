@@ -7,6 +7,42 @@ import "unicode"
 
 type char rune
 
+// wide is the cell covered by the right half of a double-width rune, such as a CJK ideograph,
+// which takes two cells of the grid so that the grid lines up as the diagram is displayed.
+const wide char = -1
+
+// wideRunes are the runes displayed at double width by monospace fonts: the East Asian wide and
+// fullwidth runes, and emoji.
+var wideRunes = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{Lo: 0x1100, Hi: 0x115f, Stride: 1},
+		{Lo: 0x2e80, Hi: 0x303e, Stride: 1},
+		{Lo: 0x3041, Hi: 0x33ff, Stride: 1},
+		{Lo: 0x3400, Hi: 0x4dbf, Stride: 1},
+		{Lo: 0x4e00, Hi: 0x9fff, Stride: 1},
+		{Lo: 0xa000, Hi: 0xa4cf, Stride: 1},
+		{Lo: 0xac00, Hi: 0xd7a3, Stride: 1},
+		{Lo: 0xf900, Hi: 0xfaff, Stride: 1},
+		{Lo: 0xfe30, Hi: 0xfe4f, Stride: 1},
+		{Lo: 0xff00, Hi: 0xff60, Stride: 1},
+		{Lo: 0xffe0, Hi: 0xffe6, Stride: 1},
+	},
+	R32: []unicode.Range32{
+		{Lo: 0x1f300, Hi: 0x1f64f, Stride: 1},
+		{Lo: 0x1f900, Hi: 0x1f9ff, Stride: 1},
+		{Lo: 0x20000, Hi: 0x2fffd, Stride: 1},
+		{Lo: 0x30000, Hi: 0x3fffd, Stride: 1},
+	},
+}
+
+// runeWidth returns the number of cells taken by r.
+func runeWidth(r rune) int {
+	if unicode.Is(wideRunes, r) {
+		return 2
+	}
+	return 1
+}
+
 func (c char) isObjectStartTag() bool {
 	return c == '['
 }
@@ -15,17 +51,18 @@ func (c char) isObjectEndTag() bool {
 	return c == ']'
 }
 
-func (c char) isTagDefinitionSeparator() bool {
-	return c == ':'
-}
-
 func (c char) isTextStart() bool {
 	r := rune(c)
 	return c.isObjectStartTag() || unicode.IsLetter(r) || unicode.IsNumber(r) || unicode.IsSymbol(r)
 }
 
+// isWord returns true on the letters and digits that words are made of.
+func (c char) isWord() bool {
+	return unicode.IsLetter(rune(c)) || unicode.IsNumber(rune(c))
+}
+
 func (c char) isTextCont() bool {
-	return unicode.IsPrint(rune(c))
+	return c == wide || unicode.IsPrint(rune(c))
 }
 
 func (c char) isSpace() bool {
@@ -41,6 +78,11 @@ func (c char) isCorner() bool {
 	return c == '.' || c == '\'' || c == '+'
 }
 
+// isJunction returns true on a corner that may join more than two edges.
+func (c char) isJunction() bool {
+	return c == '+'
+}
+
 func (c char) isRoundedCorner() bool {
 	return c == '.' || c == '\''
 }
@@ -43,6 +43,7 @@ func mainImpl() error {
 	scaleY := flag.Int("y", 16, "Y grid scale in pixels.")
 	tabWidth := flag.Int("t", 8, "Tab width.")
 	doLogo := flag.Bool("L", false, "Generate SVG of the a2s logo.")
+	format := flag.String("format", "svg", "Output format: svg, html, preview (a rough SVG preview), debug (an SVG of the parsed objects), mermaid (a Mermaid flowchart), index (an HTML list of the tagged objects), png, or pdf.")
 	flag.Parse()
 
 	var input []byte
@@ -64,12 +65,38 @@ func mainImpl() error {
 	if err != nil {
 		return err
 	}
-	svg := asciitosvg.CanvasToSVG(canvas, *noBlur, *font, *scaleX, *scaleY)
+	output, err := render(canvas, *format, asciitosvg.RenderOptions{NoBlur: *noBlur, Font: *font, ScaleX: *scaleX, ScaleY: *scaleY})
+	if err != nil {
+		return err
+	}
 	if *out == "-" {
-		_, err := os.Stdout.Write(svg)
+		_, err := os.Stdout.Write(output)
 		return err
 	}
-	return ioutil.WriteFile(*out, svg, 0666)
+	return ioutil.WriteFile(*out, output, 0666)
+}
+
+// render renders canvas in the output format.
+func render(canvas asciitosvg.Canvas, format string, opts asciitosvg.RenderOptions) ([]byte, error) {
+	switch format {
+	case "svg":
+		return asciitosvg.CanvasToSVGWithOptions(canvas, opts), nil
+	case "html":
+		return asciitosvg.CanvasToHTML(canvas, opts), nil
+	case "preview":
+		return asciitosvg.CanvasToPreviewSVG(canvas, opts.ScaleX, opts.ScaleY), nil
+	case "debug":
+		return asciitosvg.CanvasToDebugSVG(canvas, opts.ScaleX, opts.ScaleY), nil
+	case "mermaid":
+		return asciitosvg.CanvasToMermaid(canvas)
+	case "index":
+		return asciitosvg.CanvasToIndex(canvas), nil
+	case "png":
+		return asciitosvg.CanvasToPNG(canvas, opts)
+	case "pdf":
+		return asciitosvg.CanvasToPDF(canvas, opts)
+	}
+	return nil, fmt.Errorf("unsupported output format %q", format)
 }
 
 func main() {
@@ -0,0 +1,44 @@
+// Copyright 2012 - 2018 The ASCIIToSVG Contributors
+// All rights reserved.
+
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/asciitosvg/asciitosvg"
+	"github.com/maruel/ut"
+)
+
+func TestRender(t *testing.T) {
+	t.Parallel()
+	canvas, err := asciitosvg.NewCanvas([]byte(logo), 8, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	data := []struct {
+		format string
+		prefix string
+		err    string
+	}{
+		{"svg", "<!DOCTYPE svg", ""},
+		{"html", "<!DOCTYPE html>", ""},
+		{"preview", "<!DOCTYPE svg", ""},
+		{"debug", "<!DOCTYPE svg", ""},
+		{"mermaid", "flowchart LR\n", ""},
+		{"index", "<ul class=\"a2s-index\">\n", ""},
+		{"png", "\x89PNG\r\n", ""},
+		{"pdf", "%PDF-1.4\n", ""},
+		{"gif", "", "unsupported output format \"gif\""},
+	}
+	for i, line := range data {
+		output, err := render(canvas, line.format, asciitosvg.RenderOptions{ScaleX: 9, ScaleY: 16})
+		actual := ""
+		if err != nil {
+			actual = err.Error()
+		}
+		ut.AssertEqualIndex(t, i, line.err, actual)
+		ut.AssertEqualIndex(t, i, true, bytes.HasPrefix(output, []byte(line.prefix)))
+	}
+}
@@ -27,6 +27,10 @@ func TestParseHexColor(t *testing.T) {
 		{"#FFG", nil, true},
 		{"#fffffg", nil, true},
 		{"#FFFFFG", nil, true},
+		{"red", []int{255, 0, 0}, false},
+		{"DarkSlateGray", []int{47, 79, 79}, false},
+		{"chartruese", nil, true},
+		{"", nil, true},
 	}
 
 	for i, v := range data {
@@ -45,3 +49,44 @@ func TestParseHexColor(t *testing.T) {
 		}
 	}
 }
+
+func TestTextColor(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		color         string
+		minBrightness int
+		minDifference int
+		expected      string
+	}{
+		{"#fff", 125, 500, "#000"},
+		{"#000", 125, 500, "#fff"},
+		{"#888", 125, 500, "#000"},
+		{"#888", 150, 500, "#fff"},
+		{"#888", 150, 400, "#000"},
+	}
+	for i, v := range data {
+		actual, err := textColor(v.color, v.minBrightness, v.minDifference)
+		ut.AssertEqualIndex(t, i, nil, err)
+		ut.AssertEqualIndex(t, i, v.expected, actual)
+	}
+}
+
+func TestIsValidColor(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		color    string
+		expected bool
+	}{
+		{"#abc", true},
+		{"navy", true},
+		{"none", true},
+		{"url(#gradient)", true},
+		{"rgb(0, 128, 255)", true},
+		{"chartruese", false},
+		{"#abcd", false},
+		{"url(#gradient", false},
+	}
+	for i, v := range data {
+		ut.AssertEqualIndex(t, i, v.expected, isValidColor(v.color))
+	}
+}
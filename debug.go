@@ -0,0 +1,65 @@
+// Copyright 2012 - 2018 The ASCIIToSVG Contributors
+// All rights reserved.
+
+package asciitosvg
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+const (
+	debugVisitedFill   = "#9c9"
+	debugUnvisitedFill = "#eee"
+
+	debugCellTag = "    <rect x=\"%d\" y=\"%d\" width=\"%d\" height=\"%d\" fill=\"%s\" />\n"
+	debugCharTag = "    <text x=\"%s\" y=\"%s\">%s</text>\n"
+)
+
+// CanvasToDebugSVG renders the grid underlying the supplied asciitosvg.Canvas, shading each cell by
+// whether the parser consumed it as part of an object. Cells consumed by the parser are green,
+// and all others are gray. The characters of the grid are drawn on top of the cells. This is
+// useful for figuring out why a diagram isn't rendered as expected. The output has the same
+// dimensions as that of CanvasToSVG for the same scale.
+func CanvasToDebugSVG(c Canvas, scaleX, scaleY int) []byte {
+	pr := newProjection(RenderOptions{ScaleX: scaleX, ScaleY: scaleY})
+
+	// Only our own Canvas implementation knows which cells were visited.
+	cv, _ := c.(*canvas)
+
+	b := &bytes.Buffer{}
+	io.WriteString(b, header)
+	writeWatermark(b, RenderOptions{})
+	writeSVGTag(b, pr, RenderOptions{}, (c.Size().X+1)*pr.scaleX, (c.Size().Y+1)*pr.scaleY)
+
+	io.WriteString(b, "  <g id=\"cells\" stroke=\"#fff\" stroke-width=\"1\">\n")
+	for y := 0; y < c.Size().Y; y++ {
+		for x := 0; x < c.Size().X; x++ {
+			fill := debugUnvisitedFill
+			if cv != nil && cv.isVisited(Point{X: x, Y: y}) {
+				fill = debugVisitedFill
+			}
+			fmt.Fprintf(b, debugCellTag, x*pr.scaleX, y*pr.scaleY, pr.scaleX, pr.scaleY, fill)
+		}
+	}
+	io.WriteString(b, "  </g>\n")
+
+	if cv != nil {
+		fmt.Fprintf(b, "  <g id=\"chars\" stroke=\"none\" fill=\"#000\" text-anchor=\"middle\" style=\"font-family:%s;font-size:%dpx\">\n", escape(defaultFont), pr.scaleY*3/4)
+		for y := 0; y < cv.size.Y; y++ {
+			for x := 0; x < cv.size.X; x++ {
+				p := Point{X: x, Y: y}
+				// The right half of a double-width rune is drawn by the rune itself.
+				if ch := cv.at(p); !ch.isSpace() && ch != wide {
+					sp := pr.scale(p)
+					fmt.Fprintf(b, debugCharTag, pr.f(sp.X), pr.f(sp.Y+float64(pr.scaleY)/4), escape(string(ch)))
+				}
+			}
+		}
+		io.WriteString(b, "  </g>\n")
+	}
+
+	io.WriteString(b, "</svg>\n")
+	return b.Bytes()
+}
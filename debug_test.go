@@ -0,0 +1,40 @@
+// Copyright 2012 - 2018 The ASCIIToSVG Contributors
+// All rights reserved.
+
+package asciitosvg
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/maruel/ut"
+)
+
+func TestCanvasToDebugSVG(t *testing.T) {
+	t.Parallel()
+	input := []string{
+		"+--+",
+		"|Hi|  -",
+		"+--+",
+	}
+	c, err := NewCanvas([]byte(strings.Join(input, "\n")), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	actual := string(CanvasToDebugSVG(c, 9, 16))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<!-- "+defaultWatermark+" -->\n<svg "))
+	ut.AssertEqual(t, 7*3, strings.Count(actual, "<rect "))
+	// The box and its text are visited. The lone dash and the blank cells are not.
+	ut.AssertEqual(t, 12, strings.Count(actual, "fill=\""+debugVisitedFill+"\""))
+	ut.AssertEqual(t, 9, strings.Count(actual, "fill=\""+debugUnvisitedFill+"\""))
+	ut.AssertEqual(t, 13, strings.Count(actual, "<text "))
+
+	// Double-width runes are drawn once, over their first cell.
+	c, err = NewCanvas([]byte("日本"), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	actual = string(CanvasToDebugSVG(c, 9, 16))
+	ut.AssertEqual(t, 2, strings.Count(actual, "<text "))
+	ut.AssertEqual(t, false, strings.Contains(actual, "\ufffd"))
+}
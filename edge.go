@@ -0,0 +1,128 @@
+// Copyright 2012 - 2018 The ASCIIToSVG Contributors
+// All rights reserved.
+
+package asciitosvg
+
+import "image"
+
+// An edge is an arrow between two boxes, interrupted by its label, as in "|A|--label-->|B|". It
+// is made of the line before the label, its tail, and the line after it, its head.
+type edge struct {
+	tail, head int
+	label      int
+	// from and to are the ends of the edge. An end with a marker stays next to the wall of its
+	// box, so that the marker touches it, while an end without one is moved onto the wall.
+	from, to Point
+	// src and dst are the boxes at the start and the end of the edge.
+	src, dst int
+}
+
+// points returns the points of e along its tail and its head, from its start to its end, with the
+// hints of the cells they are found on, so that its solid and dashed segments can be told apart.
+// The segment across its label joins the tail and the head.
+func (e edge) points(c Canvas) []Point {
+	tail, head := FullPoints(c.Objects()[e.tail]), FullPoints(c.Objects()[e.head])
+	var out []Point
+	if e.from.X != tail[0].X {
+		out = append(out, e.from)
+	}
+	out = append(out, tail...)
+	out = append(out, head...)
+	if e.to.X != head[len(head)-1].X {
+		out = append(out, e.to)
+	}
+	return out
+}
+
+// boxWalls returns the index of the box owning each cell of the walls of the boxes of c for which
+// keep returns true.
+func boxWalls(c Canvas, keep func(Object) bool) map[image.Point]int {
+	walls := map[image.Point]int{}
+	for i, o := range c.Objects() {
+		if o.IsClosed() && !o.IsText() && keep(o) {
+			for _, p := range FullPoints(o) {
+				walls[image.Point{X: p.X, Y: p.Y}] = i
+			}
+		}
+	}
+	return walls
+}
+
+// endBox returns the box of walls that the end of a line is on, or stops next to as it continues
+// straight into its wall from the point prev before the end.
+func endBox(walls map[image.Point]int, end, prev Point) (int, bool) {
+	if i, ok := walls[image.Point{X: end.X, Y: end.Y}]; ok {
+		return i, true
+	}
+	if next, ok := beyond(end, prev); ok {
+		if i, ok := walls[next]; ok {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// findEdges returns the edges of the objects of c for which keep returns true: straight
+// horizontal lines on either side of a text, separated from it by at most one space, that
+// connect two different boxes with a marker on at least one end.
+func findEdges(c Canvas, keep func(Object) bool) []edge {
+	objs := c.Objects()
+	walls := boxWalls(c, keep)
+	starts, ends := map[image.Point]int{}, map[image.Point]int{}
+	for i, o := range objs {
+		if o.IsText() || o.IsClosed() || !keep(o) {
+			continue
+		}
+		if Bounds(o).Dy() == 1 {
+			points := o.Points()
+			first, last := points[0], points[len(points)-1]
+			starts[image.Point{X: first.X, Y: first.Y}] = i
+			ends[image.Point{X: last.X, Y: last.Y}] = i
+		}
+	}
+
+	// neighbor returns the line with an end in lines on row y, at most two cells from x in the
+	// direction dx.
+	neighbor := func(lines map[image.Point]int, x, y, dx int) (int, bool) {
+		for gap := 1; gap <= 2; gap++ {
+			if i, ok := lines[image.Point{X: x + gap*dx, Y: y}]; ok {
+				return i, true
+			}
+		}
+		return 0, false
+	}
+
+	var out []edge
+	for i, t := range objs {
+		if !t.IsText() || IsReference(t) || !keep(t) {
+			continue
+		}
+		r := Bounds(t)
+		tail, ok := neighbor(ends, r.Min.X, r.Min.Y, -1)
+		if !ok {
+			continue
+		}
+		head, ok := neighbor(starts, r.Max.X-1, r.Min.Y, 1)
+		if !ok {
+			continue
+		}
+		tp, hp := objs[tail].Points(), objs[head].Points()
+		from, to := tp[0], hp[len(hp)-1]
+		src, ok := walls[image.Point{X: from.X - 1, Y: from.Y}]
+		if !ok {
+			continue
+		}
+		dst, ok := walls[image.Point{X: to.X + 1, Y: to.Y}]
+		if !ok || src == dst || (from.Hint != StartMarker && to.Hint != EndMarker) {
+			continue
+		}
+		if from.Hint != StartMarker {
+			from = Point{X: from.X - 1, Y: from.Y}
+		}
+		if to.Hint != EndMarker {
+			to = Point{X: to.X + 1, Y: to.Y}
+		}
+		out = append(out, edge{tail: tail, head: head, label: i, from: from, to: to, src: src, dst: dst})
+	}
+	return out
+}
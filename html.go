@@ -0,0 +1,44 @@
+// Copyright 2012 - 2018 The ASCIIToSVG Contributors
+// All rights reserved.
+
+package asciitosvg
+
+import (
+	"bytes"
+	"fmt"
+)
+
+const (
+	htmlHeader     = "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n"
+	htmlStylesheet = "<link rel=\"stylesheet\" href=\"%s\">\n"
+	htmlBody       = "</head>\n<body>\n<div class=\"a2s\">\n"
+	htmlFooter     = "</div>\n</body>\n</html>\n"
+
+	// defaultTitle is the title of HTML documents of diagrams without a caption.
+	defaultTitle = "ASCIItoSVG"
+)
+
+// CanvasToHTML renders the supplied asciitosvg.Canvas to a minimal HTML document embedding the SVG
+// rendered by CanvasToSVGWithOptions, so that it can be previewed in a browser. The document is
+// titled after the a2s:caption option of the diagram, and links the stylesheet of opts, if any.
+func CanvasToHTML(c Canvas, opts RenderOptions) []byte {
+	svg := CanvasToSVGWithOptions(c, opts)
+	// The doctype and processing instructions of the SVG document are invalid within HTML.
+	if i := bytes.Index(svg, []byte("<svg ")); i >= 0 {
+		svg = svg[i:]
+	}
+
+	title, _ := c.Options()[diagramTag]["a2s:caption"].(string)
+	if title == "" {
+		title = defaultTitle
+	}
+	b := &bytes.Buffer{}
+	fmt.Fprintf(b, htmlHeader, escape(title))
+	if opts.Stylesheet != "" {
+		fmt.Fprintf(b, htmlStylesheet, escape(opts.Stylesheet))
+	}
+	b.WriteString(htmlBody)
+	b.Write(svg)
+	b.WriteString(htmlFooter)
+	return b.Bytes()
+}
@@ -0,0 +1,50 @@
+// Copyright 2012 - 2018 The ASCIIToSVG Contributors
+// All rights reserved.
+
+package asciitosvg
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/maruel/ut"
+)
+
+func TestCanvasToHTML(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		input    []string
+		opts     RenderOptions
+		expected []string
+	}{
+		// 0 Default title
+		{
+			[]string{"+--+", "|  |", "+--+"},
+			RenderOptions{},
+			[]string{"<title>ASCIItoSVG</title>\n</head>\n<body>\n<div class=\"a2s\">\n<svg width=\"45px\" height=\"64px\" version="},
+		},
+		// 1 Caption as title, with a stylesheet
+		{
+			[]string{"+--+", "|  |", "+--+", "", "[a2s]: {\"a2s:caption\":\"A & B\"}"},
+			RenderOptions{Stylesheet: "a2s.css"},
+			[]string{"<title>A &amp; B</title>\n<link rel=\"stylesheet\" href=\"a2s.css\">\n</head>\n"},
+		},
+	}
+	for i, line := range data {
+		canvas, err := NewCanvas([]byte(strings.Join(line.input, "\n")), 9, false)
+		if err != nil {
+			t.Fatalf("Test %d: error creating canvas: %s", i, err)
+		}
+		actual := string(CanvasToHTML(canvas, line.opts))
+		ut.AssertEqualIndex(t, i, true, strings.HasPrefix(actual, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n"))
+		ut.AssertEqualIndex(t, i, true, strings.HasSuffix(actual, "</svg>\n</div>\n</body>\n</html>\n"))
+		// The SVG is embedded without its own doctype and processing instructions.
+		ut.AssertEqualIndex(t, i, 1, strings.Count(actual, "<!DOCTYPE"))
+		ut.AssertEqualIndex(t, i, false, strings.Contains(actual, "<?xml"))
+		svg := string(CanvasToSVGWithOptions(canvas, line.opts))
+		ut.AssertEqualIndex(t, i, true, strings.Contains(actual, svg[strings.Index(svg, "<svg "):]))
+		for _, e := range line.expected {
+			ut.AssertEqualIndex(t, i, true, strings.Contains(actual, e))
+		}
+	}
+}
@@ -0,0 +1,38 @@
+// Copyright 2012 - 2018 The ASCIIToSVG Contributors
+// All rights reserved.
+
+package asciitosvg
+
+import (
+	"bytes"
+	"fmt"
+)
+
+const (
+	indexHeader = "<ul class=\"a2s-index\">\n"
+	indexEntry  = "  <li><a href=\"#%s\">%s</a>%s</li>\n"
+	indexLabel  = " %s"
+	indexFooter = "</ul>\n"
+)
+
+// CanvasToIndex renders an index of the tagged objects of the supplied asciitosvg.Canvas, as an HTML
+// list to publish alongside its SVG render. Each entry links the tag of an object to the element
+// of the object in the SVG, by its id, e.g. "#closed0", followed by its label: its a2s:label
+// option, or else the text directly within it. Objects are listed in reading order, and the
+// list is empty if none are tagged.
+func CanvasToIndex(c Canvas) []byte {
+	b := &bytes.Buffer{}
+	b.WriteString(indexHeader)
+	for i, o := range c.Objects() {
+		if o.Tag() == "" || IsReference(o) {
+			continue
+		}
+		label := boxLabel(c, o)
+		if label != "" {
+			label = fmt.Sprintf(indexLabel, escape(label))
+		}
+		fmt.Fprintf(b, indexEntry, objectID(i, o), escape(o.Tag()), label)
+	}
+	b.WriteString(indexFooter)
+	return b.Bytes()
+}
@@ -0,0 +1,58 @@
+// Copyright 2012 - 2018 The ASCIIToSVG Contributors
+// All rights reserved.
+
+package asciitosvg
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/maruel/ut"
+)
+
+func TestCanvasToIndex(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		input    []string
+		expected []string
+	}{
+		// 0 Tagged boxes, by their text or their label, and an untagged box
+		{
+			[]string{
+				"+----------+  +-----+  +---+",
+				"|[db]      |  |[q]  |  |   |",
+				"| Users &  |  +-----+  +---+",
+				"| Accounts |",
+				"+----------+",
+				"",
+				"[db]: {\"fill\":\"#eee\"}",
+				"[q]: {\"a2s:label\":\"Job queue\"}",
+			},
+			[]string{
+				"<ul class=\"a2s-index\">",
+				"  <li><a href=\"#closed0\">db</a> Users &amp; Accounts</li>",
+				"  <li><a href=\"#closed1\">q</a> Job queue</li>",
+				"</ul>",
+			},
+		},
+		// 1 No tagged objects
+		{
+			[]string{
+				"+---+",
+				"|   |",
+				"+---+",
+			},
+			[]string{
+				"<ul class=\"a2s-index\">",
+				"</ul>",
+			},
+		},
+	}
+	for i, line := range data {
+		c, err := NewCanvas([]byte(strings.Join(line.input, "\n")), 9, false)
+		if err != nil {
+			t.Fatalf("Test %d: error creating canvas: %s", i, err)
+		}
+		ut.AssertEqualIndex(t, i, strings.Join(line.expected, "\n")+"\n", string(CanvasToIndex(c)))
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2012 - 2018 The ASCIIToSVG Contributors
+// All rights reserved.
+
+package asciitosvg
+
+import (
+	"image"
+	"sort"
+)
+
+// A Lane is a region of a diagram partitioned by divider lines spanning the full height or width
+// of the diagram, as in swimlane diagrams.
+type Lane struct {
+	// Name is the text at the top of the lane, if any.
+	Name string
+	// Bounds are the grid cells of the lane, excluding its dividers.
+	Bounds image.Rectangle
+}
+
+// Lanes returns the lanes into which the diagram of c is partitioned by divider lines, from left to
+// right when it has vertical dividers, or from top to bottom when it only has horizontal dividers.
+// A canvas without dividers has no lanes.
+func Lanes(c Canvas) []Lane {
+	objs := c.Objects()
+	var content image.Rectangle
+	for _, o := range objs {
+		content = content.Union(Bounds(o))
+	}
+
+	// Dividers are straight lines across the content, identified by their position on the
+	// other axis. A divider crossed by other lines may be split at the junctions, so the straight
+	// segments of each column or row are joined where they meet before being measured.
+	columns, rows := map[int][]image.Rectangle{}, map[int][]image.Rectangle{}
+	for _, o := range objs {
+		if o.IsText() || o.IsClosed() {
+			continue
+		}
+		if r := Bounds(o); r.Dx() == 1 {
+			columns[r.Min.X] = append(columns[r.Min.X], r)
+		} else if r.Dy() == 1 {
+			rows[r.Min.Y] = append(rows[r.Min.Y], r)
+		}
+	}
+	var vertical, horizontal []int
+	for x, segments := range columns {
+		for _, r := range joinSegments(segments, func(r image.Rectangle) (int, int) { return r.Min.Y, r.Max.Y }) {
+			if r.Min.Y == content.Min.Y && r.Max.Y == content.Max.Y {
+				vertical = append(vertical, x)
+			}
+		}
+	}
+	for y, segments := range rows {
+		for _, r := range joinSegments(segments, func(r image.Rectangle) (int, int) { return r.Min.X, r.Max.X }) {
+			if r.Min.X == content.Min.X && r.Max.X == content.Max.X {
+				horizontal = append(horizontal, y)
+			}
+		}
+	}
+
+	var lanes []Lane
+	if len(vertical) != 0 {
+		sort.Ints(vertical)
+		start := content.Min.X
+		for _, x := range append(vertical, content.Max.X) {
+			lanes = append(lanes, Lane{Bounds: image.Rect(start, content.Min.Y, x, content.Max.Y)})
+			start = x + 1
+		}
+	} else if len(horizontal) != 0 {
+		sort.Ints(horizontal)
+		start := content.Min.Y
+		for _, y := range append(horizontal, content.Max.Y) {
+			lanes = append(lanes, Lane{Bounds: image.Rect(content.Min.X, start, content.Max.X, y)})
+			start = y + 1
+		}
+	}
+
+	// Lanes without any room, such as before a divider on the edge of the content, are dropped.
+	out := lanes[:0]
+	for _, l := range lanes {
+		if l.Bounds.Empty() {
+			continue
+		}
+		// Objects are sorted with text last, from top to bottom then left to right.
+		for _, o := range objs {
+			if o.IsText() && Bounds(o).In(l.Bounds) {
+				l.Name = string(o.Text())
+				break
+			}
+		}
+		out = append(out, l)
+	}
+	return out
+}
+
+// joinSegments returns the unions of the segments of a single column or row that overlap or touch,
+// given span, which returns the extent of a segment along the column or row.
+func joinSegments(segments []image.Rectangle, span func(image.Rectangle) (int, int)) []image.Rectangle {
+	sort.Slice(segments, func(i, j int) bool {
+		a, _ := span(segments[i])
+		b, _ := span(segments[j])
+		return a < b
+	})
+	var out []image.Rectangle
+	for _, r := range segments {
+		start, _ := span(r)
+		if n := len(out); n != 0 {
+			if _, end := span(out[n-1]); start <= end {
+				out[n-1] = out[n-1].Union(r)
+				continue
+			}
+		}
+		out = append(out, r)
+	}
+	return out
+}
@@ -0,0 +1,84 @@
+// Copyright 2012 - 2018 The ASCIIToSVG Contributors
+// All rights reserved.
+
+package asciitosvg
+
+import (
+	"image"
+	"strings"
+	"testing"
+
+	"github.com/maruel/ut"
+)
+
+func TestLanes(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		input []string
+		lanes []Lane
+	}{
+		// 0 No dividers
+		{
+			[]string{
+				"+--+",
+				"|  |",
+				"+--+",
+			},
+			nil,
+		},
+
+		// 1 Two lanes separated by a vertical divider
+		{
+			[]string{
+				"Client   | Server",
+				"         |",
+				"+----+   |   +----+",
+				"| ui |---+-->| db |",
+				"+----+   |   +----+",
+			},
+			[]Lane{
+				{Name: "Client", Bounds: image.Rect(0, 0, 9, 5)},
+				{Name: "Server", Bounds: image.Rect(10, 0, 19, 5)},
+			},
+		},
+
+		// 2 Two lanes separated by a horizontal divider
+		{
+			[]string{
+				"Front",
+				"----------",
+				"Back",
+			},
+			[]Lane{
+				{Name: "Front", Bounds: image.Rect(0, 0, 10, 1)},
+				{Name: "Back", Bounds: image.Rect(0, 2, 10, 3)},
+			},
+		},
+	}
+	for i, line := range data {
+		c, err := NewCanvas([]byte(strings.Join(line.input, "\n")), 9, false)
+		if err != nil {
+			t.Fatalf("Test %d: error creating canvas: %s", i, err)
+		}
+		ut.AssertEqualIndex(t, i, line.lanes, Lanes(c))
+	}
+}
+
+func TestCanvasToSVGShadeLanes(t *testing.T) {
+	t.Parallel()
+	input := []string{
+		"a | b | c",
+		"  |   |",
+	}
+	c, err := NewCanvas([]byte(strings.Join(input, "\n")), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	actual := string(CanvasToSVGWithOptions(c, RenderOptions{ShadeLanes: true}))
+	ut.AssertEqual(t, 2, strings.Count(actual, "<rect id=\"lane"))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<rect id=\"lane0\" x=\"-4.5\" y=\"-8\" width=\"27\" height=\"48\" />"))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<rect id=\"lane2\" "))
+
+	actual = string(CanvasToSVG(c, false, "", 9, 16))
+	ut.AssertEqual(t, false, strings.Contains(actual, "lane"))
+}
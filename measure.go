@@ -0,0 +1,33 @@
+// Copyright 2012 - 2018 The ASCIIToSVG Contributors
+// All rights reserved.
+
+package asciitosvg
+
+import "image"
+
+// A Layout is the size and placement of a rendered Canvas, in pixels.
+type Layout struct {
+	// Width and Height are the size of the output.
+	Width, Height int
+	// Bounds are the rectangles covered by the grid cells of each object, in the order of the
+	// objects of the Canvas.
+	Bounds []image.Rectangle
+}
+
+// Measure returns the layout of the supplied asciitosvg.Canvas as rendered by CanvasToSVG with
+// the same scale, without rendering it. A scale of zero uses the default scale.
+func Measure(c Canvas, scaleX, scaleY int) Layout {
+	pr := newProjection(RenderOptions{ScaleX: scaleX, ScaleY: scaleY})
+	l := Layout{
+		Width:  (c.Size().X + 1) * pr.scaleX,
+		Height: (c.Size().Y + 1) * pr.scaleY,
+	}
+	if caption, _ := c.Options()[diagramTag]["a2s:caption"].(string); caption != "" {
+		l.Height += pr.scaleY * 2
+	}
+	for _, o := range c.Objects() {
+		r := Bounds(o)
+		l.Bounds = append(l.Bounds, image.Rect(r.Min.X*pr.scaleX, r.Min.Y*pr.scaleY, r.Max.X*pr.scaleX, r.Max.Y*pr.scaleY))
+	}
+	return l
+}
@@ -0,0 +1,61 @@
+// Copyright 2012 - 2018 The ASCIIToSVG Contributors
+// All rights reserved.
+
+package asciitosvg
+
+import (
+	"fmt"
+	"image"
+	"strings"
+	"testing"
+
+	"github.com/maruel/ut"
+)
+
+func TestMeasure(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		input          []string
+		scaleX, scaleY int
+		width, height  int
+		bounds         []image.Rectangle
+	}{
+		// 0 Box and line
+		{
+			[]string{
+				"+--+",
+				"|  |--->",
+				"+--+",
+			},
+			9, 16,
+			81, 64,
+			[]image.Rectangle{image.Rect(0, 0, 36, 48), image.Rect(36, 16, 72, 32)},
+		},
+		// 1 Default scale, with a caption
+		{
+			[]string{
+				"+--+",
+				"|Hi|",
+				"+--+",
+				"",
+				"[a2s]: {\"a2s:caption\":\"Figure 1\"}",
+			},
+			0, 0,
+			45, 128,
+			[]image.Rectangle{image.Rect(0, 0, 36, 48), image.Rect(9, 16, 27, 32)},
+		},
+	}
+	for i, line := range data {
+		canvas, err := NewCanvas([]byte(strings.Join(line.input, "\n")), 9, false)
+		if err != nil {
+			t.Fatalf("Test %d: error creating canvas: %s", i, err)
+		}
+		l := Measure(canvas, line.scaleX, line.scaleY)
+		ut.AssertEqualIndex(t, i, line.width, l.Width)
+		ut.AssertEqualIndex(t, i, line.height, l.Height)
+		ut.AssertEqualIndex(t, i, line.bounds, l.Bounds)
+
+		svg := string(CanvasToSVG(canvas, false, "", line.scaleX, line.scaleY))
+		ut.AssertEqualIndex(t, i, true, strings.Contains(svg, fmt.Sprintf("<svg width=\"%dpx\" height=\"%dpx\"", l.Width, l.Height)))
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2012 - 2018 The ASCIIToSVG Contributors
+// All rights reserved.
+
+package asciitosvg
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// A link is a line connecting two boxes of a diagram, from the box at its start to the box at
+// its end, given by their index in the objects of the Canvas.
+type link struct {
+	from, to               int
+	startMarker, endMarker bool
+	// label is the text interrupting the line, if it is an edge.
+	label string
+}
+
+// findLinks returns the links of c: its edges, as found by findEdges, and its other lines whose
+// ends are both on the wall of a box, or stop next to it, each a different one.
+func findLinks(c Canvas) []link {
+	all := func(Object) bool { return true }
+	objs := c.Objects()
+	edges := map[int]edge{}
+	heads := map[int]bool{}
+	for _, e := range findEdges(c, all) {
+		edges[e.tail] = e
+		heads[e.head] = true
+	}
+	walls := boxWalls(c, all)
+
+	var out []link
+	for i, o := range objs {
+		if o.IsClosed() || o.IsText() || heads[i] {
+			continue
+		}
+		if e, ok := edges[i]; ok {
+			out = append(out, link{from: e.src, to: e.dst, startMarker: e.from.Hint == StartMarker, endMarker: e.to.Hint == EndMarker, label: string(objs[e.label].Text())})
+			continue
+		}
+		points := FullPoints(o)
+		n := len(points)
+		if n < 2 {
+			continue
+		}
+		from, ok := endBox(walls, points[0], points[1])
+		if !ok {
+			continue
+		}
+		to, ok := endBox(walls, points[n-1], points[n-2])
+		if !ok || from == to {
+			continue
+		}
+		out = append(out, link{from: from, to: to, startMarker: points[0].Hint == StartMarker, endMarker: points[n-1].Hint == EndMarker})
+	}
+	return out
+}
+
+// boxLabel returns the label of a box: its a2s:label option, or else the text directly within it,
+// in reading order, without the references tagging it.
+func boxLabel(c Canvas, o Object) string {
+	if label, ok := c.Options()[o.Tag()]["a2s:label"].(string); ok {
+		return label
+	}
+	var words []string
+	for _, t := range innerTexts(c, o) {
+		if !IsReference(t) {
+			words = append(words, string(t.Text()))
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// mermaidArrows maps whether a link has a start and an end marker to the Mermaid link drawn for it.
+// Mermaid has no link with only a start marker, so those links are reversed before being looked up.
+var mermaidArrows = map[[2]bool]string{
+	{false, false}: "---",
+	{false, true}:  "-->",
+	{true, true}:   "<-->",
+}
+
+// mermaidEscape escapes the quotes of a label, which would end it; Mermaid escapes them as
+// entities.
+func mermaidEscape(label string) string {
+	return strings.Replace(label, "\"", "#quot;", -1)
+}
+
+// CanvasToMermaid exports the supplied asciitosvg.Canvas as a Mermaid flowchart, for documentation
+// maintained in Mermaid. The boxes of the diagram become nodes, labeled by the text within them,
+// and the lines connecting two boxes become links, with arrowheads where the lines have markers and
+// the text of the lines interrupted by a label, as in "|A|--label-->|B|".
+// The nodes are identified like the objects of an SVG render, e.g. "closed0". It fails if the
+// diagram has no boxes.
+func CanvasToMermaid(c Canvas) ([]byte, error) {
+	b := &bytes.Buffer{}
+	b.WriteString("flowchart LR\n")
+	nodes := 0
+	for i, o := range c.Objects() {
+		if !o.IsClosed() || o.IsText() {
+			continue
+		}
+		label := boxLabel(c, o)
+		if label == "" {
+			label = " "
+		}
+		fmt.Fprintf(b, "    %s[\"%s\"]\n", objectID(i, o), mermaidEscape(label))
+		nodes++
+	}
+	if nodes == 0 {
+		return nil, fmt.Errorf("diagram has no boxes to export")
+	}
+	objs := c.Objects()
+	for _, l := range findLinks(c) {
+		if l.startMarker && !l.endMarker {
+			l.from, l.to, l.startMarker, l.endMarker = l.to, l.from, false, true
+		}
+		arrow := mermaidArrows[[2]bool{l.startMarker, l.endMarker}]
+		if l.label != "" {
+			arrow += "|\"" + mermaidEscape(l.label) + "\"|"
+		}
+		fmt.Fprintf(b, "    %s %s %s\n", objectID(l.from, objs[l.from]), arrow, objectID(l.to, objs[l.to]))
+	}
+	return b.Bytes(), nil
+}
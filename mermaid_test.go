@@ -0,0 +1,85 @@
+// Copyright 2012 - 2018 The ASCIIToSVG Contributors
+// All rights reserved.
+
+package asciitosvg
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/maruel/ut"
+)
+
+func TestCanvasToMermaid(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		input    []string
+		expected []string
+	}{
+		// 0 Two boxes and an arrow
+		{
+			[]string{
+				"+--------+     +--------+",
+				"| Client |---->| Server |",
+				"+--------+     +--------+",
+			},
+			[]string{
+				"flowchart LR",
+				"    closed0[\"Client\"]",
+				"    closed1[\"Server\"]",
+				"    closed0 --> closed1",
+			},
+		},
+		// 1 Arrow pointing back, line without markers, and a line to nowhere
+		{
+			[]string{
+				"+---+      +---+",
+				"| A |<-----| B |----",
+				"+---+      +---+",
+				"  |",
+				"  |",
+				"+-----+",
+				"| a\"b |",
+				"+-----+",
+			},
+			[]string{
+				"flowchart LR",
+				"    closed0[\"A\"]",
+				"    closed1[\"B\"]",
+				"    closed5[\"a#quot;b\"]",
+				"    closed1 --> closed0",
+				"    closed0 --- closed5",
+			},
+		},
+		// 2 Arrow interrupted by its label
+		{
+			[]string{
+				"+---+          +---+",
+				"| A |-- yes -->| B |",
+				"+---+          +---+",
+			},
+			[]string{
+				"flowchart LR",
+				"    closed0[\"A\"]",
+				"    closed1[\"B\"]",
+				"    closed0 -->|\"yes\"| closed1",
+			},
+		},
+	}
+	for i, line := range data {
+		canvas, err := NewCanvas([]byte(strings.Join(line.input, "\n")), 9, false)
+		if err != nil {
+			t.Fatalf("Test %d: error creating canvas: %s", i, err)
+		}
+		actual, err := CanvasToMermaid(canvas)
+		ut.AssertEqualIndex(t, i, nil, err)
+		ut.AssertEqualIndex(t, i, strings.Join(line.expected, "\n")+"\n", string(actual))
+	}
+
+	canvas, err := NewCanvas([]byte("---->"), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	_, err = CanvasToMermaid(canvas)
+	ut.AssertEqual(t, "diagram has no boxes to export", err.Error())
+}
@@ -3,13 +3,18 @@
 
 package asciitosvg
 
-import "fmt"
+import (
+	"fmt"
+	"image"
+)
 
 // Object is an interface for working with open paths (lines), closed paths (polygons), or text.
 type Object interface {
 	fmt.Stringer
 	// Points returns all the points occupied by this Object. Every object has at least one point,
-	// and all points are both in-order and contiguous.
+	// and all points are both in-order and contiguous. If the Canvas was parsed with the Simplify
+	// option, the points of paths are limited to their ends, their corners, and the points with a
+	// rendering hint, and are only contiguous along straight lines.
 	Points() []Point
 	// HasPoint returns true if the object contains the supplied Point coordinates.
 	HasPoint(Point) bool
@@ -29,6 +34,63 @@ type Object interface {
 	Tag() string
 }
 
+// Bounds returns the smallest rectangle of grid cells containing all points of o.
+func Bounds(o Object) image.Rectangle {
+	points := o.Points()
+	r := image.Rect(points[0].X, points[0].Y, points[0].X+1, points[0].Y+1)
+	for _, p := range points[1:] {
+		r = r.Union(image.Rect(p.X, p.Y, p.X+1, p.Y+1))
+	}
+	return r
+}
+
+// FullPoints returns all the points occupied by o, even if the Canvas was parsed with the Simplify
+// option.
+func FullPoints(o Object) []Point {
+	if o, ok := o.(*object); ok {
+		return o.fullPoints()
+	}
+	return o.Points()
+}
+
+// IsReference returns true if o is the text of a reference, like "[a]", which tags the polygon
+// enclosing it.
+func IsReference(o Object) bool {
+	r, ok := o.(*object)
+	return ok && r.isReference
+}
+
+// Depth returns the number of polygons enclosing o: 0 for a top-level object, 1 for an object
+// inside a single box, and so on. It is computed from the current objects of the canvas of o on
+// each call, so it stays correct across updates without being recomputed for every object.
+func Depth(o Object) int {
+	r, ok := o.(*object)
+	if !ok || r.canvas == nil {
+		return 0
+	}
+	depth := 0
+	for _, e := range r.canvas.EnclosingObjects(r.points[0]) {
+		if e != o {
+			depth++
+		}
+	}
+	return depth
+}
+
+// PathData returns the path data of o, the d attribute of its path, as it is rendered with its
+// default options at the given scale in pixels per cell, for custom SVG built from its geometry. It
+// is empty for text.
+func PathData(o Object, scaleX, scaleY int) string {
+	if o.IsText() {
+		return ""
+	}
+	d := newProjection(RenderOptions{ScaleX: scaleX, ScaleY: scaleY}).flatten(FullPoints(o), cornerRadius)
+	if o.IsClosed() {
+		d += "Z"
+	}
+	return d
+}
+
 // object implements Object and represents one of an open path, a closed path, or text.
 type object struct {
 	// points always starts with the top most, then left most point, proceeding to the right.
@@ -39,12 +101,77 @@ type object struct {
 	isClosed bool
 	isDashed bool
 	tag      string
+	// isReference is true if the text tags its enclosing polygon.
+	isReference bool
+	// simplified is true if points were limited to the points needed to draw the object.
+	simplified bool
+	// canvas is the canvas the object was found on, to compute its depth.
+	canvas *canvas
 }
 
 func (o *object) Points() []Point {
 	return o.points
 }
 
+func (o *object) fullPoints() []Point {
+	if !o.simplified {
+		return o.points
+	}
+	var out []Point
+	for i, p := range o.points {
+		out = append(out, p)
+		next := i + 1
+		if next == len(o.points) {
+			if !o.isClosed {
+				break
+			}
+			next = 0
+		}
+		q := o.points[next]
+		dx, dy := sign(q.X-p.X), sign(q.Y-p.Y)
+		for c := (Point{X: p.X + dx, Y: p.Y + dy}); c.X != q.X || c.Y != q.Y; c.X, c.Y = c.X+dx, c.Y+dy {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// simplify limits the points of a path to its ends, its corners, and the points with a rendering
+// hint. The points in between are straight lines, so that FullPoints can restore them.
+func (o *object) simplify() {
+	if o.isText || o.simplified {
+		return
+	}
+	n := len(o.points)
+	out := make([]Point, 0, len(o.corners))
+	for i, p := range o.points {
+		prev, next := i-1, i+1
+		if o.isClosed {
+			prev, next = (i+n-1)%n, next%n
+		} else if i == 0 || i == n-1 {
+			out = append(out, p)
+			continue
+		}
+		a, b := o.points[prev], o.points[next]
+		if p.Hint != None || sign(p.X-a.X) != sign(b.X-p.X) || sign(p.Y-a.Y) != sign(b.Y-p.Y) {
+			out = append(out, p)
+		}
+	}
+	o.points = out
+	o.simplified = true
+}
+
+// sign returns -1, 0, or 1 for negative, zero, or positive v.
+func sign(v int) int {
+	switch {
+	case v < 0:
+		return -1
+	case v > 0:
+		return 1
+	}
+	return 0
+}
+
 func (o *object) Corners() []Point {
 	return o.corners
 }
@@ -99,8 +226,10 @@ func (o *object) HasPoint(p Point) bool {
 	return hasPoint
 }
 
-// seal finalizes the object, setting its text, its corners, and its various rendering hints.
-func (o *object) seal(c *canvas) {
+// seal finalizes the object, setting its text, its corners, and its various rendering hints. It
+// fails if the points of the object are discontiguous.
+func (o *object) seal(c *canvas) error {
+	o.canvas = c
 	if c.at(o.points[0]).isArrow() {
 		o.points[0].Hint = StartMarker
 	}
@@ -109,8 +238,11 @@ func (o *object) seal(c *canvas) {
 		o.points[len(o.points)-1].Hint = EndMarker
 	}
 
-	o.corners, o.isClosed = pointsToCorners(o.points)
-	o.text = make([]rune, len(o.points))
+	var err error
+	if o.corners, o.isClosed, err = pointsToCorners(o.points); err != nil {
+		return err
+	}
+	o.text = make([]rune, 0, len(o.points))
 
 	for i, p := range o.points {
 		if !o.IsText() {
@@ -120,7 +252,8 @@ func (o *object) seal(c *canvas) {
 				o.points[i].Hint = Dot
 			}
 
-			if c.at(p).isDashed() {
+			if c.at(p).isDashed() || c.isSpaced(p) {
+				o.points[i].Hint = Dashed
 				o.isDashed = true
 			}
 
@@ -130,8 +263,12 @@ func (o *object) seal(c *canvas) {
 				}
 			}
 		}
-		o.text[i] = rune(c.at(p))
+		// The right half of a double-width rune is part of the rune.
+		if ch := c.at(p); ch != wide {
+			o.text = append(o.text, rune(ch))
+		}
 	}
+	return nil
 }
 
 // objects implements a sortable collection of Object interfaces.
@@ -171,12 +308,12 @@ const (
 
 // pointsToCorners returns all the corners (points at which there is a change of directionality) for
 // a path. It additionally returns a truth value indicating whether the points supplied indicate a
-// closed path.
-func pointsToCorners(points []Point) ([]Point, bool) {
+// closed path. It fails if any two consecutive points aren't adjacent.
+func pointsToCorners(points []Point) ([]Point, bool, error) {
 	l := len(points)
 	// A path containing fewer than 3 points can neither be closed, nor change direction.
 	if l < 3 {
-		return points, false
+		return points, false, nil
 	}
 	out := []Point{points[0]}
 
@@ -194,7 +331,7 @@ func pointsToCorners(points []Point) ([]Point, bool) {
 	} else if isDiagonalNE(points[0], points[1]) {
 		dir = dirNE
 	} else {
-		panic(fmt.Errorf("discontiguous points: %+v", points))
+		return nil, false, fmt.Errorf("discontiguous points %s and %s", points[0], points[1])
 	}
 
 	// Starting from the third point, check to see if the directionality between points P and
@@ -219,7 +356,7 @@ func pointsToCorners(points []Point) ([]Point, bool) {
 		} else if isDiagonalNE(points[i-1], points[i]) {
 			cornerFunc(i, dirNE)
 		} else {
-			panic(fmt.Errorf("discontiguous points: %+v", points))
+			return nil, false, fmt.Errorf("discontiguous points %s and %s", points[i-1], points[i])
 		}
 	}
 
@@ -246,5 +383,5 @@ func pointsToCorners(points []Point) ([]Point, bool) {
 		out = append(out, last)
 	}
 
-	return out, closed
+	return out, closed, nil
 }
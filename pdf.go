@@ -0,0 +1,173 @@
+// Copyright 2012 - 2018 The ASCIIToSVG Contributors
+// All rights reserved.
+
+package asciitosvg
+
+import (
+	"bytes"
+	"fmt"
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// CanvasToPDF renders the supplied asciitosvg.Canvas to a single-page PDF document, for the
+// documentation pipelines that require PDF. The page is one cell larger than the grid at the scale
+// of opts, with a pixel being 1/96th of an inch, and the objects are drawn as vector paths in the
+// colors Render resolves for them: polygons are filled and outlined, and lines are drawn with their
+// dashes and markers. Text is set in the standard Courier font, as selectable text; runes outside
+// of Latin-1 are set as question marks. As in CanvasToPNG, rounded corners, shadows, ticks, dots,
+// legends, captions and the other decorations of opts aren't reproduced, and it fails if opts
+// clips, rotates or mirrors the output.
+func CanvasToPDF(c Canvas, opts RenderOptions) ([]byte, error) {
+	if err := checkLayout(opts); err != nil {
+		return nil, err
+	}
+	pr := newProjection(RenderOptions{ScaleX: opts.ScaleX, ScaleY: opts.ScaleY})
+	rd := newRenderer(c, nil, opts)
+	colors := rd.resolveColors()
+	options := c.Options()
+
+	width, height := (c.Size().X+1)*pr.scaleX, (c.Size().Y+1)*pr.scaleY
+	toPoints := 72. / defaultDPI
+	s := &bytes.Buffer{}
+	// Flip the page so that it is drawn in pixels from its top left, as in the SVG.
+	fmt.Fprintf(s, "%s 0 0 %s 0 %s cm\n", pdfNumber(toPoints), pdfNumber(-toPoints), pdfNumber(float64(height)*toPoints))
+
+	// stroke sets the stroke color and width of an object.
+	stroke := func(o Object) {
+		c, _ := options[o.Tag()]["stroke"].(string)
+		fmt.Fprintf(s, "%s RG %s w ", pdfColor(parseColor(c, color.RGBA{A: 0xff})), pdfNumber(strokeWidth(options[o.Tag()])))
+	}
+	// dashes sets the dashes of the paths stroked next.
+	dashes := func(dashed bool) {
+		if dashed {
+			fmt.Fprintf(s, "[%d] 0 d\n", dashLength)
+		} else {
+			s.WriteString("[] 0 d\n")
+		}
+	}
+
+	// As in the SVG, closed objects are drawn first, then lines, then text.
+	for i, o := range c.Objects() {
+		if !o.IsClosed() || o.IsText() {
+			continue
+		}
+		stroke(o)
+		dashes(o.IsDashed())
+		op := "S"
+		if fill := colors[i].Fill; fill != "" && fill != "none" {
+			fmt.Fprintf(s, "%s rg\n", pdfColor(parseColor(fill, color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff})))
+			op = "B"
+		}
+		pdfPath(s, scalePoints(pr, FullPoints(o)))
+		s.WriteString("h " + op + "\n")
+	}
+	for i, o := range c.Objects() {
+		if o.IsClosed() || o.IsText() {
+			continue
+		}
+		// As in the SVG, a line mixing solid and dashed segments is stroked run by run.
+		stroke(o)
+		for _, run := range dashRuns(FullPoints(o)) {
+			dashes(run.dashed)
+			pdfPath(s, scalePoints(pr, run.points))
+			s.WriteString("S\n")
+		}
+		points := scalePoints(pr, FullPoints(o))
+		start, end := rd.strokeMarkers(i, o)
+		if heads := arrowheads(pr, points, strokeWidth(options[o.Tag()]), start, end); len(heads) != 0 {
+			col, _ := options[o.Tag()]["stroke"].(string)
+			fmt.Fprintf(s, "%s rg\n", pdfColor(parseColor(col, color.RGBA{A: 0xff})))
+			for _, head := range heads {
+				pdfPath(s, head)
+				s.WriteString("h f\n")
+			}
+		}
+	}
+	for i, o := range c.Objects() {
+		if !o.IsText() {
+			continue
+		}
+		resolved, ok := colors[i]
+		if !ok {
+			continue
+		}
+		text := string(o.Text())
+		if label, ok := options[o.Tag()]["a2s:label"].(string); ok {
+			text = label
+		}
+		// The text is flipped back upright, with its baseline at the center of its first cell as
+		// in the SVG.
+		sp := pr.scale(o.Points()[0])
+		fmt.Fprintf(s, "BT %s rg /F1 %s Tf 1 0 0 -1 %s %s Tm (%s) Tj ET\n", pdfColor(parseColor(resolved.Text, color.RGBA{A: 0xff})), pdfNumber(fontSize), pdfNumber(sp.X), pdfNumber(sp.Y), pdfString(text))
+	}
+
+	objs := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %s %s] /Resources << /Font << /F1 4 0 R >> >> /Contents 5 0 R >>", pdfNumber(float64(width)*toPoints), pdfNumber(float64(height)*toPoints)),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", s.Len(), s.String()),
+	}
+	b := &bytes.Buffer{}
+	// The binary comment marks the file as binary to the tools that transfer it.
+	b.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(objs))
+	for i, obj := range objs {
+		offsets[i] = b.Len()
+		fmt.Fprintf(b, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := b.Len()
+	fmt.Fprintf(b, "xref\n0 %d\n0000000000 65535 f \n", len(objs)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(b, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(b, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objs)+1, xref)
+	return b.Bytes(), nil
+}
+
+// pdfPath writes the path through points to s, leaving it open.
+func pdfPath(s *bytes.Buffer, points []scaledPoint) {
+	for i, p := range points {
+		op := "l"
+		if i == 0 {
+			op = "m"
+		}
+		fmt.Fprintf(s, "%s %s %s ", pdfNumber(p.X), pdfNumber(p.Y), op)
+	}
+}
+
+// pdfNumber formats v as a PDF number, rounded to hundredths.
+func pdfNumber(v float64) string {
+	v = math.Round(v*100) / 100
+	if v == 0 {
+		// Avoid emitting negative zero.
+		v = 0
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// pdfColor formats c as the red, green and blue operands of the PDF color operators.
+func pdfColor(c color.RGBA) string {
+	return pdfNumber(float64(c.R)/0xff) + " " + pdfNumber(float64(c.G)/0xff) + " " + pdfNumber(float64(c.B)/0xff)
+}
+
+// pdfString escapes text for a PDF literal string in the WinAnsiEncoding of the font. The runes it
+// can't encode are replaced by question marks, padded to the cells they take on the grid.
+func pdfString(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r >= 0x20 && r < 0x7f || r >= 0xa0 && r <= 0xff:
+			b.WriteByte(byte(r))
+		default:
+			b.WriteString("?" + strings.Repeat(" ", runeWidth(r)-1))
+		}
+	}
+	return b.String()
+}
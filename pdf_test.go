@@ -0,0 +1,119 @@
+// Copyright 2012 - 2018 The ASCIIToSVG Contributors
+// All rights reserved.
+
+package asciitosvg
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/maruel/ut"
+)
+
+func TestCanvasToPDF(t *testing.T) {
+	t.Parallel()
+	input := []string{
+		"+----+",
+		"|[a] |==->",
+		"+----+ f(x)",
+		"",
+		"[a]: {\"fill\":\"#c00\"}",
+	}
+	canvas, err := NewCanvas([]byte(strings.Join(input, "\n")), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	data, err := CanvasToPDF(canvas, RenderOptions{})
+	if err != nil {
+		t.Fatalf("Error rendering PDF: %s", err)
+	}
+	ut.AssertEqual(t, true, bytes.HasPrefix(data, []byte("%PDF-1.4\n")))
+	ut.AssertEqual(t, true, bytes.HasSuffix(data, []byte("%%EOF\n")))
+
+	// The cross-reference table gives the offset of every object, and is itself at startxref.
+	m := regexp.MustCompile(`startxref\n(\d+)\n`).FindSubmatch(data)
+	if m == nil {
+		t.Fatalf("No startxref in %q", data)
+	}
+	xref, _ := strconv.Atoi(string(m[1]))
+	ut.AssertEqual(t, true, bytes.HasPrefix(data[xref:], []byte("xref\n0 6\n")))
+	for i, offset := range regexp.MustCompile(`(\d{10}) 00000 n`).FindAllSubmatch(data[xref:], -1) {
+		o, _ := strconv.Atoi(string(offset[1]))
+		ut.AssertEqualIndex(t, i, true, bytes.HasPrefix(data[o:], []byte(fmt.Sprintf("%d 0 obj\n", i+1))))
+	}
+
+	// The page is a cell larger than the grid, 108 by 96 pixels, in points.
+	ut.AssertEqual(t, true, bytes.Contains(data, []byte("/MediaBox [0 0 81 72]")))
+	content := string(data)
+	// The box is filled in red and outlined.
+	ut.AssertEqual(t, true, strings.Contains(content, "0.8 0 0 rg\n4.5 8 m "))
+	ut.AssertEqual(t, true, strings.Contains(content, "h B\n"))
+	// The line is dashed up to its solid last segment, with an arrowhead.
+	ut.AssertEqual(t, true, strings.Contains(content, "[5] 0 d\n58.5 24 m 67.5 24 l 76.5 24 l S\n[] 0 d\n76.5 24 m 85.5 24 l S\n"))
+	ut.AssertEqual(t, true, strings.Contains(content, "h f\n"))
+	// Text is set in Courier, with its parentheses escaped.
+	ut.AssertEqual(t, true, strings.Contains(content, "/BaseFont /Courier"))
+	ut.AssertEqual(t, true, strings.Contains(content, "Tm (f\\(x\\)) Tj ET\n"))
+}
+
+func TestCanvasToPDFLayout(t *testing.T) {
+	t.Parallel()
+	canvas, err := NewCanvas([]byte("+--+\n|  |\n+--+\n"), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	_, err = CanvasToPDF(canvas, RenderOptions{Rotate: 270})
+	ut.AssertEqual(t, "rotating the output isn't supported", err.Error())
+}
+
+func TestCanvasToPDFNonStringFill(t *testing.T) {
+	t.Parallel()
+	for i, fill := range []string{"1", "[0,0]"} {
+		input := "+----+\n|[a] |\n+----+\n\n[a]: {\"fill\":" + fill + "}"
+		canvas, err := NewCanvas([]byte(input), 9, false)
+		if err != nil {
+			t.Fatalf("Error creating canvas: %s", err)
+		}
+		data, err := CanvasToPDF(canvas, RenderOptions{})
+		ut.AssertEqualIndex(t, i, nil, err)
+		// The box is filled with the default fill.
+		ut.AssertEqualIndex(t, i, true, strings.Contains(string(data), "1 1 1 rg\n4.5 8 m "))
+	}
+}
+
+func TestCanvasToPDFMarkers(t *testing.T) {
+	t.Parallel()
+	input := "---->\n\n[0,0]: {\"a2s:marker-start\":true,\"a2s:marker-end\":false}"
+	canvas, err := NewCanvas([]byte(input), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	data, err := CanvasToPDF(canvas, RenderOptions{})
+	if err != nil {
+		t.Fatalf("Error rendering PDF: %s", err)
+	}
+	// As in the SVG, the options of the line move its arrowhead from its end to its start.
+	content := string(data)
+	ut.AssertEqual(t, 1, strings.Count(content, "h f\n"))
+	ut.AssertEqual(t, true, strings.Contains(content, "-3.5 8 m "))
+}
+
+func TestPDFString(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		in       string
+		expected string
+	}{
+		{"foo", "foo"},
+		{"a\\b(c)", "a\\\\b\\(c\\)"},
+		{"café", "caf\xe9"},
+		{"中a", "? a"},
+	}
+	for i, line := range data {
+		ut.AssertEqualIndex(t, i, line.expected, pdfString(line.in))
+	}
+}
@@ -0,0 +1,268 @@
+// Copyright 2012 - 2018 The ASCIIToSVG Contributors
+// All rights reserved.
+
+package asciitosvg
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"sort"
+)
+
+// dashLength is the length in pixels of the dashes of dashed strokes, and of the gaps between them,
+// as in pathDashes.
+const dashLength = 5
+
+// CanvasToPNG renders the supplied asciitosvg.Canvas to a PNG image, for the places that don't
+// accept SVG. The image is rasterized natively from the objects, one cell larger than the grid at
+// the scale of opts and in the colors Render resolves for them, on a white background: polygons
+// are filled and outlined, lines are drawn with their dashes and markers, and text is drawn with a
+// built-in bitmap font of the ASCII characters, in which other runes are drawn as boxes. Rounded
+// corners, shadows, ticks, dots, legends, captions and the other decorations of opts aren't
+// reproduced. It fails if opts clips, rotates or mirrors the output, which the image can't
+// reproduce, or if the image can't be encoded.
+func CanvasToPNG(c Canvas, opts RenderOptions) ([]byte, error) {
+	if err := checkLayout(opts); err != nil {
+		return nil, err
+	}
+	pr := newProjection(RenderOptions{ScaleX: opts.ScaleX, ScaleY: opts.ScaleY})
+	rd := newRenderer(c, nil, opts)
+	colors := rd.resolveColors()
+	options := c.Options()
+
+	img := image.NewRGBA(image.Rect(0, 0, (c.Size().X+1)*pr.scaleX, (c.Size().Y+1)*pr.scaleY))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+	r := raster{img: img}
+
+	// stroke returns the stroke color and width of an object.
+	stroke := func(o Object) (color.RGBA, float64) {
+		s, _ := options[o.Tag()]["stroke"].(string)
+		return parseColor(s, color.RGBA{A: 0xff}), strokeWidth(options[o.Tag()])
+	}
+
+	// As in the SVG, closed objects are drawn first, then lines, then text.
+	for i, o := range c.Objects() {
+		if !o.IsClosed() || o.IsText() {
+			continue
+		}
+		points := scalePoints(pr, FullPoints(o))
+		if fill := colors[i].Fill; fill != "" && fill != "none" {
+			r.fillPolygon(points, parseColor(fill, color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}))
+		}
+		col, width := stroke(o)
+		r.polyline(append(points, points[0]), width, col, o.IsDashed())
+	}
+	for i, o := range c.Objects() {
+		if o.IsClosed() || o.IsText() {
+			continue
+		}
+		// As in the SVG, a line mixing solid and dashed segments is stroked run by run.
+		col, width := stroke(o)
+		for _, run := range dashRuns(FullPoints(o)) {
+			r.polyline(scalePoints(pr, run.points), width, col, run.dashed)
+		}
+		points := scalePoints(pr, FullPoints(o))
+		start, end := rd.strokeMarkers(i, o)
+		for _, head := range arrowheads(pr, points, width, start, end) {
+			r.fillPolygon(head, col)
+		}
+	}
+	// Dots are drawn at a whole multiple of the size of the glyphs that fits in a cell.
+	dot := pr.scaleX / (glyphWidth + 1)
+	if d := pr.scaleY / (glyphHeight + 3); d < dot {
+		dot = d
+	}
+	if dot < 1 {
+		dot = 1
+	}
+	for i, o := range c.Objects() {
+		if !o.IsText() {
+			continue
+		}
+		resolved, ok := colors[i]
+		if !ok {
+			continue
+		}
+		text := string(o.Text())
+		if label, ok := options[o.Tag()]["a2s:label"].(string); ok {
+			text = label
+		}
+		col := parseColor(resolved.Text, color.RGBA{A: 0xff})
+		start := o.Points()[0]
+		x, y := start.X*pr.scaleX+(pr.scaleX-glyphWidth*dot)/2, start.Y*pr.scaleY+(pr.scaleY-glyphHeight*dot)/2
+		for _, ch := range text {
+			r.glyph(fontGlyph(ch), x, y, dot, col)
+			x += runeWidth(ch) * pr.scaleX
+		}
+	}
+
+	b := &bytes.Buffer{}
+	if err := png.Encode(b, img); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// checkLayout returns an error if opts lays the objects out other than on the grid, as clipping,
+// rotating and mirroring the output do, which CanvasToPNG and CanvasToPDF don't reproduce.
+func checkLayout(opts RenderOptions) error {
+	switch {
+	case !opts.Clip.Empty():
+		return fmt.Errorf("clipping the output isn't supported")
+	case (opts.Rotate%360+360)%360 != 0:
+		return fmt.Errorf("rotating the output isn't supported")
+	case opts.Mirror:
+		return fmt.Errorf("mirroring the output isn't supported")
+	}
+	return nil
+}
+
+// parseColor returns the color c, or def if c isn't a valid color.
+func parseColor(c string, def color.RGBA) color.RGBA {
+	r, g, b, err := colorToRGB(c)
+	if err != nil {
+		return def
+	}
+	return color.RGBA{R: uint8(r), G: uint8(g), B: uint8(b), A: 0xff}
+}
+
+// scalePoints returns the points scaled to the output.
+func scalePoints(pr projection, points []Point) []scaledPoint {
+	out := make([]scaledPoint, len(points))
+	for i, p := range points {
+		out[i] = pr.scale(p)
+	}
+	return out
+}
+
+// A raster draws shapes onto an image, painting the pixels whose center is within them.
+type raster struct {
+	img *image.RGBA
+}
+
+// fillPolygon fills the polygon of points, by the even-odd rule.
+func (r raster) fillPolygon(points []scaledPoint, c color.RGBA) {
+	b := r.img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		cy := float64(y) + .5
+		var xs []float64
+		for i := range points {
+			p, q := points[i], points[(i+1)%len(points)]
+			if (p.Y <= cy) != (q.Y <= cy) {
+				xs = append(xs, p.X+(cy-p.Y)/(q.Y-p.Y)*(q.X-p.X))
+			}
+		}
+		sort.Float64s(xs)
+		for i := 0; i+1 < len(xs); i += 2 {
+			for x := int(math.Ceil(xs[i] - .5)); float64(x)+.5 <= xs[i+1]; x++ {
+				r.img.SetRGBA(x, y, c)
+			}
+		}
+	}
+}
+
+// polyline strokes the segments between points with the given width, dashed if requested. Dashes
+// run on from one segment to the next.
+func (r raster) polyline(points []scaledPoint, width float64, c color.RGBA, dashed bool) {
+	offset := 0.
+	for i := 1; i < len(points); i++ {
+		offset = r.segment(points[i-1], points[i], width, c, dashed, offset)
+	}
+}
+
+// segment strokes the segment from p to q, starting offset pixels into the pattern of dashes, and
+// returns the offset at its end.
+func (r raster) segment(p, q scaledPoint, width float64, c color.RGBA, dashed bool, offset float64) float64 {
+	dx, dy := q.X-p.X, q.Y-p.Y
+	length := math.Hypot(dx, dy)
+	half := width / 2
+	minX, maxX := int(math.Floor(math.Min(p.X, q.X)-half)), int(math.Ceil(math.Max(p.X, q.X)+half))
+	minY, maxY := int(math.Floor(math.Min(p.Y, q.Y)-half)), int(math.Ceil(math.Max(p.Y, q.Y)+half))
+	for y := minY; y <= maxY; y++ {
+		for x := minX; x <= maxX; x++ {
+			cx, cy := float64(x)+.5, float64(y)+.5
+			// t is the distance along the segment of the pixel's projection onto it.
+			t := 0.
+			if length != 0 {
+				t = math.Max(0, math.Min(length, ((cx-p.X)*dx+(cy-p.Y)*dy)/length))
+			}
+			px, py := p.X, p.Y
+			if length != 0 {
+				px, py = p.X+dx*t/length, p.Y+dy*t/length
+			}
+			if math.Hypot(cx-px, cy-py) > half {
+				continue
+			}
+			if dashed && math.Mod(offset+t, 2*dashLength) >= dashLength {
+				continue
+			}
+			if image.Pt(x, y).In(r.img.Bounds()) {
+				r.img.SetRGBA(x, y, c)
+			}
+		}
+	}
+	return offset + length
+}
+
+// strokeMarkers returns whether the line i has a start and an end marker, as resolved for the SVG
+// by lineMarkers. The tail and the head of an edge, which are stroked apart, each keep the marker
+// of their own end of the edge.
+func (r *renderer) strokeMarkers(i int, obj Object) (bool, bool) {
+	if _, ok := r.edges[i]; ok || r.edgeHeads[i] {
+		points := obj.Points()
+		return points[0].Hint == StartMarker, points[len(points)-1].Hint == EndMarker
+	}
+	return r.lineMarkers(i, obj)
+}
+
+// arrowheads returns the triangles of the markers of a line of the given width, each centered on
+// an end of the line with a marker, as selected by start and end, and sized as in the SVG.
+func arrowheads(pr projection, points []scaledPoint, width float64, start, end bool) [][]scaledPoint {
+	n := len(points)
+	if n < 2 {
+		return nil
+	}
+	size := math.Min(float64(pr.scaleX-1), float64(pr.scaleY-1)) * width
+	head := func(end, prev scaledPoint) []scaledPoint {
+		dx, dy := end.X-prev.X, end.Y-prev.Y
+		l := math.Hypot(dx, dy)
+		if l == 0 {
+			return nil
+		}
+		dx, dy = dx/l*size/2, dy/l*size/2
+		return []scaledPoint{
+			{X: end.X + dx, Y: end.Y + dy},
+			{X: end.X - dx - dy, Y: end.Y - dy + dx},
+			{X: end.X - dx + dy, Y: end.Y - dy - dx},
+		}
+	}
+	var out [][]scaledPoint
+	if start {
+		if h := head(points[0], points[1]); h != nil {
+			out = append(out, h)
+		}
+	}
+	if end {
+		if h := head(points[n-1], points[n-2]); h != nil {
+			out = append(out, h)
+		}
+	}
+	return out
+}
+
+// glyph draws g with its top left at x, y, each of its dots a square of size pixels.
+func (r raster) glyph(g [glyphHeight]uint8, x, y, size int, c color.RGBA) {
+	for row, bits := range g {
+		for col := 0; col < glyphWidth; col++ {
+			if bits&(1<<uint(glyphWidth-1-col)) == 0 {
+				continue
+			}
+			draw.Draw(r.img, image.Rect(x+col*size, y+row*size, x+(col+1)*size, y+(row+1)*size), image.NewUniform(c), image.Point{}, draw.Src)
+		}
+	}
+}
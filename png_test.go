@@ -0,0 +1,138 @@
+// Copyright 2012 - 2018 The ASCIIToSVG Contributors
+// All rights reserved.
+
+package asciitosvg
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/maruel/ut"
+)
+
+func TestCanvasToPNG(t *testing.T) {
+	t.Parallel()
+	input := []string{
+		"+----+",
+		"|[a] |--->",
+		"+----+",
+		"",
+		"[a]: {\"fill\":\"#c00\"}",
+	}
+	canvas, err := NewCanvas([]byte(strings.Join(input, "\n")), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	data, err := CanvasToPNG(canvas, RenderOptions{})
+	if err != nil {
+		t.Fatalf("Error rendering PNG: %s", err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Error decoding PNG: %s", err)
+	}
+	// The image is a cell larger than the grid of 10 by 5 cells, of 9 by 16 pixels.
+	ut.AssertEqual(t, image.Rect(0, 0, 99, 96), img.Bounds())
+
+	black, red, white := color.RGBA{A: 0xff}, color.RGBA{R: 0xcc, A: 0xff}, color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}
+	// The top wall of the box runs through the middle of the first row, at y = 8.
+	ut.AssertEqual(t, black, color.RGBAModel.Convert(img.At(27, 8)))
+	// The box is filled within its walls, and the background is white.
+	ut.AssertEqual(t, red, color.RGBAModel.Convert(img.At(40, 32)))
+	ut.AssertEqual(t, white, color.RGBAModel.Convert(img.At(27, 60)))
+	// The line and its arrowhead.
+	ut.AssertEqual(t, black, color.RGBAModel.Convert(img.At(60, 24)))
+	ut.AssertEqual(t, black, color.RGBAModel.Convert(img.At(85, 24)))
+}
+
+func TestCanvasToPNGNonStringFill(t *testing.T) {
+	t.Parallel()
+	for i, fill := range []string{"1", "[0,0]"} {
+		input := "+----+\n|[a] |\n+----+\n\n[a]: {\"fill\":" + fill + "}"
+		canvas, err := NewCanvas([]byte(input), 9, false)
+		if err != nil {
+			t.Fatalf("Error creating canvas: %s", err)
+		}
+		data, err := CanvasToPNG(canvas, RenderOptions{})
+		ut.AssertEqualIndex(t, i, nil, err)
+		img, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("Error decoding PNG: %s", err)
+		}
+		// The box is filled with the default fill.
+		ut.AssertEqualIndex(t, i, color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}, color.RGBAModel.Convert(img.At(40, 32)))
+	}
+}
+
+func TestCanvasToPNGDashes(t *testing.T) {
+	t.Parallel()
+	canvas, err := NewCanvas([]byte("---===---"), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	data, err := CanvasToPNG(canvas, RenderOptions{})
+	if err != nil {
+		t.Fatalf("Error rendering PNG: %s", err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Error decoding PNG: %s", err)
+	}
+	black, white := color.RGBA{A: 0xff}, color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}
+	// The dashed run, starting at x = 22.5, has a gap after its first dash, while the solid run
+	// after it, from x = 58.5, has none.
+	ut.AssertEqual(t, white, color.RGBAModel.Convert(img.At(29, 8)))
+	ut.AssertEqual(t, black, color.RGBAModel.Convert(img.At(70, 8)))
+	ut.AssertEqual(t, black, color.RGBAModel.Convert(img.At(10, 8)))
+}
+
+func TestCanvasToPNGMarkers(t *testing.T) {
+	t.Parallel()
+	input := "---->\n\n[0,0]: {\"a2s:marker-start\":true,\"a2s:marker-end\":false}"
+	canvas, err := NewCanvas([]byte(input), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	data, err := CanvasToPNG(canvas, RenderOptions{})
+	if err != nil {
+		t.Fatalf("Error rendering PNG: %s", err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Error decoding PNG: %s", err)
+	}
+	black, white := color.RGBA{A: 0xff}, color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}
+	// As in the SVG, the options of the line move its arrowhead from its end to its start, which
+	// is wider than the line.
+	ut.AssertEqual(t, black, color.RGBAModel.Convert(img.At(8, 3)))
+	ut.AssertEqual(t, white, color.RGBAModel.Convert(img.At(38, 3)))
+}
+
+func TestCanvasToPNGLayout(t *testing.T) {
+	t.Parallel()
+	canvas, err := NewCanvas([]byte("+--+\n|  |\n+--+\n"), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	data := []struct {
+		opts     RenderOptions
+		expected string
+	}{
+		{RenderOptions{Clip: image.Rect(0, 0, 2, 2)}, "clipping the output isn't supported"},
+		{RenderOptions{Rotate: 90}, "rotating the output isn't supported"},
+		{RenderOptions{Mirror: true}, "mirroring the output isn't supported"},
+		{RenderOptions{Rotate: 360}, ""},
+	}
+	for i, line := range data {
+		_, err := CanvasToPNG(canvas, line.opts)
+		msg := ""
+		if err != nil {
+			msg = err.Error()
+		}
+		ut.AssertEqualIndex(t, i, line.expected, msg)
+	}
+}
@@ -21,6 +21,8 @@ const (
 	Tick
 	// Dot indicates the renderer should insert a filled dot in the path at this point.
 	Dot
+	// Dashed indicates the renderer should draw the path dashed where it meets this point.
+	Dashed
 )
 
 // A Point is an X,Y coordinate in the diagram's grid. The grid represents (0, 0) as the top-left
@@ -0,0 +1,50 @@
+// Copyright 2012 - 2018 The ASCIIToSVG Contributors
+// All rights reserved.
+
+package asciitosvg
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+const (
+	previewRectTag = "    <rect x=\"%s\" y=\"%s\" width=\"%s\" height=\"%s\" />\n"
+	previewLineTag = "    <line x1=\"%s\" y1=\"%s\" x2=\"%s\" y2=\"%s\" />\n"
+)
+
+// CanvasToPreviewSVG renders a rough preview of the supplied asciitosvg.Canvas, suitable for
+// thumbnails and placeholders. Each closed object is drawn as the outline of its bounding
+// rectangle, and each open object as a straight line between its ends. Curves, markers, ticks,
+// dots, shadows, and text are omitted. The output has the same dimensions as that of CanvasToSVG
+// for the same scale.
+func CanvasToPreviewSVG(c Canvas, scaleX, scaleY int) []byte {
+	pr := newProjection(RenderOptions{ScaleX: scaleX, ScaleY: scaleY})
+
+	b := &bytes.Buffer{}
+	io.WriteString(b, header)
+	writeWatermark(b, RenderOptions{})
+	writeSVGTag(b, pr, RenderOptions{}, (c.Size().X+1)*pr.scaleX, (c.Size().Y+1)*pr.scaleY)
+
+	io.WriteString(b, "  <g id=\"preview\" stroke=\"#000\" stroke-width=\"2\" fill=\"none\">\n")
+	for _, obj := range c.Objects() {
+		if obj.IsText() {
+			continue
+		}
+		if obj.IsClosed() {
+			r := Bounds(obj)
+			tl := pr.scale(Point{X: r.Min.X, Y: r.Min.Y})
+			br := pr.scale(Point{X: r.Max.X - 1, Y: r.Max.Y - 1})
+			fmt.Fprintf(b, previewRectTag, pr.f(tl.X), pr.f(tl.Y), pr.f(br.X-tl.X), pr.f(br.Y-tl.Y))
+			continue
+		}
+		points := obj.Points()
+		p1, p2 := pr.scale(points[0]), pr.scale(points[len(points)-1])
+		fmt.Fprintf(b, previewLineTag, pr.f(p1.X), pr.f(p1.Y), pr.f(p2.X), pr.f(p2.Y))
+	}
+	io.WriteString(b, "  </g>\n")
+
+	io.WriteString(b, "</svg>\n")
+	return b.Bytes()
+}
@@ -0,0 +1,30 @@
+// Copyright 2012 - 2018 The ASCIIToSVG Contributors
+// All rights reserved.
+
+package asciitosvg
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/maruel/ut"
+)
+
+func TestCanvasToPreviewSVG(t *testing.T) {
+	t.Parallel()
+	input := []string{
+		".----.     +--+",
+		"| Hi |---->|  |",
+		"'----'     +--+",
+	}
+	c, err := NewCanvas([]byte(strings.Join(input, "\n")), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	actual := string(CanvasToPreviewSVG(c, 9, 16))
+	ut.AssertEqual(t, 2, strings.Count(actual, "<rect "))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<rect x=\"4.5\" y=\"8\" width=\"45\" height=\"32\" />"))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<line x1=\"58.5\" y1=\"24\" x2=\"94.5\" y2=\"24\" />"))
+	ut.AssertEqual(t, 0, strings.Count(actual, "<text"))
+	ut.AssertEqual(t, false, strings.Contains(actual, "filter"))
+}
@@ -0,0 +1,20 @@
+// Copyright 2012 - 2018 The ASCIIToSVG Contributors
+// All rights reserved.
+
+package asciitosvg
+
+// CanvasToSprites renders each object of the supplied asciitosvg.Canvas as a standalone SVG of its
+// own, cropped to the object as with the Clip option of opts, e.g. to extract the shapes of a
+// diagram for an asset pipeline. The SVGs are keyed by the id the objects have in a render of the
+// full Canvas, such as "closed0". The legend and the minimap of opts are left out of them.
+func CanvasToSprites(c Canvas, opts RenderOptions) map[string][]byte {
+	opts.Legend = false
+	opts.Minimap = 0
+	sprites := map[string][]byte{}
+	for i, o := range c.Objects() {
+		target := o
+		opts.Clip = Bounds(o)
+		sprites[objectID(i, o)] = CanvasToSVGFiltered(c, func(o Object) bool { return o == target }, opts)
+	}
+	return sprites
+}
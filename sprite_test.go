@@ -0,0 +1,34 @@
+// Copyright 2012 - 2018 The ASCIIToSVG Contributors
+// All rights reserved.
+
+package asciitosvg
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/maruel/ut"
+)
+
+func TestCanvasToSprites(t *testing.T) {
+	t.Parallel()
+	input := []string{
+		"+--+",
+		"|Hi|--->",
+		"+--+",
+	}
+	canvas, err := NewCanvas([]byte(strings.Join(input, "\n")), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	sprites := CanvasToSprites(canvas, RenderOptions{})
+	ut.AssertEqual(t, 3, len(sprites))
+	for id, svg := range sprites {
+		ut.AssertEqual(t, true, strings.Contains(string(svg), "<svg "))
+		ut.AssertEqual(t, true, strings.Contains(string(svg), " id=\""+id+"\""))
+		ut.AssertEqual(t, 1, strings.Count(string(svg), "<path id=")+strings.Count(string(svg), "<text id="))
+	}
+	ut.AssertEqual(t, true, strings.Contains(string(sprites["closed0"]), "<svg width=\"45px\" height=\"64px\""))
+	ut.AssertEqual(t, true, strings.Contains(string(sprites["open1"]), "<svg width=\"45px\" height=\"32px\""))
+	ut.AssertEqual(t, true, strings.Contains(string(sprites["obj2"]), ">Hi</text>"))
+}
@@ -7,29 +7,139 @@ import (
 	"bytes"
 	"encoding/xml"
 	"fmt"
+	"hash/fnv"
+	"image"
 	"io"
+	"math"
+	"sort"
+	"strconv"
 	"strings"
 	// TODO(dhobsd): Investigate using SVGo?
 )
 
 const (
-	defaultFont = "Consolas,Monaco,Anonymous Pro,Anonymous,Bitstream Sans Mono,monospace"
-	header      = "<!DOCTYPE svg PUBLIC \"-//W3C//DTD SVG 1.1//EN\" \"http://www.w3.org/Graphics/SVG/1.1/DTD/svg11.dtd\">\n"
-	watermark   = "<!-- Created with ASCIItoSVG -->\n"
-	svgTag      = "<svg width=\"%dpx\" height=\"%dpx\" version=\"1.1\" xmlns=\"http://www.w3.org/2000/svg\" xmlns:xlink=\"http://www.w3.org/1999/xlink\">\n"
+	defaultFont      = "Consolas,Monaco,Anonymous Pro,Anonymous,Bitstream Sans Mono,monospace"
+	defaultScaleX    = 9
+	defaultScaleY    = 16
+	defaultPrecision = 2
+	defaultDPI       = 96
+
+	// cornerRadius is the radius of rounded corners in pixels.
+	cornerRadius = 10
+
+	// fontSize is the size of text in pixels.
+	fontSize = 15.2
+
+	// Conventions of the legacy output, as described by RenderOptions.Legacy: the font size in
+	// heights of a cell, and the offset of text in cells.
+	legacyFontScale = 0.95
+	legacyTextDX    = -0.6
+	legacyTextDY    = 0.3
+
+	// emSize is the size in pixels of an em, the default font size of browsers.
+	emSize = 16
+
+	defaultMinBrightness = 125
+	defaultMinDifference = 500
+
+	defaultWatermark = "Created with ASCIItoSVG"
+
+	// diagramTag is the tag whose options apply to the whole diagram.
+	diagramTag = "a2s"
+
+	// invertFill is the fill of objects with the a2s:invert option.
+	invertFill = "#333"
+
+	// defaultFill replaces the fills that aren't valid colors.
+	defaultFill = "#fff"
+	// defaultChipFill is the fill of the chips below the labels of lines, replacing the chip
+	// colors that aren't valid colors.
+	defaultChipFill = "#fff"
+
+	stylesheetPI = "<?xml-stylesheet href=\"%s\" type=\"text/css\"?>\n"
+	header       = "<!DOCTYPE svg PUBLIC \"-//W3C//DTD SVG 1.1//EN\" \"http://www.w3.org/Graphics/SVG/1.1/DTD/svg11.dtd\">\n"
+	watermark    = "<!-- %s -->\n"
+	svgTag       = "<svg width=\"%s\" height=\"%s\"%s version=\"1.1\" xmlns=\"http://www.w3.org/2000/svg\" xmlns:xlink=\"http://www.w3.org/1999/xlink\">\n"
+
+	// Group of the elements of a pass.
+	groupTag = "  <g id=\"%s\" %s>\n"
+
+	// Lane related tag.
+	laneTag = "    <rect id=\"lane%d\" x=\"%s\" y=\"%s\" width=\"%s\" height=\"%s\" />\n"
 
 	// Path related tag.
-	pathTag       = "    %s<path id=\"%s%d\" %sd=\"%s\" />%s\n"
-	pathMarkStart = "marker-start=\"url(#iPointer)\" "
-	pathMarkEnd   = "marker-end=\"url(#Pointer)\" "
+	pathTag         = "    %s<path id=\"%s%d\" %sd=\"%s\" />%s\n"
+	useTag          = "    %s<use id=\"%s%d\" %sxlink:href=\"#%s\" transform=\"translate(%s %s)\" />%s\n"
+	symbolTag       = "    <symbol id=\"%s\" overflow=\"visible\"><path d=\"%s\" /></symbol>\n"
+	clipPathTag     = "    <clipPath id=\"clip%d\"><path d=\"%s\" /></clipPath>\n"
+	clipAttrs       = "clip-path=\"url(#clip%d)\" "
+	clipGroupTag    = "<g clip-path=\"url(#clip%d)\">"
+	ariaGroupTag    = "<g role=\"img\" aria-label=\"%s\">"
+	pathGroupTag    = "    %s<g id=\"%s%d\" %s>\n%s"
+	subPathTag      = "      <path %sd=\"%s\" />\n"
+	pathGroupEndTag = "    </g>%s\n"
+	separatorTag    = "    %s<line id=\"open%d\" x1=\"%s\" y1=\"%s\" x2=\"%s\" y2=\"%s\" %s/>%s\n"
+	joinTag         = "    <path d=\"M %s %s L %s %s\" />\n"
+	pathDashes      = "stroke-dasharray=\"5 5\" "
+	pathStrokes     = "stroke=\"#000\" stroke-width=\"2\" fill=\"none\""
+	pathMarkStart   = "marker-start=\"url(#i%sPointer%s)\" "
+	pathMarkEnd     = "marker-end=\"url(#%sPointer%s)\" "
+
+	// Tapered ends of lines, drawn thinner toward their marker. The marker is carried by an
+	// unstroked copy of the tip, so that it keeps the size given by the width of the line.
+	taperAttrs   = "stroke-width=\"%s\" "
+	carrierAttrs = "stroke=\"none\" "
+
+	// Animations of objects with the a2s:animate option. Elements fading in are hidden until
+	// their animation begins, and paths being drawn are measured as a unit long so that their
+	// stroke can be dashed by their whole length.
+	animatedPathTag = "    %s<path id=\"%s%d\" %sd=\"%s\">%s</path>%s\n"
+	animatedUseTag  = "    %s<use id=\"%s%d\" %sxlink:href=\"#%s\" transform=\"translate(%s %s)\">%s</use>%s\n"
+	fadeAttrs       = "opacity=\"0\" "
+	fadeTag         = "<animate attributeName=\"opacity\" from=\"0\" to=\"1\" dur=\"1s\" begin=\"%s\" fill=\"freeze\" />"
+	drawAttrs       = "pathLength=\"1\" stroke-dasharray=\"1\" stroke-dashoffset=\"1\" "
+	drawTag         = "<animate attributeName=\"stroke-dashoffset\" from=\"1\" to=\"0\" dur=\"1s\" begin=\"%s\" fill=\"freeze\" />"
 
 	// Text related tag.
-	textGroupTag = "  <g id=\"text\" stroke=\"none\" style=\"font-family:%s;font-size:15.2px\" >\n"
-	textTag      = "    %s<text id=\"obj%d\" x=\"%g\" y=\"%g\" fill=\"%s\">%s</text>%s\n"
+	textGroupTag = "  <g id=\"text\" %s>\n"
+	textStyle    = "stroke=\"none\" style=\"font-family:%s;font-size:%s\" "
+	textTag      = "    %s<text id=\"obj%d\" x=\"%s\" y=\"%s\" %s%s>%s</text>%s\n"
+	tspanTag     = "<tspan x=\"%s\"%s>%s</tspan>"
+
+	// Line label tags.
+	lineLabelTag = "    %s<text id=\"label%d\" x=\"%s\" y=\"%s\" %s>%s</text>%s\n"
+	chipTag      = "    <rect x=\"%s\" y=\"%s\" width=\"%s\" height=\"%s\" rx=\"%s\" fill=\"%s\" />\n"
+	leaderTag    = "    <line id=\"leader%d\" x1=\"%s\" y1=\"%s\" x2=\"%s\" y2=\"%s\" %s/>\n"
+
+	// Legend related tags.
+	legendGroupTag  = "  <g id=\"legend\" %s>\n"
+	legendStyle     = "stroke=\"#000\" stroke-width=\"1\" style=\"font-family:%s;font-size:%s\" "
+	legendSwatchTag = "    <rect x=\"%s\" y=\"%s\" width=\"%s\" height=\"%s\" fill=\"%s\" />\n"
+	legendTextTag   = "    <text x=\"%s\" y=\"%s\" %s>%s</text>\n"
+
+	// Highlight related tags.
+	highlightStyle = "fill=\"#ffd400\" fill-opacity=\"0.3\" stroke=\"#ffd400\" stroke-width=\"2\""
+	highlightTag   = "    <rect id=\"highlight-%s\" x=\"%s\" y=\"%s\" width=\"%s\" height=\"%s\" rx=\"3\" />\n"
+
+	// Frame of the bounds of the diagram.
+	frameTag   = "  <rect id=\"frame\" x=\"%s\" y=\"%s\" width=\"%s\" height=\"%s\" %s/>\n"
+	frameStyle = "fill=\"none\" stroke=\"#888\" stroke-width=\"1\" stroke-dasharray=\"4 2\" "
+
+	// Minimap related tags.
+	minimapTag      = "  <g id=\"minimap\" transform=\"translate(%s %s) scale(%s)\" %s>\n"
+	minimapStyle    = "fill=\"#ccc\" stroke=\"#666\" stroke-width=\"%s\""
+	minimapFrameTag = "    <rect id=\"minimap-frame\" x=\"0\" y=\"0\" width=\"%s\" height=\"%s\" fill=\"#fff\" fill-opacity=\"0.8\" />\n"
+	minimapRectTag  = "    <rect id=\"minimap-%s\" x=\"%s\" y=\"%s\" width=\"%s\" height=\"%s\" />\n"
+
+	// Caption of the diagram.
+	captionTag   = "  <text id=\"caption\" x=\"%s\" y=\"%s\" %s>%s</text>\n"
+	captionStyle = "text-anchor=\"middle\" style=\"font-family:%s;font-size:%s\""
 
 	// Point effect tags.
-	dotTag  = "    <circle cx=\"%g\" cy=\"%g\" r=\"3\" fill=\"#000\" />\n"
-	tickTag = "    <line x1=\"%g\" y1=\"%g\" x2=\"%g\" y2=\"%g\" stroke-width=\"1\" />\n"
+	dotTag    = "    <circle cx=\"%s\" cy=\"%s\" r=\"3\" %s/>\n"
+	circleTag = "    <circle cx=\"%s\" cy=\"%s\" r=\"3\" %s/>\n"
+	squareTag = "    <rect x=\"%s\" y=\"%s\" width=\"6\" height=\"6\" %s/>\n"
+	tickTag   = "    <line x1=\"%s\" y1=\"%s\" x2=\"%s\" y2=\"%s\" %s/>\n"
 
 	// TODO(dhobsd): Fine tune.
 	blurDef = `  <defs>
@@ -53,244 +163,2448 @@ const (
       orient="auto">
       <path d="M 0 0 L 10 5 L 0 10 z" />
     </marker>
-  </defs>
+%s  </defs>
+`
+
+	// Filter of the lines and polygons of sketches, displacing them by turbulence of the given seed
+	// so that they look drawn by hand.
+	sketchDef = `    <filter id="sketch">
+      <feTurbulence type="fractalNoise" baseFrequency="0.05" numOctaves="2" seed="%d" result="noise"/>
+      <feDisplacementMap in="SourceGraphic" in2="noise" scale="%s" xChannelSelector="R" yChannelSelector="G"/>
+    </filter>
+`
+	sketchAttrs = " filter=\"url(#sketch)\""
+
+	// Unblurred drop-shadow filter of the legacy output, cast by closed objects when blur is
+	// disabled.
+	legacyShadowDef = `    <filter id="dsFilterNoBlur" width="150%" height="150%">
+      <feOffset result="offOut" in="SourceGraphic" dx="3" dy="3"/>
+      <feColorMatrix result="matrixOut" in="offOut" type="matrix" values="0.2 0 0 0 0 0 0.2 0 0 0 0 0 0.2 0 0 0 0 0 1 0"/>
+      <feBlend in="SourceGraphic" in2="matrixOut" mode="normal"/>
+    </filter>
+`
+
+	// Markers drawing arrowheads as open chevrons.
+	openMarkerDef = `    <marker id="iOpenPointer"
+      viewBox="0 0 10 10" refX="5" refY="5"
+      markerUnits="strokeWidth"
+      markerWidth="%g" markerHeight="%g"
+      orient="auto">
+      <path d="M 10 0 L 0 5 L 10 10" fill="none" stroke="#000" stroke-width="1.25" />
+    </marker>
+    <marker id="OpenPointer"
+      viewBox="0 0 10 10" refX="5" refY="5"
+      markerUnits="strokeWidth"
+      markerWidth="%g" markerHeight="%g"
+      orient="auto">
+      <path d="M 0 0 L 10 5 L 0 10" fill="none" stroke="#000" stroke-width="1.25" />
+    </marker>
+`
+
+	// Markers drawing doubled arrowheads, as in "-->>", as open double chevrons.
+	doubleMarkerDef = `    <marker id="iDoublePointer"
+      viewBox="0 0 10 10" refX="5" refY="5"
+      markerUnits="strokeWidth"
+      markerWidth="%g" markerHeight="%g"
+      orient="auto">
+      <path d="M 10 0 L 5 5 L 10 10 M 5 0 L 0 5 L 5 10" fill="none" stroke="#000" stroke-width="1.25" />
+    </marker>
+    <marker id="DoublePointer"
+      viewBox="0 0 10 10" refX="5" refY="5"
+      markerUnits="strokeWidth"
+      markerWidth="%g" markerHeight="%g"
+      orient="auto">
+      <path d="M 0 0 L 5 5 L 0 10 M 5 0 L 10 5 L 5 10" fill="none" stroke="#000" stroke-width="1.25" />
+    </marker>
+`
+
+	// Marker of lines with a stroke color of their own, painted in that color. Its id is suffixed
+	// with the color, so that lines of the same color share it.
+	colorMarkerDef = `    <marker id="%sPointer-%s"
+      viewBox="0 0 10 10" refX="5" refY="5"
+      markerUnits="strokeWidth"
+      markerWidth="%g" markerHeight="%g"
+      orient="auto">
+      <path d="%s" %s/>
+    </marker>
+`
+
+	// Drop-shadow filter of an object with its own shadow options.
+	shadowDef = `    <filter id="%s" width="150%%" height="150%%">
+      <feOffset result="offOut" in="SourceGraphic" dx="%s" dy="%s"/>
+      <feColorMatrix result="matrixOut" in="offOut" type="matrix" values="0.2 0 0 0 0 0 0.2 0 0 0 0 0 0.2 0 0 0 0 0 %s 0"/>
+      <feGaussianBlur result="blurOut" in="matrixOut" stdDeviation="%s"/>
+      <feBlend in="SourceGraphic" in2="blurOut" mode="normal"/>
+    </filter>
 `
 )
 
+// RenderOptions controls how a Canvas is rendered. The zero value renders with the defaults.
+type RenderOptions struct {
+	// NoBlur disables the drop-shadow filter on closed objects.
+	NoBlur bool
+	// Font is the font family to use for text. If empty, a list of common monospace fonts is
+	// used.
+	Font string
+	// ScaleX and ScaleY are the width and height in pixels of a single grid cell. If zero, 9
+	// and 16 are used, respectively.
+	ScaleX, ScaleY int
+	// Precision is the maximum number of decimal places of emitted coordinates. If zero, 2
+	// decimal places are used. If negative, coordinates are emitted unrounded.
+	Precision int
+	// DimensionPrecision is the maximum number of decimal places of the width, height, and viewBox
+	// of the output, which may be fractional in physical units or with a fractional origin. If
+	// zero, Precision is used. If negative, they are emitted unrounded.
+	DimensionPrecision int
+	// Unit is the unit of the width and height of the output: one of "px", "in", "cm", "mm",
+	// "pt", or "pc". If empty or unknown, "px" is used. For any other unit, the width and height
+	// are converted from pixels at DPI pixels per inch, and a viewBox in pixels is emitted so
+	// that the diagram prints at a known physical size.
+	Unit string
+	// DPI is the number of pixels per inch assumed when converting to physical units. If zero,
+	// the CSS resolution of 96 is used.
+	DPI float64
+	// Defs is inserted verbatim in the defs element of the output, e.g. to define filters or
+	// gradients that objects refer to from their options.
+	Defs string
+	// Accessible wraps each closed object in a group with the img role and an aria-label,
+	// naming it after the text it contains, so that screen readers can announce it.
+	Accessible bool
+	// GroupObjects wraps each object in its own group, carrying the id, tag, and grid coordinate
+	// of the object as data-a2s-id, data-a2s-tag, and data-a2s-x and data-a2s-y attributes.
+	GroupObjects bool
+	// PointData wraps each object in its own group as GroupObjects does, with the grid
+	// coordinates of the points of the object, as "x,y" pairs separated by spaces, in a
+	// data-a2s-points attribute, so that the output can be edited back into a diagram.
+	PointData bool
+	// Symbols defines closed objects of identical shape once, as a symbol, and renders each of
+	// them as a use of the symbol, which reduces the size of the output.
+	Symbols bool
+	// MinBrightness and MinDifference are the brightness difference and the color difference
+	// between black text and the fill of its box below which the text is rendered white
+	// instead. If zero, the recommended 125 and 500 are used, respectively.
+	MinBrightness, MinDifference int
+	// Rotate is the clockwise rotation of the output in degrees: one of 0, 90, 180, or 270.
+	// Rotating by 90 or 270 degrees swaps the width and height of the output.
+	Rotate int
+	// OriginX and OriginY offset all the coordinates of the output, in pixels, so that renders of
+	// several canvases can be positioned within a larger composite. The viewBox of the output is
+	// offset along, so that it still shows the whole diagram on its own.
+	OriginX, OriginY float64
+	// Mirror flips the output horizontally, before it is rotated.
+	Mirror bool
+	// RoundTo rounds the width and height of the output up to a multiple of the given number of
+	// pixels, e.g. to tile diagrams, centering the diagram within the added space. If zero or
+	// one, the output is sized to fit the diagram.
+	RoundTo int
+	// ShadeLanes shades every other lane of the diagram, starting with the first.
+	ShadeLanes bool
+	// NoText skips rendering text objects, so that only the paths of the diagram are emitted.
+	NoText bool
+	// Watermark is the text of the comment at the top of the output. If empty, "Created with
+	// ASCIItoSVG" is used.
+	Watermark string
+	// NoWatermark omits the comment at the top of the output.
+	NoWatermark bool
+	// TickGlyph and DotGlyph are the glyphs drawn on the ticks ("x") and dots ("o") of lines:
+	// one of "cross", "plus", "dot", "circle" (hollow), or "square". If empty or unknown,
+	// "cross" and "dot" are used, respectively. Lines may select their own glyphs with their
+	// a2s:tick and a2s:dot options.
+	TickGlyph, DotGlyph string
+	// LetterSpacing is the spacing between the letters of text in pixels, which may be negative
+	// to tighten text. Text may set its own spacing with the letter-spacing option of its tag.
+	LetterSpacing float64
+	// FontUnit is the unit of the font size of text: "px", "em", "rem", or any of the physical
+	// units of Unit. The font size is converted to the unit so that text keeps its size. If
+	// empty or unknown, "px" is used.
+	FontUnit string
+	// Edges draws arrows between two boxes that are interrupted by a label, as in
+	// "|A|--label-->|B|", as a single line from the wall of one box to the wall of the other,
+	// with the label centered above it, clear of both boxes.
+	Edges bool
+	// SnapEnds moves the ends of lines that stop next to the wall of a polygon onto the wall, so
+	// that they meet it flush. Ends with markers are left in place.
+	SnapEnds bool
+	// Joins bridges the ends of lines that stop next to another line, continuing into it, so
+	// that the tee they form reads as connected. Ends with markers are left as they are.
+	Joins bool
+	// Bubbles draws boxes with a tail of one to three '/' or '\' leaving a cell of their wall, as
+	// in a comment callout, as speech bubbles: the outline of the box runs out to the tip of the
+	// tail, which is not drawn as a line of its own.
+	Bubbles bool
+	// Routing is the style in which lines are drawn: "elbow" draws each line from its start to
+	// its end with a single rounded bend, and "straight" draws it as a straight line between
+	// them. Their ticks and dots are moved along with them, at the same fraction of their
+	// length. If empty, lines are drawn as they are in the diagram. Lines may select their own
+	// style with their a2s:routing option.
+	Routing string
+	// Avoid reroutes the lines drawn in a routing style around the boxes they would otherwise
+	// cross, other than the boxes at their ends: elbows bend the other way, and lines detour
+	// along the row or column just past the box in their way. It is best-effort: lines for which
+	// no detour is clear are left crossing the box.
+	Avoid bool
+	// CurveLength draws the lines of at least that many cells that bend as a smooth curve through
+	// their bends, rather than as a polyline, so that connectors across the diagram stand out
+	// from what they cross. Lines mixing solid and dashed segments are left as they are. If zero,
+	// no line is curved.
+	CurveLength int
+	// Legend appends a legend below the diagram, with a swatch of the fill and the label of each
+	// tag used by the diagram that has both a fill and an a2s:label option.
+	Legend bool
+	// Separators renders horizontal rules, lines across most of the width of the diagram to which
+	// nothing is connected, as thin separators spanning the full width of the output.
+	Separators bool
+	// WrapText word-wraps text within a box that would otherwise overflow its right wall, such
+	// as long labels, onto as many lines as needed.
+	WrapText bool
+	// OpenArrows draws arrowheads as open chevrons rather than filled triangles. Lines may
+	// select either style with their a2s:marker option, set to "open" or "filled".
+	OpenArrows bool
+	// Stylesheet is the URL of an external CSS stylesheet styling the output, e.g. one shared by
+	// the diagrams of a site. If set, the output references it with an xml-stylesheet processing
+	// instruction, and its elements are identified by class instead of carrying the default
+	// presentation attributes: a2s-closed, a2s-lines, a2s-text, a2s-dark and a2s-light text,
+	// a2s-dashed, a2s-separator, a2s-tick, a2s-dot, a2s-circle, a2s-square, a2s-lanes,
+	// a2s-legend, a2s-legend-text, a2s-label, a2s-leader, a2s-caption, a2s-highlights,
+	// a2s-minimap, and a2s-frame. The options of tags are still emitted as attributes, as are the
+	// references to markers and filters, which a stylesheet would resolve against its own URL.
+	Stylesheet string
+	// Highlight lists the objects to highlight, e.g. the selection of an editor, by their id in
+	// the output, like "closed0", or by their tag. Highlighted objects are covered by a
+	// translucent overlay across their bounds, below the text.
+	Highlight []string
+	// Clip renders only the objects intersecting the given rectangle of grid cells, e.g. to export
+	// a cropped view of a large diagram. The output is sized to the rectangle as it would be to a
+	// diagram of that size, and its top left cell is moved to the top left of the output. If
+	// empty, the whole diagram is rendered.
+	Clip image.Rectangle
+	// Palette fills the tagged closed objects that have no fill of their own with one of its
+	// colors, picked by a hash of their tag, so that objects with the same tag get the same color
+	// across renders without setting it. If empty, such objects are left unfilled.
+	Palette []string
+	// Taper draws lines thinner over the last cell before their markers, so that they narrow
+	// toward their arrowheads, for presentation diagrams. Curved lines and lines mixing solid
+	// and dashed segments are left as they are.
+	Taper bool
+	// ReducedMotion omits the animations of objects with the a2s:animate option, which are
+	// then rendered as they appear at the end of their animation, for viewers who prefer
+	// reduced motion.
+	ReducedMotion bool
+	// Legacy reproduces the conventions of the output of the original ASCIIToSVG, for users
+	// migrating from it: text is sized at 0.95 times the height of a cell and offset by -0.6
+	// cells horizontally and 0.3 cells vertically, and closed objects cast an unblurred
+	// drop-shadow when blur is disabled, rather than none. Markers are sized the same in both.
+	Legacy bool
+	// Frame outlines the bounds of the content of the diagram, the tightest rectangle around all
+	// of its objects, with a dashed rectangle, to check its layout, cropping and margins.
+	Frame bool
+	// Sketch jitters the lines and polygons so that the diagram looks drawn by hand, for drafts.
+	Sketch bool
+	// Seed is the seed of the jitter of Sketch, passed through to the turbulence of the filter
+	// displacing the lines: the output only differs by the seed of the filter, and viewers render
+	// the same jitter for the same seed. Sketches rendered with the same seed are identical, so
+	// the output is deterministic, including with the zero value, and can be cached or compared.
+	Seed int
+	// Minimap draws an overview of the diagram in its top right corner, with the bounds of its
+	// objects scaled down by the given factor, e.g. 0.1, to help navigate large diagrams in
+	// interactive viewers. It shows the view of Clip, if any, and turns with the diagram when it
+	// is rotated or mirrored. If zero, no minimap is drawn.
+	Minimap float64
+}
+
+// unitsPerInch maps the supported physical units to their length in an inch.
+var unitsPerInch = map[string]float64{
+	"in": 1,
+	"cm": 2.54,
+	"mm": 25.4,
+	"pt": 72,
+	"pc": 6,
+}
+
 // CanvasToSVG renders the supplied asciitosvg.Canvas to SVG, based on the supplied options.
 func CanvasToSVG(c Canvas, noBlur bool, font string, scaleX, scaleY int) []byte {
-	if len(font) == 0 {
-		font = defaultFont
+	return CanvasToSVGWithOptions(c, RenderOptions{
+		NoBlur: noBlur,
+		Font:   font,
+		ScaleX: scaleX,
+		ScaleY: scaleY,
+	})
+}
+
+// CanvasToSVGWithOptions renders the supplied asciitosvg.Canvas to SVG, based on the supplied
+// RenderOptions.
+func CanvasToSVGWithOptions(c Canvas, opts RenderOptions) []byte {
+	return CanvasToSVGFiltered(c, nil, opts)
+}
+
+// CanvasToSVGFiltered renders the objects of the supplied asciitosvg.Canvas for which keep returns
+// true. A nil keep renders all objects. Rendered objects retain the identifiers they would have in
+// a render of the full Canvas, so that renders of different subsets can be layered.
+func CanvasToSVGFiltered(c Canvas, keep func(Object) bool, opts RenderOptions) []byte {
+	return Render(c, keep, opts).SVG
+}
+
+// A RenderResult is the output of a render along with the colors the objects were rendered with.
+type RenderResult struct {
+	// SVG is the rendered output.
+	SVG []byte
+	// Colors maps the index of each rendered polygon, text, and labeled line to its colors.
+	Colors map[int]Colors
+}
+
+// Colors are the colors an object was rendered with, as they appear in the output.
+type Colors struct {
+	// Fill is the fill of a polygon, or of the chip below the label of a line. It is "none" for
+	// a polygon that isn't filled, and empty for a label without a chip or for a polygon whose
+	// fill is left to a stylesheet.
+	Fill string
+	// Text is the color of a text, or of the label of a line.
+	Text string
+}
+
+// Render renders the supplied asciitosvg.Canvas like CanvasToSVGFiltered, and also returns the
+// colors resolved for each object, such as the colors picked for text to contrast with the
+// fill of its box.
+func Render(c Canvas, keep func(Object) bool, opts RenderOptions) RenderResult {
+	r := newRenderer(c, keep, opts)
+	end := r.writeHeader(r.defs())
+
+	// 3 passes, first closed paths, then open paths, then text, with the lanes behind them and
+	// the overlays between the paths and the text.
+	r.writeLanes()
+	r.writeClosed()
+	r.writeLines()
+	r.writeOverlays()
+	if !opts.NoText {
+		r.writeText()
 	}
 
-	// TODO(dhobsd): Generating the XML manually is a tad fishy but encoding/xml
-	// enforces standard XML header and the end code would be significantly
-	// larger. The down side is potential escaping errors.
-	b := &bytes.Buffer{}
-	io.WriteString(b, header)
-	io.WriteString(b, watermark)
-	fmt.Fprintf(b, svgTag, (c.Size().X+1)*scaleX, (c.Size().Y+1)*scaleY)
-	x := float64(scaleX - 1)
-	y := float64(scaleY - 1)
-	fmt.Fprintf(b, blurDef, x, y, x, y)
-
-	options := c.Options()
-	getOpts := func(tag string) string {
-		opts := ""
-		if options, ok := options[tag]; ok {
-			for k, v := range options {
-				if strings.HasPrefix(k, "a2s:") {
-					continue
-				}
+	io.WriteString(r.b, end)
+	return RenderResult{SVG: r.b.Bytes(), Colors: r.colors}
+}
 
-				switch v.(type) {
-				case string:
-					opts += fmt.Sprintf("%s=\"%s\" ", k, v.(string))
-				default:
-					// TODO(dhobsd): Implement.
-					opts += fmt.Sprintf("%s=\"UNIMPLEMENTED\" ", k)
-				}
+// renderer holds the state shared by the passes of Render: the options of the render, and what is
+// found about the objects before they are written.
+type renderer struct {
+	c       Canvas
+	opts    RenderOptions
+	pr      projection
+	options map[string]map[string]interface{}
+	font    string
+	b       *bytes.Buffer
+	colors  map[int]Colors
+	// view is the rectangle of grid cells rendered.
+	view image.Rectangle
+	// skip returns true for the objects left out of the render. Objects are filtered in each pass
+	// rather than up front so that the remaining objects keep their indices.
+	skip func(Object) bool
+	// minBrightness and minDifference pick the color of text on a fill, as in textColor.
+	minBrightness, minDifference int
+
+	// bubbles maps the boxes drawn as speech bubbles to their bubble.
+	bubbles map[Object]bubble
+	// walls are the walls of closed objects, onto which the ends of lines are snapped.
+	walls map[image.Point]bool
+	// lines maps the points of lines to their index, onto which the ends of other lines are
+	// joined.
+	lines map[image.Point]int
+	// boxes are the boxes that routed lines avoid.
+	boxes []Object
+	// edges, edgeLabels and edgeHeads map the tail, the label and the head of the lines
+	// interrupted by their label to their edge.
+	edges, edgeLabels map[int]edge
+	edgeHeads         map[int]bool
+	// legend lists the tags summarized in the legend, which is legendHeight pixels high.
+	legend       []string
+	legendHeight int
+	// caption is the caption of the diagram, if any.
+	caption string
+
+	// filters maps closed objects to the id of their drop-shadow filter, which is empty for
+	// objects without a drop-shadow.
+	filters map[int]string
+	// symbols maps closed objects to the id of the symbol they are rendered as a use of.
+	symbols map[int]string
+	// clips maps objects to the index of the box clipping them.
+	clips map[int]int
+	// sketch is the attributes jittering the groups of lines and polygons of sketches.
+	sketch string
+}
+
+// newRenderer returns a renderer of the objects of c for which keep returns true, or all of them
+// if keep is nil, which has found what the passes of the render need to know about the objects.
+func newRenderer(c Canvas, keep func(Object) bool, opts RenderOptions) *renderer {
+	r := &renderer{
+		c:             c,
+		opts:          opts,
+		pr:            newProjection(opts),
+		options:       paletteFills(c, validFills(c.Options()), opts.Palette),
+		font:          opts.Font,
+		b:             &bytes.Buffer{},
+		colors:        map[int]Colors{},
+		view:          image.Rect(0, 0, c.Size().X, c.Size().Y),
+		minBrightness: opts.MinBrightness,
+		minDifference: opts.MinDifference,
+		bubbles:       map[Object]bubble{},
+		walls:         map[image.Point]bool{},
+		lines:         map[image.Point]int{},
+		edges:         map[int]edge{},
+		edgeLabels:    map[int]edge{},
+		edgeHeads:     map[int]bool{},
+		filters:       map[int]string{},
+		symbols:       map[int]string{},
+		clips:         map[int]int{},
+	}
+	if len(r.font) == 0 {
+		r.font = defaultFont
+	}
+	if !opts.Clip.Empty() {
+		r.view = opts.Clip
+	}
+	if r.minBrightness == 0 {
+		r.minBrightness = defaultMinBrightness
+	}
+	if r.minDifference == 0 {
+		r.minDifference = defaultMinDifference
+	}
+	r.skip = func(o Object) bool {
+		return keep != nil && !keep(o) || !opts.Clip.Empty() && !Bounds(o).Overlaps(r.view)
+	}
+
+	// The tails of bubbles are drawn as part of the outline of their box, so their lines are
+	// skipped.
+	if opts.Bubbles {
+		stubs := map[Object]bool{}
+		for _, b := range findBubbles(c, func(o Object) bool { return !r.skip(o) }) {
+			r.bubbles[c.Objects()[b.box]] = b
+			stubs[c.Objects()[b.stub]] = true
+		}
+		visible := r.skip
+		r.skip = func(o Object) bool {
+			return visible(o) || stubs[o]
+		}
+	}
+
+	if opts.SnapEnds {
+		for _, obj := range c.Objects() {
+			if !obj.IsClosed() || obj.IsText() || r.skip(obj) {
+				continue
+			}
+			for _, p := range FullPoints(obj) {
+				r.walls[image.Point{X: p.X, Y: p.Y}] = true
 			}
 		}
+	}
 
-		return opts
+	if opts.Avoid {
+		for _, obj := range c.Objects() {
+			if obj.IsClosed() && !obj.IsText() && !r.skip(obj) {
+				r.boxes = append(r.boxes, obj)
+			}
+		}
 	}
 
-	// 3 passes, first closed paths, then open paths, then text.
-	if noBlur {
-		io.WriteString(b, "  <g id=\"closed\" stroke=\"#000\" stroke-width=\"2\" fill=\"none\">\n")
-	} else {
-		io.WriteString(b, "  <g id=\"closed\" filter=\"url(#dsFilter)\" stroke=\"#000\" stroke-width=\"2\" fill=\"none\">\n")
+	// Lines interrupted by their label are drawn as a single edge, with the label above it. The
+	// edges are drawn in place of their tail, and their head is skipped.
+	if opts.Edges {
+		for _, e := range findEdges(c, func(o Object) bool { return !r.skip(o) }) {
+			r.edges[e.tail] = e
+			r.edgeLabels[e.label] = e
+			r.edgeHeads[e.head] = true
+		}
 	}
-	for i, obj := range c.Objects() {
-		if obj.IsClosed() && !obj.IsText() {
-			opts := ""
-			if obj.IsDashed() {
-				opts = "stroke-dasharray=\"5 5\" "
+
+	if opts.Joins {
+		for i, obj := range c.Objects() {
+			if obj.IsClosed() || obj.IsText() || r.skip(obj) {
+				continue
+			}
+			for _, p := range FullPoints(obj) {
+				r.lines[image.Point{X: p.X, Y: p.Y}] = i
 			}
+		}
+	}
 
+	// Tags used by the diagram with both a label and a fill are summarized in the legend, in the
+	// order they are first used.
+	if opts.Legend {
+		seen := map[string]bool{}
+		for _, obj := range c.Objects() {
 			tag := obj.Tag()
-			if tag == "" {
-				tag = "__a2s__closed__options__"
+			if tag == "" || seen[tag] || r.skip(obj) {
+				continue
+			}
+			seen[tag] = true
+			_, labeled := r.options[tag]["a2s:label"].(string)
+			_, filled := r.options[tag]["fill"].(string)
+			if labeled && filled {
+				r.legend = append(r.legend, tag)
+			}
+		}
+	}
+	if len(r.legend) != 0 {
+		r.legendHeight = len(r.legend)*r.pr.scaleY*3/2 + r.pr.scaleY/2
+	}
+
+	// The diagram may be captioned by the a2s:caption option of the a2s tag.
+	r.caption, _ = r.options[diagramTag]["a2s:caption"].(string)
+	return r
+}
+
+// defs returns the definitions of the render: the drop-shadows, symbols, markers and clip paths
+// that the objects refer to.
+func (r *renderer) defs() string {
+	c, pr, options := r.c, r.pr, r.options
+
+	// Closed objects with their own shadow options need their own filter, while the objects at
+	// each elevation share theirs, and those with a2s:shadow set to false have none.
+	defs := ""
+	defined := map[int]bool{}
+	if !r.opts.NoBlur {
+		for i, obj := range c.Objects() {
+			if !obj.IsClosed() || obj.IsText() || r.skip(obj) {
+				continue
+			}
+			if shadow, ok := options[obj.Tag()]["a2s:shadow"].(bool); ok && !shadow {
+				r.filters[i] = ""
+				continue
+			}
+			if s, ok := newShadow(options[obj.Tag()]); ok {
+				r.filters[i] = fmt.Sprintf("dsFilter%d", i)
+				defs += fmt.Sprintf(shadowDef, r.filters[i], pr.f(s.dx), pr.f(s.dy), pr.f(s.intensity), pr.f(s.blur))
+				continue
+			}
+			level, ok := elevation(options[obj.Tag()])
+			if !ok {
+				continue
+			}
+			r.filters[i] = ""
+			if level == 0 {
+				continue
+			}
+			r.filters[i] = fmt.Sprintf("dsElevation%d", level)
+			if !defined[level] {
+				defined[level] = true
+				s := elevations[level-1]
+				defs += fmt.Sprintf(shadowDef, r.filters[i], pr.f(s.dx), pr.f(s.dy), pr.f(s.intensity), pr.f(s.blur))
 			}
-			opts += getOpts(tag)
+		}
+	}
 
-			startLink, endLink := "", ""
-			if link, ok := options[tag]["a2s:link"]; ok {
-				startLink = link.(string)
-				endLink = "</a>"
+	// Closed objects of identical shape are defined once as a symbol, and each rendered as a use
+	// of the symbol.
+	if r.opts.Symbols {
+		shapes := map[string][]int{}
+		var order []string
+		for i, obj := range c.Objects() {
+			if !obj.IsClosed() || obj.IsText() || r.skip(obj) {
+				continue
+			}
+			points, radius := r.shape(obj)
+			d := pr.flatten(translate(points, points[0]), radius) + "Z"
+			if _, ok := shapes[d]; !ok {
+				order = append(order, d)
+			}
+			shapes[d] = append(shapes[d], i)
+		}
+		for _, d := range order {
+			if len(shapes[d]) < 2 {
+				continue
+			}
+			id := fmt.Sprintf("shape%d", shapes[d][0])
+			defs += fmt.Sprintf(symbolTag, id, d)
+			for _, i := range shapes[d] {
+				r.symbols[i] = id
 			}
+		}
+	}
 
-			fmt.Fprintf(b, pathTag, startLink, "closed", i, opts, flatten(obj.Points(), scaleX, scaleY)+"Z", endLink)
+	for _, obj := range c.Objects() {
+		if !obj.IsClosed() && !obj.IsText() && !r.skip(obj) && r.openMarkers(obj.Tag()) {
+			x := float64(pr.scaleX - 1)
+			y := float64(pr.scaleY - 1)
+			defs += fmt.Sprintf(openMarkerDef, x, y, x, y)
+			break
+		}
+	}
+	for _, obj := range c.Objects() {
+		if start, end := doubleMarkers(obj); !obj.IsClosed() && !r.skip(obj) && (start || end) {
+			x := float64(pr.scaleX - 1)
+			y := float64(pr.scaleY - 1)
+			defs += fmt.Sprintf(doubleMarkerDef, x, y, x, y)
+			break
 		}
 	}
-	io.WriteString(b, "  </g>\n")
 
-	io.WriteString(b, "  <g id=\"lines\" stroke=\"#000\" stroke-width=\"2\" fill=\"none\">\n")
+	// Lines of each color with markers need markers of their own, defined once per color and
+	// style in the order the lines are drawn.
+	colorMarkers := map[string]bool{}
 	for i, obj := range c.Objects() {
-		if !obj.IsClosed() && !obj.IsText() {
-			points := obj.Points()
-
-			opts := ""
-			if obj.IsDashed() {
-				opts += "stroke-dasharray=\"5 5\" "
-			}
-			if points[0].Hint == StartMarker {
-				opts += pathMarkStart
-			}
-			if points[len(points)-1].Hint == EndMarker {
-				opts += pathMarkEnd
-			}
-
-			for _, p := range points {
-				switch p.Hint {
-				case Dot:
-					sp := scale(p, scaleX, scaleY)
-					fmt.Fprintf(b, dotTag, sp.X, sp.Y)
-				case Tick:
-					p := scale(p, scaleX, scaleY)
-					p1, p2 := p, p
-					p1.X -= 4
-					p1.Y -= 4
-					p2.X += 4
-					p2.Y += 4
-					fmt.Fprintf(b, tickTag, p1.X, p1.Y, p2.X, p2.Y)
-
-					p1, p2 = p, p
-					p1.X += 4
-					p1.Y -= 4
-					p2.X -= 4
-					p2.Y += 4
-					fmt.Fprintf(b, tickTag, p1.X, p1.Y, p2.X, p2.Y)
-				}
+		if obj.IsClosed() || obj.IsText() || r.skip(obj) || r.edgeHeads[i] {
+			continue
+		}
+		color := r.markerColor(obj.Tag())
+		start, end := r.lineMarkers(i, obj)
+		startStyle, endStyle := r.markerStyles(i, obj)
+		for _, style := range []string{startStyle, endStyle} {
+			if key := style + "-" + color; color != "" && (start || end) && !colorMarkers[key] {
+				colorMarkers[key] = true
+				defs += colorMarkerDefs(pr, style, color)
 			}
+		}
+	}
 
-			tag := obj.Tag()
-			opts += getOpts(tag)
+	// The legacy output defines the drop-shadows with and without blur.
+	if r.opts.Legacy {
+		defs += legacyShadowDef
+	}
+
+	// Sketches jitter the groups of lines and polygons as a whole, by a sixth of a cell at most:
+	// half the scale of the displacement.
+	if r.opts.Sketch {
+		defs += fmt.Sprintf(sketchDef, r.opts.Seed, pr.f(float64(pr.scaleX)/3))
+		r.sketch = sketchAttrs
+	}
 
-			startLink, endLink := "", ""
-			if link, ok := options[tag]["a2s:link"]; ok {
-				startLink = link.(string)
-				endLink = "</a>"
+	// Boxes with the a2s:clip option clip the objects within them to their outline, so that
+	// nothing pokes out of a rounded frame. Objects are clipped by the innermost of them.
+	for i, frame := range c.Objects() {
+		if clip, _ := options[frame.Tag()]["a2s:clip"].(bool); !clip || !frame.IsClosed() || frame.IsText() || r.skip(frame) {
+			continue
+		}
+		points, radius := r.shape(frame)
+		defs += fmt.Sprintf(clipPathTag, i, pr.flatten(points, radius)+"Z")
+		for j, obj := range c.Objects() {
+			if j == i || r.skip(obj) || !frame.HasPoint(obj.Points()[0]) {
+				continue
+			}
+			if k, ok := r.clips[j]; !ok || Depth(c.Objects()[k]) < Depth(frame) {
+				r.clips[j] = i
 			}
-			fmt.Fprintf(b, pathTag, startLink, "open", i, opts, flatten(points, scaleX, scaleY), endLink)
 		}
 	}
-	io.WriteString(b, "  </g>\n")
+	return defs
+}
 
-	fmt.Fprintf(b, textGroupTag, escape(string(font)))
+// writeHeader writes the start of the output, up to the groups of the objects, with defs, and
+// returns the end of the output.
+func (r *renderer) writeHeader(defs string) string {
+	b, pr, opts, view := r.b, r.pr, r.opts, r.view
 
-	findTextColor := func(o Object) (string, error) {
-		// If the tag on the text object is a special reference, that's the color we should use
-		// for the text.
-		if tag := o.Tag(); objTagRE.MatchString(tag) {
-			if fill, ok := options[tag]["fill"]; ok {
-				return fill.(string), nil
-			}
+	// TODO(dhobsd): Generating the XML manually is a tad fishy but encoding/xml
+	// enforces standard XML header and the end code would be significantly
+	// larger. The down side is potential escaping errors.
+	if opts.Stylesheet != "" {
+		fmt.Fprintf(b, stylesheetPI, escape(opts.Stylesheet))
+	}
+	io.WriteString(b, header)
+	writeWatermark(b, opts)
+	captionHeight := 0
+	if r.caption != "" {
+		captionHeight = pr.scaleY * 2
+	}
+
+	transform, width, height := orient(opts, (view.Dx()+1)*pr.scaleX, (view.Dy()+1)*pr.scaleY+r.legendHeight+captionHeight)
+	if view.Min != (image.Point{}) {
+		// The view is moved to the top left before it is oriented.
+		transform = strings.TrimSpace(fmt.Sprintf("%s translate(%d %d)", transform, -view.Min.X*pr.scaleX, -view.Min.Y*pr.scaleY))
+	}
+	transform, width, height = roundSize(pr, opts.RoundTo, transform, width, height)
+	if transform != "" && (pr.originX != 0 || pr.originY != 0) {
+		// The transforms apply to the diagram as if it were at the top left.
+		transform = fmt.Sprintf("translate(%s %s) %s translate(%s %s)", pr.f(pr.originX), pr.f(pr.originY), transform, pr.f(-pr.originX), pr.f(-pr.originY))
+	}
+	writeSVGTag(b, pr, opts, width, height)
+	x := float64(pr.scaleX - 1)
+	y := float64(pr.scaleY - 1)
+	fmt.Fprintf(b, blurDef, x, y, x, y, defs+opts.Defs)
+	end := "</svg>\n"
+	if transform != "" {
+		fmt.Fprintf(b, "  <g transform=\"%s\">\n", transform)
+		end = "  </g>\n" + end
+	}
+	return r.writeMinimap() + end
+}
+
+// writeLanes shades alternate lanes, behind everything else. Shading extends to the middle of the
+// surrounding cells, where dividers are drawn.
+func (r *renderer) writeLanes() {
+	if !r.opts.ShadeLanes {
+		return
+	}
+	b, pr := r.b, r.pr
+	fmt.Fprintf(b, groupTag, "lanes", pr.style("a2s-lanes", "stroke=\"none\" fill=\"#f2f2f2\""))
+	for i, l := range Lanes(r.c) {
+		if i%2 != 0 {
+			continue
 		}
+		x, y := pr.at((float64(l.Bounds.Min.X)-.5)*float64(pr.scaleX), (float64(l.Bounds.Min.Y)-.5)*float64(pr.scaleY))
+		w, h := float64((l.Bounds.Dx()+1)*pr.scaleX), float64((l.Bounds.Dy()+1)*pr.scaleY)
+		fmt.Fprintf(b, laneTag, i, pr.f(x), pr.f(y), pr.f(w), pr.f(h))
+	}
+	io.WriteString(b, "  </g>\n")
+}
 
-		// Otherwise, find the most specific fill and calibrate the color based on that.
-		if containers := c.EnclosingObjects(o.Points()[0]); containers != nil {
-			for _, container := range containers {
-				if tag := container.Tag(); tag != "" {
-					if fill, ok := options[tag]["fill"]; ok {
-						if fill == "none" {
-							continue
-						}
+// writeClosed writes the closed paths. The drop-shadow filter is applied to each closed path
+// rather than to the group, so that it can vary per object.
+func (r *renderer) writeClosed() {
+	b, pr, options := r.b, r.pr, r.options
+	fmt.Fprintf(b, groupTag, "closed", pr.style("a2s-closed", pathStrokes)+r.sketch)
+	for i, obj := range r.c.Objects() {
+		if !obj.IsClosed() || obj.IsText() || r.skip(obj) {
+			continue
+		}
+		attrs := pr.dashes(obj.IsDashed())
 
-						return textColor(fill.(string))
-					}
-				}
+		tag := r.closedTag(obj)
+		// The object is wrapped in groups naming it for accessibility, and clipping it if it is a
+		// use, as the clip path of a use would be moved along by its translation.
+		attrs += r.getOpts(tag) + weight(options[tag])
+		startWrap, endWrap := "", ""
+		if _, ok := r.symbols[i]; !ok {
+			attrs += r.clip(i)
+		} else if k, ok := r.clips[i]; ok {
+			startWrap, endWrap = fmt.Sprintf(clipGroupTag, k), "</g>"
+		}
+		if _, ok := options[tag]["fill"]; !ok {
+			if f, ok := r.fill(tag); ok {
+				attrs += fmt.Sprintf("fill=\"%s\" ", f)
+			}
+		}
+		r.colors[i] = Colors{Fill: r.closedFill(tag)}
+		if r.opts.Accessible {
+			if label := r.ariaLabel(obj); label != "" {
+				startWrap, endWrap = fmt.Sprintf(ariaGroupTag, escape(label))+startWrap, endWrap+"</g>"
 			}
 		}
+		if _, ok := options[tag]["filter"]; !ok && !r.opts.NoBlur {
+			if id, ok := r.filters[i]; !ok {
+				attrs += "filter=\"url(#dsFilter)\" "
+			} else if id != "" {
+				attrs += fmt.Sprintf("filter=\"url(#%s)\" ", id)
+			}
+		} else if !ok && r.opts.Legacy {
+			attrs += "filter=\"url(#dsFilterNoBlur)\" "
+		}
+		startLink, endLink := r.wrap(tag)
+		startGroup, endGroup := r.group(objectID(i, obj), obj)
+		animation, child := r.animate(tag, !obj.IsDashed())
+		attrs += animation
 
-		// Default to black.
-		return "#000", nil
+		if id, ok := r.symbols[i]; ok {
+			origin := obj.Points()[0]
+			x, y := float64(origin.X*pr.scaleX), float64(origin.Y*pr.scaleY)
+			if child != "" {
+				fmt.Fprintf(b, animatedUseTag, startGroup+startLink+startWrap, "closed", i, attrs, id, pr.f(x), pr.f(y), child, endWrap+endLink+endGroup)
+				continue
+			}
+			fmt.Fprintf(b, useTag, startGroup+startLink+startWrap, "closed", i, attrs, id, pr.f(x), pr.f(y), endWrap+endLink+endGroup)
+			continue
+		}
+		if child != "" {
+			fmt.Fprintf(b, animatedPathTag, startGroup+startLink+startWrap, "closed", i, attrs, pr.flatten(r.shape(obj))+"Z", child, endWrap+endLink+endGroup)
+			continue
+		}
+		fmt.Fprintf(b, pathTag, startGroup+startLink+startWrap, "closed", i, attrs, pr.flatten(r.shape(obj))+"Z", endWrap+endLink+endGroup)
 	}
+	io.WriteString(b, "  </g>\n")
+}
 
+// writeLines writes the open paths, along with their ticks, dots and joins.
+func (r *renderer) writeLines() {
+	c, b, pr, opts, options := r.c, r.b, r.pr, r.opts, r.options
+	fmt.Fprintf(b, groupTag, "lines", pr.style("a2s-lines", pathStrokes)+r.sketch)
 	for i, obj := range c.Objects() {
-		if obj.IsText() {
-			// Look up the fill of the containing box to determine what text color to use.
-			color, err := findTextColor(obj)
-			if err != nil {
-				fmt.Printf("Error figuring out text color: %s\n", err)
+		if obj.IsClosed() || obj.IsText() || r.skip(obj) || r.edgeHeads[i] {
+			continue
+		}
+		points := FullPoints(obj)
+		tag := obj.Tag()
+
+		if e, ok := r.edges[i]; ok {
+			startStyle, endStyle := r.markerStyles(i, obj)
+			markStart, markEnd := e.from.Hint == StartMarker, e.to.Hint == EndMarker
+			color := r.markerColor(tag)
+			styles := r.getOpts(tag) + weight(options[tag]) + r.clip(i)
+			startLink, endLink := r.wrap(tag)
+			startGroup, endGroup := r.group(objectID(i, obj), obj)
+
+			// The edge is drawn straight across its label. Like a line, it is drawn as a group of
+			// paths when its tail and head mix solid and dashed segments.
+			runs := dashRuns(e.points(c))
+			if len(runs) == 1 {
+				attrs := pr.dashes(runs[0].dashed) + markers(markStart, markEnd, startStyle, endStyle, color) + styles
+				fmt.Fprintf(b, pathTag, startGroup+startLink, "open", i, attrs, pr.flatten([]Point{e.from, e.to}, 0), endLink+endGroup)
+				continue
+			}
+			fmt.Fprintf(b, pathGroupTag, startGroup+startLink, "open", i, styles, "")
+			for k, run := range runs {
+				attrs := pr.dashes(run.dashed) + markers(markStart && k == 0, markEnd && k == len(runs)-1, startStyle, endStyle, color)
+				fmt.Fprintf(b, subPathTag, attrs, pr.flatten([]Point{run.points[0], run.points[len(run.points)-1]}, 0))
 			}
+			fmt.Fprintf(b, pathGroupEndTag, endLink+endGroup)
+			continue
+		}
 
-			startLink, endLink := "", ""
-			text := string(obj.Text())
-			tag := obj.Tag()
-			if tag != "" {
-				if label, ok := options[tag]["a2s:label"]; ok {
-					text = label.(string)
-				}
+		if opts.Separators && isSeparator(c, obj) {
+			attrs := pr.dashes(obj.IsDashed()) + r.getOpts(tag)
+			if _, ok := options[tag]["stroke-width"]; !ok {
+				attrs += pr.style("a2s-separator", "stroke-width=\"1\" ")
+			}
+			y := pr.scale(points[0]).Y
+			x1, _ := pr.at(float64(r.view.Min.X*pr.scaleX), 0)
+			x2, _ := pr.at(float64((r.view.Max.X+1)*pr.scaleX), 0)
+			startLink, endLink := r.wrap(tag)
+			startGroup, endGroup := r.group(objectID(i, obj), obj)
+			fmt.Fprintf(b, separatorTag, startGroup+startLink, i, pr.f(x1), pr.f(y), pr.f(x2), pr.f(y), attrs, endLink+endGroup)
+			continue
+		}
 
-				// If we're a reference, the a2s:delref tag informs us to remove our reference.
-				// TODO(dhobsd): If text is on column 0 but is not a special reference,
-				// we can't really detect that here.
-				if obj.Corners()[0].X == 0 {
-					if _, ok := options[tag]["a2s:delref"]; ok {
-						continue
-					}
+		markStart, markEnd := r.lineMarkers(i, obj)
+
+		// The line is drawn along the routed points, with its ticks and dots carried onto them.
+		drawn, radius := r.shape(obj)
+		if len(r.walls) != 0 {
+			drawn = snapEnds(drawn, r.walls)
+		}
+		routing := opts.Routing
+		if rt, ok := options[tag]["a2s:routing"].(string); ok {
+			routing = rt
+		}
+		drawn = route(drawn, routing)
+		if routing != "" && len(r.boxes) != 0 {
+			drawn = avoid(drawn, r.boxes, c.Size())
+		}
+
+		tick := glyphOf(opts.TickGlyph, options[tag]["a2s:tick"], "cross")
+		dot := glyphOf(opts.DotGlyph, options[tag]["a2s:dot"], "dot")
+		hints := scalePoints(pr, points)
+		if routing != "" {
+			hints = pr.carry(points, drawn)
+		}
+		for _, p := range hints {
+			switch p.Hint {
+			case Dot:
+				glyphs[dot](b, pr, p)
+			case Tick:
+				glyphs[tick](b, pr, p)
+			}
+		}
+
+		if len(r.lines) != 0 {
+			for _, end := range [][2]Point{{points[0], points[1]}, {points[len(points)-1], points[len(points)-2]}} {
+				if end[0].Hint == StartMarker || end[0].Hint == EndMarker {
+					continue
+				}
+				next, ok := beyond(end[0], end[1])
+				if j, found := r.lines[next]; ok && found && j != i {
+					from, to := pr.scale(end[0]), pr.scale(Point{X: next.X, Y: next.Y})
+					fmt.Fprintf(b, joinTag, pr.f(from.X), pr.f(from.Y), pr.f(to.X), pr.f(to.Y))
 				}
+			}
+		}
 
-				if link, ok := options[tag]["a2s:link"]; ok {
-					startLink = link.(string)
-					endLink = "</a>"
+		styles := r.getOpts(tag) + weight(options[tag]) + r.clip(i)
+		startStyle, endStyle := r.markerStyles(i, obj)
+		color := r.markerColor(tag)
+		startLink, endLink := r.wrap(tag)
+		startGroup, endGroup := r.group(objectID(i, obj), obj)
+
+		// A line mixing solid and dashed segments is drawn as a group of paths, one per run of
+		// either. Markers aren't set on the group as its paths would inherit them.
+		points = drawn
+		runs := dashRuns(points)
+		animation, child := r.animate(tag, len(runs) == 1 && !obj.IsDashed())
+		if len(runs) == 1 {
+			attrs := pr.dashes(obj.IsDashed()) + markers(markStart, markEnd, startStyle, endStyle, color) + styles + animation
+			d := pr.flatten(points, radius)
+			curved := opts.CurveLength > 0 && len(FullPoints(obj)) >= opts.CurveLength
+			if curved {
+				d = pr.curve(points)
+			}
+			if child != "" {
+				fmt.Fprintf(b, animatedPathTag, startGroup+startLink, "open", i, attrs, d, child, endLink+endGroup)
+				continue
+			}
+			if opts.Taper && !curved {
+				if body, first, last := taper(points, markStart, markEnd); first != nil || last != nil {
+					// The tips are drawn at half the width of the line.
+					thin := fmt.Sprintf(taperAttrs, pr.f(strokeWidth(options[tag])/2))
+					fmt.Fprintf(b, pathGroupTag, startGroup+startLink, "open", i, pr.dashes(obj.IsDashed())+styles, "")
+					fmt.Fprintf(b, subPathTag, markers(markStart && first == nil, markEnd && last == nil, startStyle, endStyle, color), pr.flatten(body, radius))
+					if first != nil {
+						fmt.Fprintf(b, subPathTag, thin, pr.flatten(first, 0))
+						fmt.Fprintf(b, subPathTag, carrierAttrs+markers(true, false, startStyle, endStyle, color), pr.flatten(first, 0))
+					}
+					if last != nil {
+						fmt.Fprintf(b, subPathTag, thin, pr.flatten(last, 0))
+						fmt.Fprintf(b, subPathTag, carrierAttrs+markers(false, true, startStyle, endStyle, color), pr.flatten(last, 0))
+					}
+					fmt.Fprintf(b, pathGroupEndTag, endLink+endGroup)
+					continue
 				}
 			}
-			sp := scale(obj.Points()[0], scaleX, scaleY)
-			fmt.Fprintf(b, textTag, startLink, i, sp.X, sp.Y, color, escape(text), endLink)
+			fmt.Fprintf(b, pathTag, startGroup+startLink, "open", i, attrs, d, endLink+endGroup)
+			continue
+		}
+		if child != "" {
+			child = "      " + child + "\n"
+		}
+		fmt.Fprintf(b, pathGroupTag, startGroup+startLink, "open", i, styles+animation, child)
+		for k, run := range runs {
+			attrs := pr.dashes(run.dashed) + markers(markStart && k == 0, markEnd && k == len(runs)-1, startStyle, endStyle, color)
+			fmt.Fprintf(b, subPathTag, attrs, pr.flatten(run.points, radius))
 		}
+		fmt.Fprintf(b, pathGroupEndTag, endLink+endGroup)
 	}
 	io.WriteString(b, "  </g>\n")
-
-	io.WriteString(b, "</svg>\n")
-	return b.Bytes()
 }
 
-func escape(s string) string {
-	b := &bytes.Buffer{}
-	if err := xml.EscapeText(b, []byte(s)); err != nil {
-		panic(err)
+// writeOverlays writes what is drawn over the paths, below the text: the legend, the caption, the
+// highlights, and the frame.
+func (r *renderer) writeOverlays() {
+	c, b, pr, opts, options, view := r.c, r.b, r.pr, r.opts, r.options, r.view
+	if len(r.legend) != 0 {
+		fmt.Fprintf(b, legendGroupTag, pr.style("a2s-legend", fmt.Sprintf(legendStyle, escape(r.font), pr.fontSize(opts.FontUnit))))
+		top := (view.Max.Y + 1) * pr.scaleY
+		for k, tag := range r.legend {
+			x, y := pr.at(float64((view.Min.X+1)*pr.scaleX), float64(top+k*pr.scaleY*3/2))
+			fmt.Fprintf(b, legendSwatchTag, pr.f(x), pr.f(y), pr.f(float64(2*pr.scaleX)), pr.f(float64(pr.scaleY)), options[tag]["fill"].(string))
+			fmt.Fprintf(b, legendTextTag, pr.f(x+float64(3*pr.scaleX)), pr.f(y+float64(pr.scaleY)*3/4), pr.style("a2s-legend-text", "stroke=\"none\" fill=\"#000\""), escape(options[tag]["a2s:label"].(string)))
+		}
+		io.WriteString(b, "  </g>\n")
 	}
-	return b.String()
-}
 
-type scaledPoint struct {
-	X    float64
-	Y    float64
-	Hint RenderHint
+	if r.caption != "" {
+		x, y := pr.at(float64(view.Min.X*pr.scaleX)+float64((view.Dx()+1)*pr.scaleX)/2, float64((view.Max.Y+1)*pr.scaleY+r.legendHeight)+float64(pr.scaleY)*5/4)
+		fmt.Fprintf(b, captionTag, pr.f(x), pr.f(y), pr.style("a2s-caption", fmt.Sprintf(captionStyle, escape(r.font), pr.fontSize(opts.FontUnit))), escape(r.caption))
+	}
+
+	if len(opts.Highlight) != 0 {
+		highlighted := map[string]bool{}
+		for _, h := range opts.Highlight {
+			highlighted[h] = true
+		}
+		started := false
+		for i, obj := range c.Objects() {
+			id := objectID(i, obj)
+			if r.skip(obj) || !highlighted[id] && (obj.Tag() == "" || !highlighted[obj.Tag()]) {
+				continue
+			}
+			if !started {
+				fmt.Fprintf(b, groupTag, "highlights", pr.style("a2s-highlights", highlightStyle))
+				started = true
+			}
+			bounds := Bounds(obj)
+			x, y := pr.at(float64(bounds.Min.X*pr.scaleX), float64(bounds.Min.Y*pr.scaleY))
+			w, h := float64(bounds.Dx()*pr.scaleX), float64(bounds.Dy()*pr.scaleY)
+			fmt.Fprintf(b, highlightTag, id, pr.f(x), pr.f(y), pr.f(w), pr.f(h))
+		}
+		if started {
+			io.WriteString(b, "  </g>\n")
+		}
+	}
+
+	if opts.Frame {
+		var bounds image.Rectangle
+		for _, obj := range c.Objects() {
+			if !r.skip(obj) {
+				bounds = bounds.Union(Bounds(obj))
+			}
+		}
+		if !bounds.Empty() {
+			x, y := pr.at(float64(bounds.Min.X*pr.scaleX), float64(bounds.Min.Y*pr.scaleY))
+			w, h := float64(bounds.Dx()*pr.scaleX), float64(bounds.Dy()*pr.scaleY)
+			fmt.Fprintf(b, frameTag, pr.f(x), pr.f(y), pr.f(w), pr.f(h), pr.style("a2s-frame", frameStyle))
+		}
+	}
+}
+
+// writeText writes the text objects, and the labels of lines.
+func (r *renderer) writeText() {
+	c, b, pr, opts, options := r.c, r.b, r.pr, r.opts, r.options
+	textAttrs := pr.style("a2s-text", fmt.Sprintf(textStyle, escape(r.font), pr.fontSize(opts.FontUnit)))
+	if opts.LetterSpacing != 0 {
+		textAttrs += fmt.Sprintf("letter-spacing=\"%s\" ", pr.f(opts.LetterSpacing))
+	}
+	fmt.Fprintf(b, textGroupTag, textAttrs)
+
+	// The text of the boxes with the a2s:pre option keeps the spaces aligning its words.
+	var pre []image.Rectangle
+	for _, obj := range c.Objects() {
+		if v, _ := options[obj.Tag()]["a2s:pre"].(bool); v && obj.IsClosed() && !obj.IsText() {
+			pre = append(pre, Bounds(obj).Inset(1))
+		}
+	}
+	preformatted := func(o Object) bool {
+		for _, p := range pre {
+			if !IsReference(o) && Bounds(o).In(p) {
+				return true
+			}
+		}
+		return false
+	}
+
+	for i, obj := range c.Objects() {
+		if !obj.IsText() || r.skip(obj) {
+			continue
+		}
+		// Look up the fill of the containing box to determine what text color to use. The text
+		// stays black on the fills that aren't plain colors, like a gradient; Validate reports them.
+		color, _ := r.findTextColor(obj)
+
+		startLink, endLink := "", ""
+		text := r.text(obj)
+		tag := obj.Tag()
+		if tag != "" {
+			// If we're a reference, the a2s:delref tag informs us to remove our reference.
+			if IsReference(obj) {
+				if _, ok := options[tag]["a2s:delref"]; ok {
+					continue
+				}
+			}
+
+			startLink, endLink = r.wrap(tag)
+		}
+		r.colors[i] = Colors{Text: color}
+		attrs := ""
+		if strings.HasPrefix(text, " ") || preformatted(obj) && strings.Contains(text, "  ") {
+			// Keep the indentation of the text, and the spaces aligning its words.
+			attrs = "xml:space=\"preserve\" "
+		}
+		if spacing, ok := options[tag]["letter-spacing"].(string); ok {
+			attrs += fmt.Sprintf("letter-spacing=\"%s\" ", escape(spacing))
+		}
+		attrs += r.clip(i)
+		// Text fades in with its own animation, or else along with the innermost animated box
+		// containing it.
+		animated := tag
+		if _, ok := options[tag]["a2s:animate"]; !ok {
+			containers := c.EnclosingObjects(obj.Points()[0])
+			for k := len(containers) - 1; k >= 0; k-- {
+				if _, ok := options[containers[k].Tag()]["a2s:animate"]; ok {
+					animated = containers[k].Tag()
+					break
+				}
+			}
+		}
+		animation, child := r.animate(animated, false)
+		attrs += animation
+		sp := pr.scale(obj.Points()[0])
+		if opts.Legacy {
+			sp.X += legacyTextDX * float64(pr.scaleX)
+			sp.Y += legacyTextDY * float64(pr.scaleY)
+		}
+		content := escape(text)
+		if opts.WrapText {
+			if containers := c.EnclosingObjects(obj.Points()[0]); len(containers) != 0 {
+				// Text is monospace, so the width available is the number of cells up to the
+				// right wall of the innermost box.
+				width := Bounds(containers[len(containers)-1]).Max.X - 1 - obj.Points()[0].X
+				if lines := wrapText(text, width); len(lines) > 1 {
+					content = ""
+					for k, l := range lines {
+						dy := ""
+						if k != 0 {
+							dy = fmt.Sprintf(" dy=\"%d\"", pr.scaleY)
+						}
+						content += fmt.Sprintf(tspanTag, pr.f(sp.X), dy, escape(l))
+					}
+				}
+			}
+		}
+		startGroup, endGroup := r.group(objectID(i, obj), obj)
+		if e, ok := r.edgeLabels[i]; ok {
+			// The label is centered above its edge, with its baseline half a cell above the line.
+			from, to := pr.scale(e.from), pr.scale(e.to)
+			x, y := (from.X+to.X)/2, from.Y-float64(pr.scaleY)/2
+			fmt.Fprintf(b, textTag, startGroup+startLink, i, pr.f(x), pr.f(y), attrs, pr.textFill(color, "a2s-label", "text-anchor=\"middle\" "), child+content, endLink+endGroup)
+			continue
+		}
+		if box := calloutBox(c, obj); box != nil {
+			// The label is drawn in black outside of its box, above it or to its right, with a
+			// leader line reaching back to the wall of the box.
+			bounds := Bounds(box)
+			anchor := ""
+			var x1, y1, x2, y2, x, y float64
+			switch options[tag]["a2s:callout"] {
+			case "above":
+				x1, y1 = pr.at(float64((bounds.Min.X+bounds.Max.X)*pr.scaleX)/2, (float64(bounds.Min.Y)+.5)*float64(pr.scaleY))
+				x2, y2 = x1, y1-float64(pr.scaleY)/2
+				x, y = x1, y1-float64(pr.scaleY)
+				anchor = "text-anchor=\"middle\" "
+			default:
+				x1, y1 = pr.at((float64(bounds.Max.X)-.5)*float64(pr.scaleX), float64((bounds.Min.Y+bounds.Max.Y)*pr.scaleY)/2)
+				x2, y2 = x1+float64(pr.scaleX)*3/2, y1
+				x, y = x1+float64(2*pr.scaleX), y1+float64(pr.scaleY)/4
+			}
+			r.colors[i] = Colors{Text: "#000"}
+			fmt.Fprintf(b, leaderTag, i, pr.f(x1), pr.f(y1), pr.f(x2), pr.f(y2), pr.style("a2s-leader", "stroke=\"#000\" stroke-width=\"1\" "))
+			fmt.Fprintf(b, textTag, startGroup+startLink, i, pr.f(x), pr.f(y), attrs, pr.textFill("#000", "a2s-label", anchor), child+escape(text), endLink+endGroup)
+			continue
+		}
+		fmt.Fprintf(b, textTag, startGroup+startLink, i, pr.f(sp.X), pr.f(sp.Y), attrs, pr.textFill(color, "", ""), child+content, endLink+endGroup)
+	}
+
+	r.writeLineLabels()
+	io.WriteString(b, "  </g>\n")
+}
+
+// writeLineLabels writes the labels of the lines labeled with a2s:label, centered on their
+// midpoint, or near their start or end as selected by a2s:label-pos, optionally on top of a chip
+// filled with the color given by a2s:chip (white if simply true).
+func (r *renderer) writeLineLabels() {
+	b, pr, options := r.b, r.pr, r.options
+	for i, obj := range r.c.Objects() {
+		if obj.IsClosed() || obj.IsText() || r.skip(obj) {
+			continue
+		}
+		tag := obj.Tag()
+		label, ok := options[tag]["a2s:label"].(string)
+		if !ok {
+			continue
+		}
+
+		points := FullPoints(obj)
+		i1, i2 := (len(points)-1)/2, len(points)/2
+		switch options[tag]["a2s:label-pos"] {
+		case "start":
+			if k := labelOffset(points[0], points[1], label); k < i1 {
+				i1, i2 = k, k
+			}
+		case "end":
+			if k := len(points) - 1 - labelOffset(points[len(points)-1], points[len(points)-2], label); k > i2 {
+				i1, i2 = k, k
+			}
+		}
+		p1, p2 := pr.scale(points[i1]), pr.scale(points[i2])
+		mid := scaledPoint{X: (p1.X + p2.X) / 2, Y: (p1.Y + p2.Y) / 2}
+
+		colors := r.labelColors(tag)
+		if colors.Fill != "" {
+			// Text is monospace, so the chip leaves half a cell of padding on either side.
+			w := float64((lineWidth([]byte(label)) + 1) * pr.scaleX)
+			h := float64(pr.scaleY)
+			fmt.Fprintf(b, chipTag, pr.f(mid.X-w/2), pr.f(mid.Y-h/2), pr.f(w), pr.f(h), pr.f(h/4), colors.Fill)
+		}
+
+		r.colors[i] = colors
+		startLink, endLink := r.wrap(tag)
+		fmt.Fprintf(b, lineLabelTag, startLink, i, pr.f(mid.X), pr.f(mid.Y+float64(pr.scaleY)/4), pr.textFill(colors.Text, "a2s-label", "text-anchor=\"middle\" "), escape(label), endLink)
+	}
+}
+
+// resolveColors resolves the colors of the objects as the passes of Render do, without rendering
+// them.
+func (r *renderer) resolveColors() map[int]Colors {
+	for i, obj := range r.c.Objects() {
+		if r.skip(obj) {
+			continue
+		}
+		tag := obj.Tag()
+		switch {
+		case obj.IsText():
+			if _, ok := r.options[tag]["a2s:delref"]; r.opts.NoText || ok && tag != "" && IsReference(obj) {
+				continue
+			}
+			color, _ := r.findTextColor(obj)
+			if calloutBox(r.c, obj) != nil {
+				color = "#000"
+			}
+			r.colors[i] = Colors{Text: color}
+		case obj.IsClosed():
+			r.colors[i] = Colors{Fill: r.closedFill(r.closedTag(obj))}
+		default:
+			if _, ok := r.options[tag]["a2s:label"].(string); ok && !r.opts.NoText {
+				r.colors[i] = r.labelColors(tag)
+			}
+		}
+	}
+	return r.colors
+}
+
+// closedTag returns the tag styling a closed object. Closed objects without any options of their
+// own are styled by default, unless the stylesheet styles them.
+func (r *renderer) closedTag(obj Object) string {
+	tag := obj.Tag()
+	if _, ok := r.options[tag]; !ok && !r.pr.classes {
+		tag = "__a2s__closed__options__"
+	}
+	return tag
+}
+
+// closedFill returns the fill resolved for closed objects styled by the tag: "none" if they aren't
+// filled, or empty if their fill is left to the stylesheet.
+func (r *renderer) closedFill(tag string) string {
+	fill, ok := r.fill(tag)
+	if !ok && !r.pr.classes {
+		fill = "none"
+	}
+	return fill
+}
+
+// labelColors returns the colors of the labels of lines with the tag: the fill of the chip given by
+// a2s:chip (white if simply true), if any, and the color of the text. The text stays black on the
+// fills that aren't plain colors, like a gradient.
+func (r *renderer) labelColors(tag string) Colors {
+	fill, ok := r.options[tag]["a2s:chip"].(string)
+	if chip, _ := r.options[tag]["a2s:chip"].(bool); chip {
+		fill, ok = defaultChipFill, true
+	}
+	if !ok {
+		return Colors{Text: "#000"}
+	}
+	color, _ := textColor(fill, r.minBrightness, r.minDifference)
+	return Colors{Fill: fill, Text: color}
+}
+
+// shape returns the points of an object along with the radius of its rounded corners. Objects
+// with an a2s:radius option have all their corners rounded with that radius, in cell widths, or
+// none at all if it is zero. Bubbles include their tail.
+func (r *renderer) shape(obj Object) ([]Point, float64) {
+	points, radius := FullPoints(obj), float64(cornerRadius)
+	if rad, ok := r.options[obj.Tag()]["a2s:radius"].(float64); ok {
+		points, radius = roundCorners(obj, rad > 0), rad*float64(r.pr.scaleX)
+	}
+	if b, ok := r.bubbles[obj]; ok {
+		points = b.outline(points)
+	}
+	return points, radius
+}
+
+// openMarkers returns true if the arrowheads of lines with the tag are open chevrons.
+func (r *renderer) openMarkers(tag string) bool {
+	switch r.options[tag]["a2s:marker"] {
+	case "open":
+		return true
+	case "filled":
+		return false
+	}
+	return r.opts.OpenArrows
+}
+
+// lineMarkers returns whether the line i is drawn with a start and an end marker. Markers are
+// inferred from the diagram, but may be forced on or off by tag.
+func (r *renderer) lineMarkers(i int, obj Object) (bool, bool) {
+	if e, ok := r.edges[i]; ok {
+		return e.from.Hint == StartMarker, e.to.Hint == EndMarker
+	}
+	points := obj.Points()
+	tag := obj.Tag()
+	markStart := points[0].Hint == StartMarker
+	if mark, ok := r.options[tag]["a2s:marker-start"].(bool); ok {
+		markStart = mark
+	}
+	markEnd := points[len(points)-1].Hint == EndMarker
+	if mark, ok := r.options[tag]["a2s:marker-end"].(bool); ok {
+		markEnd = mark
+	}
+	return markStart, markEnd
+}
+
+// markerStyles returns the style of the start and end markers of the line i: "Double" for doubled
+// arrowheads, "Open" for open chevrons, or "" for filled triangles.
+func (r *renderer) markerStyles(i int, obj Object) (string, string) {
+	style := ""
+	if r.openMarkers(obj.Tag()) {
+		style = "Open"
+	}
+	start, end := style, style
+	head := obj
+	if e, ok := r.edges[i]; ok {
+		head = r.c.Objects()[e.head]
+	}
+	if double, _ := doubleMarkers(obj); double {
+		start = "Double"
+	}
+	if _, double := doubleMarkers(head); double {
+		end = "Double"
+	}
+	return start, end
+}
+
+// markerColor returns the color of the arrowheads of lines with the tag, as the hexadecimal digits
+// of the color of their stroke, or "" for the default black arrowheads.
+func (r *renderer) markerColor(tag string) string {
+	stroke, _ := r.options[tag]["stroke"].(string)
+	red, green, blue, err := colorToRGB(stroke)
+	if err != nil || red == 0 && green == 0 && blue == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%02x%02x%02x", red, green, blue)
+}
+
+// clip returns the attribute clipping the object i, if any.
+func (r *renderer) clip(i int) string {
+	if k, ok := r.clips[i]; ok {
+		return fmt.Sprintf(clipAttrs, k)
+	}
+	return ""
+}
+
+// fill returns the fill of objects with the tag, if they have one. Objects with the a2s:invert
+// option are filled dark, unless they set a fill of their own. A fill that isn't a string is
+// replaced by defaultFill.
+func (r *renderer) fill(tag string) (string, bool) {
+	if f, ok := r.options[tag]["fill"]; ok {
+		if f, ok := f.(string); ok {
+			return f, true
+		}
+		return defaultFill, true
+	}
+	if invert, _ := r.options[tag]["a2s:invert"].(bool); invert {
+		return invertFill, true
+	}
+	return "", false
+}
+
+// getOpts returns the attributes set by the options of the tag.
+func (r *renderer) getOpts(tag string) string {
+	attrs := ""
+	if options, ok := r.options[tag]; ok {
+		// Emit options in a stable order so that renders of the same diagram are identical.
+		keys := make([]string, 0, len(options))
+		for k := range options {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			v := options[k]
+			if strings.HasPrefix(k, "a2s:") {
+				continue
+			}
+
+			switch v.(type) {
+			case string:
+				attrs += fmt.Sprintf("%s=\"%s\" ", k, v.(string))
+			default:
+				// TODO(dhobsd): Implement.
+				attrs += fmt.Sprintf("%s=\"UNIMPLEMENTED\" ", k)
+			}
+		}
+	}
+
+	return attrs
+}
+
+// wrap returns the markup surrounding the element of an object with the supplied tag: a clickable
+// link and a group applying a transform, if requested. A transform that isn't a string is ignored.
+func (r *renderer) wrap(tag string) (string, string) {
+	start, end := "", ""
+	if link, ok := r.options[tag]["a2s:link"]; ok {
+		start = link.(string)
+		end = "</a>"
+	}
+	if transform, ok := r.options[tag]["a2s:transform"].(string); ok {
+		start += fmt.Sprintf("<g transform=\"%s\">", escape(transform))
+		end = "</g>" + end
+	}
+	return start, end
+}
+
+// animate returns the attributes and the animation element of an object with the tag, if it is
+// animated by its a2s:animate option: "fade" fades it in, and "draw" draws its stroke from its
+// start, which only solid paths can be. The animation begins after the a2s:delay option. Nothing is
+// animated with reduced motion.
+func (r *renderer) animate(tag string, solid bool) (string, string) {
+	if r.opts.ReducedMotion {
+		return "", ""
+	}
+	delay, ok := r.options[tag]["a2s:delay"].(string)
+	if !ok {
+		delay = "0s"
+	}
+	switch r.options[tag]["a2s:animate"] {
+	case "draw":
+		if solid {
+			return drawAttrs, fmt.Sprintf(drawTag, escape(delay))
+		}
+		fallthrough
+	case "fade":
+		return fadeAttrs, fmt.Sprintf(fadeTag, escape(delay))
+	}
+	return "", ""
+}
+
+// group returns the markup of the group wrapping an object if each object is rendered in its own
+// group, identifying the object by its id, tag, and grid coordinate.
+func (r *renderer) group(id string, obj Object) (string, string) {
+	if !r.opts.GroupObjects && !r.opts.PointData {
+		return "", ""
+	}
+	tag := ""
+	if t := obj.Tag(); t != "" {
+		tag = fmt.Sprintf(" data-a2s-tag=\"%s\"", escape(t))
+	}
+	if r.opts.PointData {
+		coords := make([]string, 0, len(obj.Points()))
+		for _, p := range obj.Points() {
+			coords = append(coords, fmt.Sprintf("%d,%d", p.X, p.Y))
+		}
+		tag += fmt.Sprintf(" data-a2s-points=\"%s\"", strings.Join(coords, " "))
+	}
+	corner := obj.Corners()[0]
+	return fmt.Sprintf("<g data-a2s-id=\"%s\"%s data-a2s-x=\"%d\" data-a2s-y=\"%d\">", id, tag, corner.X, corner.Y), "</g>"
+}
+
+// text returns the text to render for a text object.
+func (r *renderer) text(o Object) string {
+	if label, ok := r.options[o.Tag()]["a2s:label"]; ok {
+		return label.(string)
+	}
+	return string(o.Text())
+}
+
+// ariaLabel returns the accessible name of a closed object: the text directly within it, in
+// reading order.
+func (r *renderer) ariaLabel(o Object) string {
+	var words []string
+	for _, t := range innerTexts(r.c, o) {
+		words = append(words, r.text(t))
+	}
+	return strings.Join(words, " ")
+}
+
+// findTextColor returns the color of a text object, picked to contrast with the fill of the box
+// containing it.
+func (r *renderer) findTextColor(o Object) (string, error) {
+	// If the tag on the text object is a special reference, that's the color we should use for
+	// the text.
+	if tag := o.Tag(); objTagRE.MatchString(tag) {
+		if fill, ok := r.options[tag]["fill"]; ok {
+			if fill, ok := fill.(string); ok {
+				return fill, nil
+			}
+			return "#000", nil
+		}
+	}
+
+	// Otherwise, find the most specific fill and calibrate the color based on that.
+	if containers := r.c.EnclosingObjects(o.Points()[0]); containers != nil {
+		for _, container := range containers {
+			if tag := container.Tag(); tag != "" {
+				if f, ok := r.fill(tag); ok {
+					if f == "none" {
+						continue
+					}
+
+					return textColor(f, r.minBrightness, r.minDifference)
+				}
+			}
+		}
+	}
+
+	// Default to black.
+	return "#000", nil
+}
+
+// innerTexts returns the text objects of c directly within the closed object o, rather than
+// within a box nested in it, in reading order.
+func innerTexts(c Canvas, o Object) []Object {
+	var out []Object
+	for _, t := range c.Objects() {
+		if !t.IsText() {
+			continue
+		}
+		if containers := c.EnclosingObjects(t.Points()[0]); len(containers) != 0 && containers[len(containers)-1] == o {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// calloutBox returns the box tagged by the reference text o if its tag has the a2s:callout option,
+// which moves the label of the box outside of it: "above" the box, or to its "right".
+func calloutBox(c Canvas, o Object) Object {
+	if !IsReference(o) {
+		return nil
+	}
+	switch c.Options()[o.Tag()]["a2s:callout"] {
+	case "above", "right":
+	default:
+		return nil
+	}
+	containers := c.EnclosingObjects(o.Points()[0])
+	for k := len(containers) - 1; k >= 0; k-- {
+		if containers[k].Tag() == o.Tag() {
+			return containers[k]
+		}
+	}
+	return nil
+}
+
+// objectID returns the id of the element of the object at index i in the output.
+func objectID(i int, o Object) string {
+	switch {
+	case o.IsText():
+		return fmt.Sprintf("obj%d", i)
+	case o.IsClosed():
+		return fmt.Sprintf("closed%d", i)
+	}
+	return fmt.Sprintf("open%d", i)
+}
+
+// wrapText breaks text into lines of at most width cells at its spaces. Words longer than width
+// are left on lines of their own.
+func wrapText(text string, width int) []string {
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(text) {
+		if line != "" && lineWidth([]byte(line))+1+lineWidth([]byte(word)) > width {
+			lines = append(lines, line)
+			line = ""
+		}
+		if line != "" {
+			line += " "
+		}
+		line += word
+	}
+	return append(lines, line)
+}
+
+// orient returns the transform to apply to the content of an output of width by height pixels
+// to mirror and rotate it as requested, along with the resulting width and height.
+func orient(opts RenderOptions, width, height int) (string, int, int) {
+	var transforms []string
+	rotate := (opts.Rotate%360 + 360) % 360
+	switch rotate {
+	case 90:
+		transforms = append(transforms, fmt.Sprintf("translate(%d 0) rotate(90)", height))
+	case 180:
+		transforms = append(transforms, fmt.Sprintf("translate(%d %d) rotate(180)", width, height))
+	case 270:
+		transforms = append(transforms, fmt.Sprintf("translate(0 %d) rotate(270)", width))
+	}
+	// The content is mirrored before it is rotated.
+	if opts.Mirror {
+		transforms = append(transforms, fmt.Sprintf("translate(%d 0) scale(-1 1)", width))
+	}
+	if rotate == 90 || rotate == 270 {
+		width, height = height, width
+	}
+	return strings.Join(transforms, " "), width, height
+}
+
+// roundSize rounds the width and height of an output up to a multiple of step pixels, and returns
+// them along with transform preceded by the translation centering the content within them.
+func roundSize(pr projection, step int, transform string, width, height int) (string, int, int) {
+	if step <= 1 {
+		return transform, width, height
+	}
+	w, h := (width+step-1)/step*step, (height+step-1)/step*step
+	if w == width && h == height {
+		return transform, width, height
+	}
+	center := fmt.Sprintf("translate(%s %s)", pr.f(float64(w-width)/2), pr.f(float64(h-height)/2))
+	return strings.TrimSpace(center + " " + transform), w, h
+}
+
+// validFills returns options with the fills and chip colors that aren't valid colors, like a
+// misspelled color name or a number, replaced by defaultFill and defaultChipFill so that the output
+// isn't broken. Validate reports them. The options of the canvas are left as they are.
+func validFills(options map[string]map[string]interface{}) map[string]map[string]interface{} {
+	out := make(map[string]map[string]interface{}, len(options))
+	for tag, o := range options {
+		out[tag] = o
+		fill, chip := badFill(o), badChip(o)
+		if !fill && !chip {
+			continue
+		}
+		fixed := make(map[string]interface{}, len(o))
+		for k, v := range o {
+			fixed[k] = v
+		}
+		if fill {
+			fixed["fill"] = defaultFill
+		}
+		if chip {
+			fixed["a2s:chip"] = defaultChipFill
+		}
+		out[tag] = fixed
+	}
+	return out
+}
+
+// badFill returns true if the options set a fill that isn't a valid color, or isn't a string.
+func badFill(o map[string]interface{}) bool {
+	f, ok := o["fill"]
+	if !ok {
+		return false
+	}
+	fill, ok := f.(string)
+	return !ok || !isValidColor(fill)
+}
+
+// badChip returns true if the options set a chip color that isn't a valid color, or is neither a
+// string nor a boolean, which turns the default chip on or off.
+func badChip(o map[string]interface{}) bool {
+	c, ok := o["a2s:chip"]
+	if !ok {
+		return false
+	}
+	switch chip := c.(type) {
+	case string:
+		return !isValidColor(chip)
+	case bool:
+		return false
+	}
+	return true
+}
+
+// paletteFills returns options with a fill from palette set for the tags of closed objects that
+// have no fill of their own, nor the a2s:invert option. The color is picked by a hash of the tag,
+// so that it doesn't depend on the other tags of the diagram. Tags without options get the default
+// options of closed objects along with their fill. The options of the canvas are left as they are.
+func paletteFills(c Canvas, options map[string]map[string]interface{}, palette []string) map[string]map[string]interface{} {
+	if len(palette) == 0 {
+		return options
+	}
+	out := make(map[string]map[string]interface{}, len(options))
+	for tag, o := range options {
+		out[tag] = o
+	}
+	for _, obj := range c.Objects() {
+		tag := obj.Tag()
+		if !obj.IsClosed() || obj.IsText() || tag == "" || tag == "__a2s__closed__options__" {
+			continue
+		}
+		o, ok := out[tag]
+		if !ok {
+			o = options["__a2s__closed__options__"]
+		}
+		if _, filled := o["fill"]; ok && filled {
+			continue
+		}
+		if invert, _ := o["a2s:invert"].(bool); invert {
+			continue
+		}
+		fixed := make(map[string]interface{}, len(o)+1)
+		for k, v := range o {
+			fixed[k] = v
+		}
+		h := fnv.New32a()
+		io.WriteString(h, tag)
+		fixed["fill"] = palette[h.Sum32()%uint32(len(palette))]
+		out[tag] = fixed
+	}
+	return out
+}
+
+// writeMinimap returns the minimap selected by opts, placed in the top right corner of the view of
+// the diagram. It is drawn within the transforms of the diagram, so that it is clipped, rotated and
+// mirrored along with the view, and stays within the output. The bounds of the objects that aren't
+// skipped are drawn over a frame of the size of the view.
+func (r *renderer) writeMinimap() string {
+	pr, opts, view := r.pr, r.opts, r.view
+	if opts.Minimap <= 0 {
+		return ""
+	}
+	b := &bytes.Buffer{}
+	w, h := float64((view.Dx()+1)*pr.scaleX), float64((view.Dy()+1)*pr.scaleY)
+	margin := float64(pr.scaleX)
+	x := pr.originX + float64(view.Min.X*pr.scaleX) + w - w*opts.Minimap - margin
+	y := pr.originY + float64(view.Min.Y*pr.scaleY) + margin
+	fmt.Fprintf(b, minimapTag, pr.f(x), pr.f(y), pr.f(opts.Minimap), pr.style("a2s-minimap", fmt.Sprintf(minimapStyle, pr.f(1/opts.Minimap))))
+	fmt.Fprintf(b, minimapFrameTag, pr.f(w), pr.f(h))
+	for i, obj := range r.c.Objects() {
+		if r.skip(obj) {
+			continue
+		}
+		// Objects partly outside of a clipped view are cut to it.
+		o := Bounds(obj).Intersect(image.Rect(view.Min.X, view.Min.Y, view.Max.X+1, view.Max.Y+1)).Sub(view.Min)
+		fmt.Fprintf(b, minimapRectTag, objectID(i, obj), pr.f(float64(o.Min.X*pr.scaleX)), pr.f(float64(o.Min.Y*pr.scaleY)), pr.f(float64(o.Dx()*pr.scaleX)), pr.f(float64(o.Dy()*pr.scaleY)))
+	}
+	io.WriteString(b, "  </g>\n")
+	return b.String()
+}
+
+// writeWatermark writes the watermark comment selected by opts. Double hyphens, which may not
+// appear within a comment, are broken up.
+func writeWatermark(w io.Writer, opts RenderOptions) {
+	if opts.NoWatermark {
+		return
+	}
+	text := opts.Watermark
+	if text == "" {
+		text = defaultWatermark
+	}
+	for strings.Contains(text, "--") {
+		text = strings.Replace(text, "--", "- -", -1)
+	}
+	fmt.Fprintf(w, watermark, text)
+}
+
+// writeSVGTag writes the root svg element for an output of width by height pixels.
+func writeSVGTag(w io.Writer, pr projection, opts RenderOptions, width, height int) {
+	// The dimensions of the output are rounded apart from the coordinates within it.
+	if opts.DimensionPrecision != 0 {
+		pr.precision = opts.DimensionPrecision
+	}
+	viewBox := fmt.Sprintf(" viewBox=\"%s %s %d %d\"", pr.f(pr.originX), pr.f(pr.originY), width, height)
+	perInch, ok := unitsPerInch[opts.Unit]
+	if !ok {
+		if pr.originX == 0 && pr.originY == 0 {
+			viewBox = ""
+		}
+		fmt.Fprintf(w, svgTag, fmt.Sprintf("%dpx", width), fmt.Sprintf("%dpx", height), viewBox)
+		return
+	}
+
+	dpi := opts.DPI
+	if dpi == 0 {
+		dpi = defaultDPI
+	}
+	physical := func(v int) string {
+		return pr.f(float64(v)/dpi*perInch) + opts.Unit
+	}
+	fmt.Fprintf(w, svgTag, physical(width), physical(height), viewBox)
+}
+
+// fontSize returns the font size of text in unit, as described by RenderOptions.FontUnit. CSS
+// pixels are converted to physical units at the CSS resolution, regardless of the DPI of the
+// output, as they are the user units of the output.
+func (pr projection) fontSize(unit string) string {
+	size := pr.textSize
+	switch unit {
+	case "em", "rem":
+		return pr.f(size/emSize) + unit
+	}
+	if perInch, ok := unitsPerInch[unit]; ok {
+		return pr.f(size/defaultDPI*perInch) + unit
+	}
+	return pr.f(size) + "px"
+}
+
+// A shadow describes the drop-shadow of a closed object.
+type shadow struct {
+	dx, dy    float64
+	blur      float64
+	intensity float64
+}
+
+// dashes returns the attribute drawing a path dashed, if it is.
+func (pr projection) dashes(dashed bool) string {
+	if dashed {
+		return pr.style("a2s-dashed", pathDashes)
+	}
+	return ""
+}
+
+// textFill returns the presentation attributes of text filled with color, preceded by attrs. If
+// elements are styled by class, attrs are replaced by class, and black and white text are classed
+// a2s-dark and a2s-light instead; the colors of tags are still set as attributes.
+func (pr projection) textFill(color, class, attrs string) string {
+	fill := fmt.Sprintf("fill=\"%s\"", color)
+	if !pr.classes {
+		return attrs + fill
+	}
+	var classes []string
+	if class != "" {
+		classes = append(classes, class)
+	}
+	switch color {
+	case "#000":
+		classes, fill = append(classes, "a2s-dark"), ""
+	case "#fff":
+		classes, fill = append(classes, "a2s-light"), ""
+	}
+	if len(classes) == 0 {
+		return fill
+	}
+	out := fmt.Sprintf("class=\"%s\"", strings.Join(classes, " "))
+	if fill != "" {
+		out += " " + fill
+	}
+	return out
+}
+
+// snapEnds returns the points of a line with its ends moved onto the walls they stop next to, if
+// they continue straight into a wall. Ends with markers are left in place.
+func snapEnds(points []Point, walls map[image.Point]bool) []Point {
+	if len(points) < 2 {
+		return points
+	}
+	out := append([]Point{}, points...)
+	snap := func(i, prev int) {
+		end := out[i]
+		if end.Hint == StartMarker || end.Hint == EndMarker {
+			return
+		}
+		if next, ok := beyond(end, out[prev]); ok && walls[next] {
+			out[i].X, out[i].Y = next.X, next.Y
+		}
+	}
+	snap(0, 1)
+	snap(len(out)-1, len(out)-2)
+	return out
+}
+
+// beyond returns the cell past the end of a line, continuing straight from the point prev before
+// it. Diagonal lines aren't continued.
+func beyond(end, prev Point) (image.Point, bool) {
+	if end.X != prev.X && end.Y != prev.Y {
+		return image.Point{}, false
+	}
+	return image.Point{X: 2*end.X - prev.X, Y: 2*end.Y - prev.Y}, true
+}
+
+// route returns the points of a line drawn in the routing style, as described by
+// RenderOptions.Routing.
+func route(points []Point, routing string) []Point {
+	first, last := points[0], points[len(points)-1]
+	switch routing {
+	case "straight":
+		return []Point{first, last}
+	case "elbow":
+		if first.X == last.X || first.Y == last.Y {
+			return []Point{first, last}
+		}
+		// The line leaves its start in the same direction as it is drawn.
+		bend := Point{X: first.X, Y: last.Y, Hint: RoundedCorner}
+		if points[1].Y == first.Y {
+			bend = Point{X: last.X, Y: first.Y, Hint: RoundedCorner}
+		}
+		return []Point{first, bend, last}
+	}
+	return points
+}
+
+// carry returns the scaled points of a line, with its ticks and dots moved onto the routed line
+// drawn instead, at the same fraction of its length.
+func (pr projection) carry(points, routed []Point) []scaledPoint {
+	from, to := scalePoints(pr, points), scalePoints(pr, routed)
+	// lengths returns the length of the line through s up to each of its points.
+	lengths := func(s []scaledPoint) []float64 {
+		out := make([]float64, len(s))
+		for i := 1; i < len(s); i++ {
+			out[i] = out[i-1] + math.Hypot(s[i].X-s[i-1].X, s[i].Y-s[i-1].Y)
+		}
+		return out
+	}
+	along, total := lengths(from), lengths(to)
+	for i, p := range from {
+		if p.Hint != Tick && p.Hint != Dot {
+			continue
+		}
+		d := 0.
+		if along[len(along)-1] != 0 {
+			d = along[i] / along[len(along)-1] * total[len(total)-1]
+		}
+		k := 1
+		for k < len(to)-1 && total[k] < d {
+			k++
+		}
+		a, b := to[k-1], to[k]
+		t := 0.
+		if l := total[k] - total[k-1]; l != 0 {
+			t = (d - total[k-1]) / l
+		}
+		from[i].X, from[i].Y = a.X+t*(b.X-a.X), a.Y+t*(b.Y-a.Y)
+	}
+	return from
+}
+
+// avoid returns the points of a routed line rerouted around the first of boxes that it crosses,
+// other than the boxes next to its ends: through the other elbow, or else along the row or column
+// just past either side of the box, within a grid of size cells. The line is returned as it is if
+// it crosses no box, or if no route is clear.
+func avoid(points []Point, boxes []Object, size image.Point) []Point {
+	first, last := points[0], points[len(points)-1]
+	var others []Object
+	for _, o := range boxes {
+		r := Bounds(o).Inset(-1)
+		if !image.Pt(first.X, first.Y).In(r) && !image.Pt(last.X, last.Y).In(r) {
+			others = append(others, o)
+		}
+	}
+	box := crossed(points, others)
+	if box == nil {
+		return points
+	}
+	candidates := [][]Point{
+		{first, {X: first.X, Y: last.Y, Hint: RoundedCorner}, last},
+		{first, {X: last.X, Y: first.Y, Hint: RoundedCorner}, last},
+	}
+	r := Bounds(box)
+	if abs(last.X-first.X) >= abs(last.Y-first.Y) {
+		for _, y := range []int{r.Min.Y - 1, r.Max.Y} {
+			candidates = append(candidates, []Point{first, {X: first.X, Y: y, Hint: RoundedCorner}, {X: last.X, Y: y, Hint: RoundedCorner}, last})
+		}
+	} else {
+		for _, x := range []int{r.Min.X - 1, r.Max.X} {
+			candidates = append(candidates, []Point{first, {X: x, Y: first.Y, Hint: RoundedCorner}, {X: x, Y: last.Y, Hint: RoundedCorner}, last})
+		}
+	}
+	grid := image.Rectangle{Max: size}
+	for _, c := range candidates {
+		if inGrid(c, grid) && crossed(c, others) == nil {
+			return c
+		}
+	}
+	return points
+}
+
+// inGrid returns true if all points are within the cells of grid.
+func inGrid(points []Point, grid image.Rectangle) bool {
+	for _, p := range points {
+		if !image.Pt(p.X, p.Y).In(grid) {
+			return false
+		}
+	}
+	return true
+}
+
+// abs returns the absolute value of v.
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// crossed returns the first of boxes that the segments between points pass through, or nil.
+func crossed(points []Point, boxes []Object) Object {
+	for i := 1; i < len(points); i++ {
+		a, b := points[i-1], points[i]
+		n := abs(b.X - a.X)
+		if dy := abs(b.Y - a.Y); dy > n {
+			n = dy
+		}
+		for k := 0; k <= n; k++ {
+			p := Point{X: a.X, Y: a.Y}
+			if n != 0 {
+				p.X += int(math.Round(float64(k*(b.X-a.X)) / float64(n)))
+				p.Y += int(math.Round(float64(k*(b.Y-a.Y)) / float64(n)))
+			}
+			for _, o := range boxes {
+				if o.HasPoint(p) {
+					return o
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// bends returns the points at which the direction of a path changes.
+func bends(points []Point) []Point {
+	var out []Point
+	for i := 1; i < len(points)-1; i++ {
+		a, p, b := points[i-1], points[i], points[i+1]
+		if sign(p.X-a.X) != sign(b.X-p.X) || sign(p.Y-a.Y) != sign(b.Y-p.Y) {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// curve returns the path data of a smooth curve from the start of a path to its end, bowing
+// towards its bends: a quadratic curve controlled by its bend if it has a single one, or else a
+// cubic curve controlled by its first and last bends. Straight paths are left straight.
+func (pr projection) curve(points []Point) string {
+	s, e := pr.scale(points[0]), pr.scale(points[len(points)-1])
+	b := bends(points)
+	switch len(b) {
+	case 0:
+		return fmt.Sprintf("M %s %s L %s %s ", pr.f(s.X), pr.f(s.Y), pr.f(e.X), pr.f(e.Y))
+	case 1:
+		c := pr.scale(b[0])
+		return fmt.Sprintf("M %s %s Q %s %s %s %s ", pr.f(s.X), pr.f(s.Y), pr.f(c.X), pr.f(c.Y), pr.f(e.X), pr.f(e.Y))
+	}
+	c1, c2 := pr.scale(b[0]), pr.scale(b[len(b)-1])
+	return fmt.Sprintf("M %s %s C %s %s %s %s %s %s ", pr.f(s.X), pr.f(s.Y), pr.f(c1.X), pr.f(c1.Y), pr.f(c2.X), pr.f(c2.Y), pr.f(e.X), pr.f(e.Y))
+}
+
+// glyphs draws each of the glyphs that may mark the ticks and dots of lines, centered on a point.
+var glyphs = map[string]func(w io.Writer, pr projection, p scaledPoint){
+	"cross": func(w io.Writer, pr projection, p scaledPoint) {
+		fmt.Fprintf(w, tickTag, pr.f(p.X-4), pr.f(p.Y-4), pr.f(p.X+4), pr.f(p.Y+4), pr.style("a2s-tick", "stroke-width=\"1\" "))
+		fmt.Fprintf(w, tickTag, pr.f(p.X+4), pr.f(p.Y-4), pr.f(p.X-4), pr.f(p.Y+4), pr.style("a2s-tick", "stroke-width=\"1\" "))
+	},
+	"plus": func(w io.Writer, pr projection, p scaledPoint) {
+		fmt.Fprintf(w, tickTag, pr.f(p.X-4), pr.f(p.Y), pr.f(p.X+4), pr.f(p.Y), pr.style("a2s-tick", "stroke-width=\"1\" "))
+		fmt.Fprintf(w, tickTag, pr.f(p.X), pr.f(p.Y-4), pr.f(p.X), pr.f(p.Y+4), pr.style("a2s-tick", "stroke-width=\"1\" "))
+	},
+	"dot": func(w io.Writer, pr projection, p scaledPoint) {
+		fmt.Fprintf(w, dotTag, pr.f(p.X), pr.f(p.Y), pr.style("a2s-dot", "fill=\"#000\" "))
+	},
+	"circle": func(w io.Writer, pr projection, p scaledPoint) {
+		fmt.Fprintf(w, circleTag, pr.f(p.X), pr.f(p.Y), pr.style("a2s-circle", "fill=\"#fff\" stroke-width=\"1\" "))
+	},
+	"square": func(w io.Writer, pr projection, p scaledPoint) {
+		fmt.Fprintf(w, squareTag, pr.f(p.X-3), pr.f(p.Y-3), pr.style("a2s-square", "fill=\"#000\" "))
+	},
+}
+
+// glyphOf returns the glyph selected by the option of a line, or else by the render option, or else
+// the fallback, skipping unknown glyphs.
+func glyphOf(glyph string, option interface{}, fallback string) string {
+	if g, ok := option.(string); ok {
+		if _, ok := glyphs[g]; ok {
+			return g
+		}
+	}
+	if _, ok := glyphs[glyph]; ok {
+		return glyph
+	}
+	return fallback
+}
+
+// isSeparator returns true if the open object o of c is a horizontal rule: a straight line without
+// markers across at least three quarters of the width of c, with no other line or polygon
+// touching it.
+func isSeparator(c Canvas, o Object) bool {
+	r := Bounds(o)
+	if o.IsClosed() || o.IsText() || r.Dy() != 1 || r.Dx()*4 < c.Size().X*3 {
+		return false
+	}
+	for _, p := range FullPoints(o) {
+		if p.Hint != None && p.Hint != Dashed {
+			return false
+		}
+	}
+	around := r.Inset(-1)
+	for _, q := range c.Objects() {
+		if q == o || q.IsText() {
+			continue
+		}
+		for _, p := range FullPoints(q) {
+			if (image.Point{X: p.X, Y: p.Y}).In(around) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// labelOffset returns the number of cells between the end of a line and the cell on which its
+// label is centered to sit near that end, given the cell next to the end. A label along a
+// horizontal end clears the end by a cell, while one across a vertical end is one cell in.
+func labelOffset(end, next Point, label string) int {
+	if end.Y != next.Y {
+		return 1
+	}
+	return (lineWidth([]byte(label))+1)/2 + 1
+}
+
+// markers returns the attributes drawing the start and end markers of a path, if it has them, in
+// the given styles: "Open" for open chevrons, "Double" for open double chevrons, or "" for filled
+// triangles. The markers of a color other than black are the ones defined by colorMarkerDefs.
+func markers(start, end bool, startStyle, endStyle, color string) string {
+	if color != "" {
+		color = "-" + color
+	}
+	attrs := ""
+	if start {
+		attrs += fmt.Sprintf(pathMarkStart, startStyle, color)
+	}
+	if end {
+		attrs += fmt.Sprintf(pathMarkEnd, endStyle, color)
+	}
+	return attrs
+}
+
+// doubleMarkers returns whether the start and the end of a line are doubled arrowheads, as in
+// "<<--" and "-->>", which both stay part of the line.
+func doubleMarkers(obj Object) (bool, bool) {
+	if obj.IsText() {
+		return false, false
+	}
+	text, points := obj.Text(), obj.Points()
+	n := len(text)
+	if n < 2 {
+		return false, false
+	}
+	start := points[0].Hint == StartMarker && text[1] == text[0]
+	end := points[len(points)-1].Hint == EndMarker && text[n-2] == text[n-1]
+	return start, end
+}
+
+// colorMarkerDefs returns the definitions of the start and end markers of the color, given as
+// hexadecimal digits, in the style of markers.
+func colorMarkerDefs(pr projection, style, color string) string {
+	x := float64(pr.scaleX - 1)
+	y := float64(pr.scaleY - 1)
+	switch style {
+	case "Open":
+		paint := fmt.Sprintf("fill=\"none\" stroke=\"#%s\" stroke-width=\"1.25\" ", color)
+		return fmt.Sprintf(colorMarkerDef, "iOpen", color, x, y, "M 10 0 L 0 5 L 10 10", paint) +
+			fmt.Sprintf(colorMarkerDef, "Open", color, x, y, "M 0 0 L 10 5 L 0 10", paint)
+	case "Double":
+		paint := fmt.Sprintf("fill=\"none\" stroke=\"#%s\" stroke-width=\"1.25\" ", color)
+		return fmt.Sprintf(colorMarkerDef, "iDouble", color, x, y, "M 10 0 L 5 5 L 10 10 M 5 0 L 0 5 L 5 10", paint) +
+			fmt.Sprintf(colorMarkerDef, "Double", color, x, y, "M 0 0 L 5 5 L 0 10 M 5 0 L 10 5 L 5 10", paint)
+	}
+	paint := fmt.Sprintf("fill=\"#%s\" ", color)
+	return fmt.Sprintf(colorMarkerDef, "i", color, x, y, "M 10 0 L 10 10 L 0 5 z", paint) +
+		fmt.Sprintf(colorMarkerDef, "", color, x, y, "M 0 0 L 10 5 L 0 10 z", paint)
+}
+
+// dashRun is a run of contiguous segments of a path that are either all dashed or all solid.
+type dashRun struct {
+	points []Point
+	dashed bool
+}
+
+// dashRuns splits a path into runs of dashed and solid segments. A segment is dashed if either
+// of its points is. Consecutive runs share the point at which they meet.
+func dashRuns(points []Point) []dashRun {
+	if len(points) < 2 {
+		return []dashRun{{points: points}}
+	}
+	var runs []dashRun
+	start := 0
+	for i := 1; i < len(points); i++ {
+		dashed := points[i-1].Hint == Dashed || points[i].Hint == Dashed
+		if len(runs) == 0 || runs[len(runs)-1].dashed != dashed {
+			start = i - 1
+			runs = append(runs, dashRun{dashed: dashed})
+		}
+		runs[len(runs)-1].points = points[start : i+1]
+	}
+	return runs
+}
+
+// taper splits the tips off the ends of a line that have a marker, as selected by start and
+// end: the last cell of the segment they end, provided that the rest of the segment is at least
+// as long. It returns the rest of the line and the tips, each running in the direction of the
+// line, or nil for an end that isn't tapered.
+func taper(points []Point, start, end bool) (body, first, last []Point) {
+	body = points
+	if start {
+		// The start is tapered as the end of the reversed line.
+		body, first = taperEnd(reversePoints(body))
+		body, first = reversePoints(body), reversePoints(first)
+	}
+	if end {
+		body, last = taperEnd(body)
+	}
+	return body, first, last
+}
+
+// taperEnd splits the tip off the end of a line, or returns nil as the tip if its last segment
+// is shorter than two cells.
+func taperEnd(points []Point) ([]Point, []Point) {
+	n := len(points)
+	if n < 2 {
+		return points, nil
+	}
+	e, q := points[n-1], points[n-2]
+	dx, dy := sign(q.X-e.X), sign(q.Y-e.Y)
+	t := Point{X: e.X + dx, Y: e.Y + dy}
+	if t.X != q.X || t.Y != q.Y {
+		return append(append([]Point(nil), points[:n-1]...), t), []Point{t, e}
+	}
+	// The line has a point on every cell, so the segment goes on past q unless q ends it.
+	if n < 3 || q.Hint != None {
+		return points, nil
+	}
+	if r := points[n-3]; sign(r.X-q.X) != dx || sign(r.Y-q.Y) != dy {
+		return points, nil
+	}
+	return points[:n-1], []Point{q, e}
+}
+
+// reversePoints returns the points in reverse order, or nil if there are none.
+func reversePoints(points []Point) []Point {
+	if len(points) == 0 {
+		return nil
+	}
+	out := make([]Point, len(points))
+	for i, p := range points {
+		out[len(points)-1-i] = p
+	}
+	return out
+}
+
+// roundCorners returns the points of an object with its corners hinted as rounded, or with no
+// corner hinted as rounded if round is false. The ends of lines are left as they are.
+func roundCorners(obj Object, round bool) []Point {
+	points := append([]Point(nil), FullPoints(obj)...)
+	corners := map[image.Point]bool{}
+	for _, c := range obj.Corners() {
+		corners[image.Pt(c.X, c.Y)] = true
+	}
+	for i, p := range points {
+		if !obj.IsClosed() && (i == 0 || i == len(points)-1) {
+			continue
+		}
+		if round && corners[image.Pt(p.X, p.Y)] {
+			points[i].Hint = RoundedCorner
+		} else if !round && p.Hint == RoundedCorner {
+			points[i].Hint = None
+		}
+	}
+	return points
+}
+
+// translate returns points moved such that origin is at (0,0).
+func translate(points []Point, origin Point) []Point {
+	out := make([]Point, len(points))
+	for i, p := range points {
+		out[i] = Point{X: p.X - origin.X, Y: p.Y - origin.Y, Hint: p.Hint}
+	}
+	return out
+}
+
+// strokeWeights maps the a2s:weight scale of 1 (hairline) to 5 (heaviest) to stroke widths.
+var strokeWeights = [...]string{"1", "2", "3.5", "5", "7"}
+
+// strokeWidth returns the stroke width of lines with the options, as set by their stroke-width or
+// a2s:weight option, or the default of 2.
+func strokeWidth(options map[string]interface{}) float64 {
+	v, ok := options["stroke-width"]
+	if !ok {
+		v = strokeWeight(options)
+	}
+	if w, err := strconv.ParseFloat(fmt.Sprint(v), 64); err == nil && w > 0 {
+		return w
+	}
+	return 2
+}
+
+// weight returns the stroke-width attribute for the a2s:weight option, unless the stroke-width
+// is set explicitly.
+func weight(options map[string]interface{}) string {
+	w := strokeWeight(options)
+	if w == "" {
+		return ""
+	}
+	return fmt.Sprintf("stroke-width=\"%s\" ", w)
+}
+
+// strokeWeight returns the stroke width for the a2s:weight option, unless the stroke-width is set
+// explicitly, in which case it returns "".
+func strokeWeight(options map[string]interface{}) string {
+	w, ok := options["a2s:weight"].(float64)
+	if _, set := options["stroke-width"]; !ok || set {
+		return ""
+	}
+	i := int(math.Round(w))
+	if i < 1 {
+		i = 1
+	} else if i > len(strokeWeights) {
+		i = len(strokeWeights)
+	}
+	return strokeWeights[i-1]
+}
+
+// elevations maps the a2s:elevation scale of 1 (lowest) to 5 (highest) to drop-shadows that are
+// offset and blurred further as objects are raised. The default drop-shadow is at elevation 2.
+var elevations = [...]shadow{
+	{dx: 1, dy: 1, blur: 1.5, intensity: 1},
+	{dx: 2, dy: 2, blur: 3, intensity: 1},
+	{dx: 3, dy: 3, blur: 4.5, intensity: 1},
+	{dx: 4, dy: 4, blur: 6, intensity: 1},
+	{dx: 6, dy: 6, blur: 8, intensity: 1},
+}
+
+// elevation returns the level of the a2s:elevation option, if present, limited to the levels of
+// elevations. Level 0 has no drop-shadow.
+func elevation(options map[string]interface{}) (int, bool) {
+	e, ok := options["a2s:elevation"].(float64)
+	if !ok {
+		return 0, false
+	}
+	i := int(math.Round(e))
+	if i < 0 {
+		i = 0
+	} else if i > len(elevations) {
+		i = len(elevations)
+	}
+	return i, true
+}
+
+// newShadow returns the drop-shadow described by the a2s:shadow-dx, a2s:shadow-dy,
+// a2s:shadow-blur, and a2s:shadow-intensity options, if any of them is present. Options that are
+// absent take the values of the drop-shadow of the a2s:elevation option, or of the default
+// drop-shadow.
+func newShadow(options map[string]interface{}) (shadow, bool) {
+	s := elevations[1]
+	if level, ok := elevation(options); ok && level > 0 {
+		s = elevations[level-1]
+	}
+	found := false
+	for k, v := range map[string]*float64{
+		"a2s:shadow-dx":        &s.dx,
+		"a2s:shadow-dy":        &s.dy,
+		"a2s:shadow-blur":      &s.blur,
+		"a2s:shadow-intensity": &s.intensity,
+	} {
+		if f, ok := options[k].(float64); ok {
+			*v = f
+			found = true
+		}
+	}
+	return s, found
+}
+
+func escape(s string) string {
+	b := &bytes.Buffer{}
+	if err := xml.EscapeText(b, []byte(s)); err != nil {
+		panic(err)
+	}
+	return b.String()
+}
+
+type scaledPoint struct {
+	X    float64
+	Y    float64
+	Hint RenderHint
+}
+
+// A projection maps points on the grid to coordinates in the rendered output.
+type projection struct {
+	scaleX, scaleY int
+	precision      int
+	// classes is true if elements are styled by class rather than by attributes.
+	classes bool
+	// originX and originY offset all coordinates.
+	originX, originY float64
+	// textSize is the font size of text in pixels.
+	textSize float64
+}
+
+func newProjection(opts RenderOptions) projection {
+	pr := projection{
+		scaleX:    opts.ScaleX,
+		scaleY:    opts.ScaleY,
+		precision: opts.Precision,
+		classes:   opts.Stylesheet != "",
+		originX:   opts.OriginX,
+		originY:   opts.OriginY,
+		textSize:  fontSize,
+	}
+	if pr.scaleX == 0 {
+		pr.scaleX = defaultScaleX
+	}
+	if pr.scaleY == 0 {
+		pr.scaleY = defaultScaleY
+	}
+	if opts.Legacy {
+		pr.textSize = legacyFontScale * float64(pr.scaleY)
+	}
+	if pr.precision == 0 {
+		pr.precision = defaultPrecision
+	}
+	return pr
+}
+
+// style returns the presentation attributes of an element, or its class instead if elements are
+// styled by class.
+func (pr projection) style(class, attrs string) string {
+	if !pr.classes {
+		return attrs
+	}
+	if strings.HasSuffix(attrs, " ") {
+		return fmt.Sprintf("class=\"%s\" ", class)
+	}
+	return fmt.Sprintf("class=\"%s\"", class)
+}
+
+// scale returns the coordinates of the center of the grid cell at p.
+func (pr projection) scale(p Point) scaledPoint {
+	x, y := pr.at((float64(p.X)+.5)*float64(pr.scaleX), (float64(p.Y)+.5)*float64(pr.scaleY))
+	return scaledPoint{X: x, Y: y, Hint: p.Hint}
+}
+
+// at returns the coordinates of the point x and y pixels from the top left of the diagram.
+func (pr projection) at(x, y float64) (float64, float64) {
+	return x + pr.originX, y + pr.originY
+}
+
+// f formats a coordinate, rounded to the precision of the projection. Trailing zeroes are
+// omitted.
+func (pr projection) f(v float64) string {
+	if pr.precision > 0 {
+		p := math.Pow10(pr.precision)
+		v = math.Round(v*p) / p
+	}
+	if v == 0 {
+		// Avoid emitting negative zero.
+		v = 0
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// nearRoundedCorner returns true if the point at index i of a path lies within the curve of
+// the rounded corner of the given radius next to it along the path, on the same row or column.
+// Drawing a line to such a point would double back over the curve, since the curve of a corner is
+// usually larger than a cell. The path wraps around, as closed shapes do.
+func (pr projection) nearRoundedCorner(points []Point, i int, radius float64) bool {
+	// The curve spans this many cells from its corner along rows and along columns.
+	cellsX, cellsY := radius/float64(pr.scaleX), radius/float64(pr.scaleY)
+	steps := int(math.Max(cellsX, cellsY))
+	p := points[i]
+	for _, dir := range []int{-1, 1} {
+		for k := 1; k <= steps && k < len(points); k++ {
+			cp := points[((i+dir*k)%len(points)+len(points))%len(points)]
+			if cp.Hint != RoundedCorner {
+				continue
+			}
+			if cp.Y == p.Y && float64(abs(cp.X-p.X)) <= cellsX || cp.X == p.X && float64(abs(cp.Y-p.Y)) <= cellsY {
+				return true
+			}
+			break
+		}
+	}
+	return false
+}
+
+// startTurn returns the directions, as unit steps, from the rounded start point p of a path
+// toward the point the curve comes from and toward the next point np. The curve comes from the
+// last point lp when it closes a corner with np, as it does for a closed shape. Otherwise, as
+// for a line starting on a corner, it comes from below when the path leaves horizontally and
+// from the right when it leaves vertically.
+func startTurn(p, np, lp scaledPoint) (px, py, nx, ny float64) {
+	nx, ny = fsign(np.X-p.X), fsign(np.Y-p.Y)
+	switch {
+	case lp.X == p.X && lp.Y != p.Y && nx != 0:
+		return 0, fsign(lp.Y - p.Y), nx, ny
+	case lp.Y == p.Y && lp.X != p.X && ny != 0:
+		return fsign(lp.X - p.X), 0, nx, ny
+	case nx != 0:
+		return 0, 1, nx, ny
+	}
+	return 1, 0, nx, ny
 }
 
-func scale(p Point, scaleX, scaleY int) scaledPoint {
-	return scaledPoint{
-		X:    (float64(p.X) + .5) * float64(scaleX),
-		Y:    (float64(p.Y) + .5) * float64(scaleY),
-		Hint: p.Hint,
+// fsign returns -1, 0, or 1 for negative, zero, or positive v.
+func fsign(v float64) float64 {
+	switch {
+	case v < 0:
+		return -1
+	case v > 0:
+		return 1
 	}
+	return 0
 }
 
-func flatten(points []Point, scaleX, scaleY int) string {
+// flatten returns the path data of points, rounding the corners hinted as such with the given
+// radius.
+func (pr projection) flatten(points []Point, radius float64) string {
 	out := ""
 
 	// Scaled start point, and previous point (which is always initially the start point).
-	sp := scale(points[0], scaleX, scaleY)
+	sp := pr.scale(points[0])
 	pp := sp
 
 	for i, cp := range points {
-		p := scale(cp, scaleX, scaleY)
+		p := pr.scale(cp)
 
 		// Our start point is represented by a single moveto command (unless the start point
 		// is a rounded corner) as the shape will be closed with the Z command automatically
 		// if we have a closed polygon. If our start point is a rounded corner, we have to go
 		// ahead and draw that curve.
 		if i == 0 {
-			if cp.Hint == RoundedCorner {
-				out += fmt.Sprintf("M %g %g Q %g %g %g %g ", p.X, p.Y+10, p.X, p.Y, p.X+10, p.Y)
+			if cp.Hint == RoundedCorner && len(points) > 1 {
+				px, py, nx, ny := startTurn(p, pr.scale(points[1]), pr.scale(points[len(points)-1]))
+				out += fmt.Sprintf("M %s %s Q %s %s %s %s ", pr.f(p.X+px*radius), pr.f(p.Y+py*radius), pr.f(p.X), pr.f(p.Y), pr.f(p.X+nx*radius), pr.f(p.Y+ny*radius))
 				continue
 			}
 
-			out += fmt.Sprintf("M %g %g ", p.X, p.Y)
+			out += fmt.Sprintf("M %s %s ", pr.f(p.X), pr.f(p.Y))
 			continue
 		}
 
@@ -308,7 +2622,7 @@ func flatten(points []Point, scaleX, scaleY int) string {
 			if i == len(points)-1 {
 				np = sp
 			} else {
-				np = scale(points[i+1], scaleX, scaleY)
+				np = pr.scale(points[i+1])
 			}
 
 			if pp.X == p.X {
@@ -318,38 +2632,38 @@ func flatten(points []Point, scaleX, scaleY int) string {
 
 				// Offset start point from control point in the proper direction.
 				if pp.Y < p.Y {
-					sy = p.Y - 10
+					sy = p.Y - radius
 				} else {
-					sy = p.Y + 10
+					sy = p.Y + radius
 				}
 
 				ey = p.Y
 				// Offset endpoint from control point in the proper direction.
 				if np.X < p.X {
-					ex = p.X - 10
+					ex = p.X - radius
 				} else {
-					ex = p.X + 10
+					ex = p.X + radius
 				}
 			} else if pp.Y == p.Y {
 				// Horizontal decisions mirror vertical's above.
 				sy = p.Y
 				if pp.X < p.X {
-					sx = p.X - 10
+					sx = p.X - radius
 				} else {
-					sx = p.X + 10
+					sx = p.X + radius
 				}
 				ex = p.X
 				if np.Y <= p.Y {
-					ey = p.Y - 10
+					ey = p.Y - radius
 				} else {
-					ey = p.Y + 10
+					ey = p.Y + radius
 				}
 			}
 
-			out += fmt.Sprintf("L %g %g Q %g %g %g %g ", sx, sy, cx, cy, ex, ey)
-		} else {
+			out += fmt.Sprintf("L %s %s Q %s %s %s %s ", pr.f(sx), pr.f(sy), pr.f(cx), pr.f(cy), pr.f(ex), pr.f(ey))
+		} else if !pr.nearRoundedCorner(points, i, radius) {
 			// Oh, the horrors of drawing a straight line...
-			out += fmt.Sprintf("L %g %g ", p.X, p.Y)
+			out += fmt.Sprintf("L %s %s ", pr.f(p.X), pr.f(p.Y))
 		}
 
 		pp = p
@@ -4,6 +4,7 @@
 package asciitosvg
 
 import (
+	"image"
 	"strings"
 	"testing"
 
@@ -23,7 +24,7 @@ func TestCanvasToSVG(t *testing.T) {
 				"|Hi:",
 				"+--+",
 			},
-			1677,
+			1644,
 		},
 
 		// 1 Box with non-existent ref
@@ -33,7 +34,7 @@ func TestCanvasToSVG(t *testing.T) {
 				"|[a]  |",
 				"'-----'",
 			},
-			1763,
+			1701,
 		},
 
 		// 2 Box with ref, change background color of container with #RRGGBB
@@ -45,7 +46,7 @@ func TestCanvasToSVG(t *testing.T) {
 				"",
 				"[a]: {\"fill\":\"#000000\"}",
 			},
-			1858,
+			1704,
 		},
 
 		// 3 Box with ref && fill, change label
@@ -57,7 +58,7 @@ func TestCanvasToSVG(t *testing.T) {
 				"",
 				"[a]: {\"fill\":\"#000000\",\"a2s:label\":\"abcdefg\"}",
 			},
-			1826,
+			1708,
 		},
 
 		// 4 Box with ref && fill && label, remove ref
@@ -69,7 +70,7 @@ func TestCanvasToSVG(t *testing.T) {
 				"",
 				"[a]: {\"fill\":\"#000000\",\"a2s:label\":\"abcd\",\"a2s:delref\":1}",
 			},
-			1764,
+			1645,
 		},
 
 		// 5 Ticks and dots in lines.
@@ -79,7 +80,7 @@ func TestCanvasToSVG(t *testing.T) {
 				"",
 				" <-----o------",
 			},
-			1968,
+			1944,
 		},
 
 		// 6 Just text
@@ -87,7 +88,7 @@ func TestCanvasToSVG(t *testing.T) {
 			[]string{
 				" foo",
 			},
-			1476,
+			1452,
 		},
 
 		// 7 Just text with a deleting reference
@@ -96,7 +97,7 @@ func TestCanvasToSVG(t *testing.T) {
 				" foo",
 				"[1,0]: {\"a2s:delref\":1,\"a2s:label\":\"foo\"}",
 			},
-			1477,
+			1452,
 		},
 
 		// 8 Just text with a link
@@ -105,7 +106,7 @@ func TestCanvasToSVG(t *testing.T) {
 				" foo",
 				"[1,0]: {\"a2s:delref\":1, \"a2s:link\":\"https://github.com/asciitosvg/asciitosvg\"}",
 			},
-			1521,
+			1496,
 		},
 	}
 	for i, line := range data {
@@ -119,3 +120,1951 @@ func TestCanvasToSVG(t *testing.T) {
 		ut.AssertEqualIndex(t, i, line.length, len(actual))
 	}
 }
+
+func TestCanvasToSVGTransform(t *testing.T) {
+	t.Parallel()
+	input := []string{
+		".---.",
+		"|[a]|",
+		"'---'",
+		"",
+		"[a]: {\"a2s:transform\":\"rotate(15)\"}",
+	}
+	canvas, err := NewCanvas([]byte(strings.Join(input, "\n")), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	actual := string(CanvasToSVG(canvas, false, "", 9, 16))
+	ut.AssertEqual(t, true, strings.Contains(actual, "    <g transform=\"rotate(15)\"><path id=\"closed0\" "))
+
+	// A transform that isn't a string is ignored.
+	for _, v := range []string{"1", "true", "null"} {
+		input[4] = "[a]: {\"a2s:transform\":" + v + "}"
+		canvas, err = NewCanvas([]byte(strings.Join(input, "\n")), 9, false)
+		if err != nil {
+			t.Fatalf("Error creating canvas: %s", err)
+		}
+		actual = string(CanvasToSVG(canvas, false, "", 9, 16))
+		ut.AssertEqual(t, false, strings.Contains(actual, "transform"))
+	}
+}
+
+func TestProjectionPrecision(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		precision int
+		in        float64
+		expected  string
+	}{
+		{0, 13.500000001, "13.5"},
+		{0, 13.499999999, "13.5"},
+		{0, 4, "4"},
+		{0, -0.001, "0"},
+		{1, 13.46, "13.5"},
+		{-1, 13.500000001, "13.500000001"},
+	}
+	for i, line := range data {
+		pr := newProjection(RenderOptions{Precision: line.precision})
+		ut.AssertEqualIndex(t, i, line.expected, pr.f(line.in))
+	}
+}
+
+func TestProjectionFlatten(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		points   []Point
+		expected string
+	}{
+		// 0 Clockwise box.
+		{
+			[]Point{{X: 0, Y: 0, Hint: RoundedCorner}, {X: 3, Y: 0}, {X: 3, Y: 2}, {X: 0, Y: 2}},
+			"M 4.5 18 Q 4.5 8 14.5 8 L 31.5 8 L 31.5 40 L 4.5 40 ",
+		},
+		// 1 Counter-clockwise box.
+		{
+			[]Point{{X: 0, Y: 0, Hint: RoundedCorner}, {X: 0, Y: 2}, {X: 3, Y: 2}, {X: 3, Y: 0}},
+			"M 14.5 8 Q 4.5 8 4.5 18 L 4.5 40 L 31.5 40 L 31.5 8 ",
+		},
+		// 2 Box starting at its top right corner.
+		{
+			[]Point{{X: 3, Y: 0, Hint: RoundedCorner}, {X: 3, Y: 2}, {X: 0, Y: 2}, {X: 0, Y: 0}},
+			"M 21.5 8 Q 31.5 8 31.5 18 L 31.5 40 L 4.5 40 L 4.5 8 ",
+		},
+		// 3 Line going down from a rounded corner.
+		{
+			[]Point{{X: 0, Y: 0, Hint: RoundedCorner}, {X: 0, Y: 2}},
+			"M 14.5 8 Q 4.5 8 4.5 18 L 4.5 40 ",
+		},
+	}
+	pr := newProjection(RenderOptions{})
+	for i, line := range data {
+		ut.AssertEqualIndex(t, i, line.expected, pr.flatten(line.points, cornerRadius))
+	}
+}
+
+func TestCanvasToSVGPrecision(t *testing.T) {
+	t.Parallel()
+	input := []string{
+		"+--+",
+		"|  |",
+		"+--+",
+	}
+	canvas, err := NewCanvas([]byte(strings.Join(input, "\n")), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	opts := RenderOptions{ScaleX: 5, ScaleY: 7, Precision: 1}
+	actual := string(CanvasToSVGWithOptions(canvas, opts))
+	ut.AssertEqual(t, true, strings.Contains(actual, "d=\"M 2.5 3.5 L 7.5 3.5 L 12.5 3.5 L 17.5 3.5 L 17.5 10.5 L 17.5 17.5 L 12.5 17.5 L 7.5 17.5 L 2.5 17.5 L 2.5 10.5 Z\""))
+	ut.AssertEqual(t, actual, string(CanvasToSVGWithOptions(canvas, opts)))
+}
+
+func TestCanvasToSVGFiltered(t *testing.T) {
+	t.Parallel()
+	input := []string{
+		"+--+",
+		"|Hi|-->",
+		"+--+ foo",
+	}
+	canvas, err := NewCanvas([]byte(strings.Join(input, "\n")), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	actual := string(CanvasToSVGFiltered(canvas, Object.IsText, RenderOptions{}))
+	ut.AssertEqual(t, 0, strings.Count(actual, "<path id="))
+	ut.AssertEqual(t, 2, strings.Count(actual, "<text "))
+	ut.AssertEqual(t, true, strings.Contains(actual, ">Hi</text>"))
+	ut.AssertEqual(t, true, strings.Contains(actual, ">foo</text>"))
+}
+
+func TestCanvasToSVGUnits(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		opts     RenderOptions
+		expected string
+	}{
+		{RenderOptions{}, "<svg width=\"45px\" height=\"64px\" version"},
+		{RenderOptions{Unit: "px"}, "<svg width=\"45px\" height=\"64px\" version"},
+		{RenderOptions{Unit: "in"}, "<svg width=\"0.47in\" height=\"0.67in\" viewBox=\"0 0 45 64\" version"},
+		{RenderOptions{Unit: "mm", DPI: 25.4}, "<svg width=\"45mm\" height=\"64mm\" viewBox=\"0 0 45 64\" version"},
+		{RenderOptions{Unit: "mm", ScaleX: 10, ScaleY: 20}, "<svg width=\"13.23mm\" height=\"21.17mm\" viewBox=\"0 0 50 80\" version"},
+		{RenderOptions{Unit: "in", DPI: 90}, "<svg width=\"0.5in\" height=\"0.71in\" viewBox=\"0 0 45 64\" version"},
+		{RenderOptions{Unit: "in", DPI: 90, DimensionPrecision: 1}, "<svg width=\"0.5in\" height=\"0.7in\" viewBox=\"0 0 45 64\" version"},
+		{RenderOptions{Unit: "in", DPI: 90, DimensionPrecision: -1}, "<svg width=\"0.5in\" height=\"0.7111111111111111in\" viewBox=\"0 0 45 64\" version"},
+		{RenderOptions{OriginX: 1.2345, DimensionPrecision: 3, Precision: 1}, "<svg width=\"45px\" height=\"64px\" viewBox=\"1.235 0 45 64\" version"},
+	}
+	canvas, err := NewCanvas([]byte("+--+\n|  |\n+--+"), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	for i, line := range data {
+		actual := string(CanvasToSVGWithOptions(canvas, line.opts))
+		ut.AssertEqualIndex(t, i, true, strings.Contains(actual, line.expected))
+	}
+}
+
+func TestCanvasToSVGMarkers(t *testing.T) {
+	t.Parallel()
+	input := []string{
+		"------",
+		"<-----",
+		"",
+		"[0,0]: {\"a2s:marker-end\":true}",
+		"",
+		"[0,1]: {\"a2s:marker-start\":false,\"a2s:marker-end\":true}",
+	}
+	canvas, err := NewCanvas([]byte(strings.Join(input, "\n")), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	actual := string(CanvasToSVG(canvas, false, "", 9, 16))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<path id=\"open0\" marker-end=\"url(#Pointer)\" d="))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<path id=\"open1\" marker-end=\"url(#Pointer)\" d="))
+}
+
+func TestCanvasToSVGShadow(t *testing.T) {
+	t.Parallel()
+	input := []string{
+		"+---+ +---+",
+		"|[a]| |   |",
+		"+---+ +---+",
+		"",
+		"[a]: {\"a2s:shadow-dx\":6,\"a2s:shadow-blur\":1.5}",
+	}
+	canvas, err := NewCanvas([]byte(strings.Join(input, "\n")), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	actual := string(CanvasToSVG(canvas, false, "", 9, 16))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<filter id=\"dsFilter0\" "))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<feOffset result=\"offOut\" in=\"SourceGraphic\" dx=\"6\" dy=\"2\"/>"))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<feGaussianBlur result=\"blurOut\" in=\"matrixOut\" stdDeviation=\"1.5\"/>"))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<path id=\"closed0\" filter=\"url(#dsFilter0)\" d="))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<path id=\"closed1\" fill=\"#fff\" filter=\"url(#dsFilter)\" d="))
+
+	// Without blur, there are no shadows at all.
+	actual = string(CanvasToSVG(canvas, true, "", 9, 16))
+	ut.AssertEqual(t, false, strings.Contains(actual, "dsFilter0"))
+
+	// A box may opt out of its shadow, even along with shadow options.
+	input[4] = "[a]: {\"fill\":\"#eee\",\"a2s:shadow\":false,\"a2s:shadow-dx\":6}"
+	canvas, err = NewCanvas([]byte(strings.Join(input, "\n")), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	actual = string(CanvasToSVG(canvas, false, "", 9, 16))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<path id=\"closed0\" fill=\"#eee\" d="))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<path id=\"closed1\" fill=\"#fff\" filter=\"url(#dsFilter)\" d="))
+	ut.AssertEqual(t, false, strings.Contains(actual, "dsFilter0"))
+}
+
+func TestCanvasToSVGElevation(t *testing.T) {
+	t.Parallel()
+	input := []string{
+		"+---+ +---+ +---+ +---+ +---+",
+		"|[a]| |[b]| |[a]| |[c]| |[d]|",
+		"+---+ +---+ +---+ +---+ +---+",
+		"",
+		"[a]: {\"a2s:elevation\":1}",
+		"[b]: {\"a2s:elevation\":4}",
+		"[c]: {\"a2s:elevation\":0}",
+		"[d]: {\"a2s:elevation\":4,\"a2s:shadow-intensity\":0.5}",
+	}
+	canvas, err := NewCanvas([]byte(strings.Join(input, "\n")), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	actual := string(CanvasToSVG(canvas, false, "", 9, 16))
+	// Objects at the same elevation share their filter.
+	ut.AssertEqual(t, 1, strings.Count(actual, "<filter id=\"dsElevation1\" "))
+	ut.AssertEqual(t, 1, strings.Count(actual, "<filter id=\"dsElevation4\" "))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<feOffset result=\"offOut\" in=\"SourceGraphic\" dx=\"1\" dy=\"1\"/>"))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<feGaussianBlur result=\"blurOut\" in=\"matrixOut\" stdDeviation=\"6\"/>"))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<path id=\"closed0\" filter=\"url(#dsElevation1)\" d="))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<path id=\"closed1\" filter=\"url(#dsElevation4)\" d="))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<path id=\"closed2\" filter=\"url(#dsElevation1)\" d="))
+	// An elevation of 0 has no drop-shadow.
+	ut.AssertEqual(t, true, strings.Contains(actual, "<path id=\"closed3\" d="))
+	// Shadow options adjust the drop-shadow of the elevation.
+	ut.AssertEqual(t, true, strings.Contains(actual, "<path id=\"closed4\" filter=\"url(#dsFilter4)\" d="))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<feOffset result=\"offOut\" in=\"SourceGraphic\" dx=\"4\" dy=\"4\"/>"))
+}
+
+func TestCanvasToSVGNoText(t *testing.T) {
+	t.Parallel()
+	input := []string{
+		"+-----+",
+		"| foo |--> bar",
+		"+-----+",
+	}
+	canvas, err := NewCanvas([]byte(strings.Join(input, "\n")), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	actual := string(CanvasToSVGWithOptions(canvas, RenderOptions{NoText: true}))
+	ut.AssertEqual(t, 0, strings.Count(actual, "<text"))
+	ut.AssertEqual(t, 2, strings.Count(actual, "<path id="))
+	ut.AssertEqual(t, true, strings.HasSuffix(actual, "</svg>\n"))
+
+	actual = string(CanvasToSVGWithOptions(canvas, RenderOptions{}))
+	ut.AssertEqual(t, 2, strings.Count(actual, "<text"))
+}
+
+func TestCanvasToSVGFilter(t *testing.T) {
+	t.Parallel()
+	input := []string{
+		"+---+ +---+ +---+",
+		"|[a]| |[b]| |   |",
+		"+---+ +---+ +---+",
+		"",
+		"[a]: {\"fill\":\"#eee\",\"filter\":\"none\"}",
+		"",
+		"[b]: {\"filter\":\"url(#glow)\"}",
+	}
+	canvas, err := NewCanvas([]byte(strings.Join(input, "\n")), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	glow := "    <filter id=\"glow\"><feGaussianBlur stdDeviation=\"2\"/></filter>\n"
+	actual := string(CanvasToSVGWithOptions(canvas, RenderOptions{Defs: glow}))
+	ut.AssertEqual(t, true, strings.Contains(actual, glow+"  </defs>\n"))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<path id=\"closed0\" fill=\"#eee\" filter=\"none\" d="))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<path id=\"closed1\" filter=\"url(#glow)\" d="))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<path id=\"closed2\" fill=\"#fff\" filter=\"url(#dsFilter)\" d="))
+}
+
+func TestCanvasToSVGRoundedBox(t *testing.T) {
+	t.Parallel()
+	input := []string{
+		".----.",
+		"|    |",
+		"'----'",
+	}
+	canvas, err := NewCanvas([]byte(strings.Join(input, "\n")), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	actual := string(CanvasToSVG(canvas, false, "", 9, 16))
+	expected := "d=\"M 4.5 18 Q 4.5 8 14.5 8 L 22.5 8 L 31.5 8 L 39.5 8 Q 49.5 8 49.5 18 L 49.5 24 L 49.5 30 " +
+		"Q 49.5 40 39.5 40 L 31.5 40 L 22.5 40 L 14.5 40 Q 4.5 40 4.5 30 L 4.5 24 Z\""
+	ut.AssertEqual(t, true, strings.Contains(actual, expected))
+}
+
+func TestCanvasToSVGAccessible(t *testing.T) {
+	t.Parallel()
+	input := []string{
+		"+--------+ +-----------+",
+		"| Editor | | [b]       |",
+		"+--------+ | +-------+ |",
+		"           | | Inner | |",
+		"           | +-------+ |",
+		"           +-----------+",
+		"",
+		"[b]: {\"a2s:label\":\"Outer\"}",
+	}
+	canvas, err := NewCanvas([]byte(strings.Join(input, "\n")), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	actual := string(CanvasToSVGWithOptions(canvas, RenderOptions{Accessible: true}))
+	ut.AssertEqual(t, 3, strings.Count(actual, "aria-label="))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<g role=\"img\" aria-label=\"Editor\"><path id=\"closed0\" fill=\"#fff\" filter=\"url(#dsFilter)\" d="))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<g role=\"img\" aria-label=\"Outer\"><path id=\"closed1\" "))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<g role=\"img\" aria-label=\"Inner\"><path id=\"closed2\" "))
+	ut.AssertEqual(t, 3, strings.Count(actual, "Z\" /></g>\n"))
+
+	actual = string(CanvasToSVGWithOptions(canvas, RenderOptions{}))
+	ut.AssertEqual(t, 0, strings.Count(actual, "aria-label="))
+}
+
+func TestCanvasToSVGLineLabel(t *testing.T) {
+	t.Parallel()
+	input := []string{
+		"+--+         +--+",
+		"|  |-------->|  |",
+		"+--+         +--+",
+		"",
+		"[4,1]: {\"a2s:label\":\"yes\",\"a2s:chip\":true,\"a2s:delref\":1}",
+	}
+	canvas, err := NewCanvas([]byte(strings.Join(input, "\n")), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	actual := string(CanvasToSVG(canvas, false, "", 9, 16))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<rect x=\"58.5\" y=\"16\" width=\"36\" height=\"16\" rx=\"4\" fill=\"#fff\" />\n"))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<text id=\"label2\" x=\"76.5\" y=\"28\" text-anchor=\"middle\" fill=\"#000\">yes</text>\n"))
+
+	// Without a chip, only the label is emitted; dark chips get light text.
+	for _, chip := range []string{"", ",\"a2s:chip\":\"#000\""} {
+		input[4] = "[4,1]: {\"a2s:label\":\"yes\",\"a2s:delref\":1" + chip + "}"
+		canvas, err = NewCanvas([]byte(strings.Join(input, "\n")), 9, false)
+		if err != nil {
+			t.Fatalf("Error creating canvas: %s", err)
+		}
+		actual = string(CanvasToSVG(canvas, false, "", 9, 16))
+		ut.AssertEqual(t, chip != "", strings.Contains(actual, "<rect "))
+		ut.AssertEqual(t, chip != "", strings.Contains(actual, "fill=\"#fff\">yes</text>"))
+	}
+
+	// A chip color that isn't a valid color is replaced by the default one.
+	input[4] = "[4,1]: {\"a2s:label\":\"yes\",\"a2s:chip\":\"blakc\",\"a2s:delref\":1}"
+	canvas, err = NewCanvas([]byte(strings.Join(input, "\n")), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	actual = string(CanvasToSVG(canvas, false, "", 9, 16))
+	ut.AssertEqual(t, true, strings.Contains(actual, "rx=\"4\" fill=\"#fff\" />\n"))
+	ut.AssertEqual(t, true, strings.Contains(actual, "fill=\"#000\">yes</text>"))
+
+	// The chip fits the cells of the label, two for each wide character.
+	input[4] = "[4,1]: {\"a2s:label\":\"日本\",\"a2s:chip\":true,\"a2s:delref\":1}"
+	canvas, err = NewCanvas([]byte(strings.Join(input, "\n")), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	actual = string(CanvasToSVG(canvas, false, "", 9, 16))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<rect x=\"54\" y=\"16\" width=\"45\" height=\"16\" rx=\"4\" fill=\"#fff\" />\n"))
+
+	// The label may be moved near either end of the line instead.
+	for pos, expected := range map[string]string{"start": "67.5", "end": "85.5", "middle": "76.5"} {
+		input[4] = "[4,1]: {\"a2s:label\":\"yes\",\"a2s:label-pos\":\"" + pos + "\",\"a2s:delref\":1}"
+		canvas, err = NewCanvas([]byte(strings.Join(input, "\n")), 9, false)
+		if err != nil {
+			t.Fatalf("Error creating canvas: %s", err)
+		}
+		actual = string(CanvasToSVG(canvas, false, "", 9, 16))
+		ut.AssertEqual(t, true, strings.Contains(actual, "<text id=\"label2\" x=\""+expected+"\" y=\"28\" text-anchor=\"middle\" fill=\"#000\">yes</text>\n"))
+	}
+
+	// The label clears the end by its width in cells, two for each wide character.
+	input[4] = "[4,1]: {\"a2s:label\":\"日本\",\"a2s:label-pos\":\"start\",\"a2s:delref\":1}"
+	canvas, err = NewCanvas([]byte(strings.Join(input, "\n")), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	actual = string(CanvasToSVG(canvas, false, "", 9, 16))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<text id=\"label2\" x=\"67.5\" y=\"28\" text-anchor=\"middle\" fill=\"#000\">日本</text>\n"))
+}
+
+func TestCanvasToSVGGroupObjects(t *testing.T) {
+	t.Parallel()
+	input := []string{
+		"+-----+",
+		"|[a]  |--",
+		"+-----+",
+		"",
+		"[a]: {\"fill\":\"#eee\",\"a2s:delref\":1}",
+	}
+	canvas, err := NewCanvas([]byte(strings.Join(input, "\n")), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	actual := string(CanvasToSVGWithOptions(canvas, RenderOptions{GroupObjects: true}))
+	ut.AssertEqual(t, true, strings.Contains(actual, "    <g data-a2s-id=\"closed0\" data-a2s-tag=\"a\" data-a2s-x=\"0\" data-a2s-y=\"0\"><path id=\"closed0\" "))
+	ut.AssertEqual(t, true, strings.Contains(actual, "    <g data-a2s-id=\"open1\" data-a2s-x=\"7\" data-a2s-y=\"1\"><path id=\"open1\" "))
+	// The reference is deleted, along with its group.
+	ut.AssertEqual(t, false, strings.Contains(actual, "data-a2s-id=\"obj2\""))
+	ut.AssertEqual(t, 2, strings.Count(actual, "/></g>\n")+strings.Count(actual, "</text></g>\n"))
+
+	actual = string(CanvasToSVGWithOptions(canvas, RenderOptions{}))
+	ut.AssertEqual(t, false, strings.Contains(actual, "data-a2s-"))
+
+	// A reference that is kept is grouped like any other object.
+	input[len(input)-1] = "[a]: {\"fill\":\"#eee\"}"
+	canvas, err = NewCanvas([]byte(strings.Join(input, "\n")), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	actual = string(CanvasToSVGWithOptions(canvas, RenderOptions{GroupObjects: true}))
+	ut.AssertEqual(t, true, strings.Contains(actual, "    <g data-a2s-id=\"obj2\" data-a2s-tag=\"a\" data-a2s-x=\"1\" data-a2s-y=\"1\"><text id=\"obj2\" "))
+	ut.AssertEqual(t, 3, strings.Count(actual, "/></g>\n")+strings.Count(actual, "</text></g>\n"))
+}
+
+func TestCanvasToSVGPointData(t *testing.T) {
+	t.Parallel()
+	input := []string{
+		"+-----+",
+		"|[a]  |--",
+		"+-----+",
+		"",
+		"[a]: {\"fill\":\"#eee\"}",
+	}
+	canvas, err := NewCanvas([]byte(strings.Join(input, "\n")), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	actual := string(CanvasToSVGWithOptions(canvas, RenderOptions{PointData: true}))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<g data-a2s-id=\"closed0\" data-a2s-tag=\"a\" data-a2s-points=\"0,0 1,0 2,0 3,0 4,0 5,0 6,0 6,1 6,2 5,2 4,2 3,2 2,2 1,2 0,2 0,1\" data-a2s-x=\"0\" data-a2s-y=\"0\"><path id=\"closed0\" "))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<g data-a2s-id=\"open1\" data-a2s-points=\"7,1 8,1\" data-a2s-x=\"7\" data-a2s-y=\"1\">"))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<g data-a2s-id=\"obj2\" data-a2s-tag=\"a\" data-a2s-points=\"1,1 2,1 3,1\" data-a2s-x=\"1\" data-a2s-y=\"1\">"))
+}
+
+func TestCanvasToSVGDelref(t *testing.T) {
+	t.Parallel()
+	input := []string{
+		"+------------+",
+		"| +--------+ |",
+		"| |[b] Hi  | |",
+		"| +--------+ |",
+		"|[b]         |",
+		"+------------+",
+		"",
+		"[b]: {\"fill\":\"#eee\",\"a2s:delref\":1}",
+	}
+	canvas, err := NewCanvas([]byte(strings.Join(input, "\n")), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	objs := canvas.Objects()
+	ut.AssertEqual(t, []string{"b", "", "", "b"}, getTags(objs))
+	ut.AssertEqual(t, []bool{false, false, false, true}, []bool{IsReference(objs[0]), IsReference(objs[1]), IsReference(objs[2]), IsReference(objs[3])})
+
+	// The reference is removed although it isn't on the first column, while the bracketed text
+	// that isn't a reference is kept.
+	actual := string(CanvasToSVG(canvas, false, "", 9, 16))
+	ut.AssertEqual(t, false, strings.Contains(actual, ">[b]</text>"))
+	ut.AssertEqual(t, true, strings.Contains(actual, ">[b] Hi</text>"))
+}
+
+func TestCanvasToSVGTagDefinition(t *testing.T) {
+	t.Parallel()
+	input := []string{
+		"+-----+",
+		"| foo |",
+		"+-----+",
+		"",
+		"[0,0]: {\"fill\":\"#eee\"}",
+	}
+	canvas, err := NewCanvas([]byte(strings.Join(input, "\n")), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	actual := string(CanvasToSVG(canvas, false, "", 9, 16))
+	ut.AssertEqual(t, 1, strings.Count(actual, "<text "))
+	ut.AssertEqual(t, false, strings.Contains(actual, "[0,0]"))
+	ut.AssertEqual(t, true, strings.Contains(actual, "fill=\"#eee\""))
+}
+
+func TestCanvasToSVGIndent(t *testing.T) {
+	t.Parallel()
+	canvas, err := Parse([]byte("  indented\nflush"), ParseOptions{KeepIndent: true})
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	actual := string(CanvasToSVG(canvas, false, "", 9, 16))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<text id=\"obj0\" x=\"4.5\" y=\"8\" xml:space=\"preserve\" fill=\"#000\">  indented</text>"))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<text id=\"obj1\" x=\"4.5\" y=\"24\" fill=\"#000\">flush</text>"))
+}
+
+func TestCanvasToSVGWeight(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		options  string
+		expected string
+	}{
+		{`{"a2s:weight":3}`, `<path id="open0" stroke-width="3.5" d=`},
+		{`{"a2s:weight":1}`, `<path id="open0" stroke-width="1" d=`},
+		{`{"a2s:weight":9}`, `<path id="open0" stroke-width="7" d=`},
+		{`{"a2s:weight":3,"stroke-width":"4"}`, `<path id="open0" stroke-width="4" d=`},
+		{`{}`, `<path id="open0" d=`},
+	}
+	for i, line := range data {
+		canvas, err := NewCanvas([]byte("-----\n\n[0,0]: "+line.options), 9, false)
+		if err != nil {
+			t.Fatalf("Test %d: error creating canvas: %s", i, err)
+		}
+		actual := string(CanvasToSVG(canvas, false, "", 9, 16))
+		ut.AssertEqualIndex(t, i, true, strings.Contains(actual, line.expected))
+	}
+}
+
+func TestCanvasToSVGSymbols(t *testing.T) {
+	t.Parallel()
+	input := []string{
+		"+---+ +---+",
+		"| a | | b |",
+		"+---+ +---+",
+		"",
+		"+---+ .---.",
+		"| c | | d |",
+		"+---+ '---'",
+	}
+	canvas, err := NewCanvas([]byte(strings.Join(input, "\n")), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	actual := string(CanvasToSVGWithOptions(canvas, RenderOptions{Symbols: true}))
+	ut.AssertEqual(t, 1, strings.Count(actual, "<symbol "))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<symbol id=\"shape0\" overflow=\"visible\"><path d=\"M 4.5 8 L 13.5 8 L 22.5 8 L 31.5 8 L 40.5 8 L 40.5 24 L 40.5 40 L 31.5 40 L 22.5 40 L 13.5 40 L 4.5 40 L 4.5 24 Z\" /></symbol>"))
+	ut.AssertEqual(t, 3, strings.Count(actual, "xlink:href=\"#shape0\""))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<use id=\"closed1\" fill=\"#fff\" filter=\"url(#dsFilter)\" xlink:href=\"#shape0\" transform=\"translate(54 0)\" />"))
+	ut.AssertEqual(t, true, strings.Contains(actual, "transform=\"translate(0 64)\""))
+	// The rounded box has a different shape.
+	ut.AssertEqual(t, 1, strings.Count(actual, "<path id=\"closed"))
+}
+
+func TestCanvasToSVGContrast(t *testing.T) {
+	t.Parallel()
+	input := []string{
+		"+-----+",
+		"|[a]  |",
+		"| foo |",
+		"+-----+",
+		"",
+		"[a]: {\"fill\":\"#888\"}",
+	}
+	canvas, err := NewCanvas([]byte(strings.Join(input, "\n")), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	actual := string(CanvasToSVGWithOptions(canvas, RenderOptions{}))
+	ut.AssertEqual(t, true, strings.Contains(actual, "fill=\"#000\">foo</text>"))
+	actual = string(CanvasToSVGWithOptions(canvas, RenderOptions{MinBrightness: 150}))
+	ut.AssertEqual(t, true, strings.Contains(actual, "fill=\"#fff\">foo</text>"))
+}
+
+func TestRenderColors(t *testing.T) {
+	t.Parallel()
+	input := []string{
+		"+-----+  +---+",
+		"|[a]  |  |   |",
+		"| foo |  +---+",
+		"+-----+ bar",
+		"   ------>",
+		"",
+		"[a]: {\"fill\":\"#222\"}",
+		"[3,4]: {\"a2s:label\":\"go\",\"a2s:chip\":\"#000\"}",
+	}
+	canvas, err := NewCanvas([]byte(strings.Join(input, "\n")), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	result := Render(canvas, nil, RenderOptions{})
+	ut.AssertEqual(t, string(CanvasToSVGWithOptions(canvas, RenderOptions{})), string(result.SVG))
+	expected := map[int]Colors{
+		0: {Fill: "#222"},
+		1: {Fill: "#fff"},
+		2: {Fill: "#000", Text: "#fff"},
+		3: {Text: "#fff"},
+		4: {Text: "#fff"},
+		5: {Text: "#000"},
+	}
+	ut.AssertEqual(t, expected, result.Colors)
+	// The colors are resolved alike without rendering.
+	ut.AssertEqual(t, expected, newRenderer(canvas, nil, RenderOptions{}).resolveColors())
+}
+
+func TestCanvasToSVGOrientation(t *testing.T) {
+	t.Parallel()
+	input := []string{
+		"+-----+",
+		"| foo |",
+		"+-----+",
+	}
+	canvas, err := NewCanvas([]byte(strings.Join(input, "\n")), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	data := []struct {
+		rotate    int
+		mirror    bool
+		svg       string
+		transform string
+	}{
+		{0, false, `<svg width="72px" height="64px"`, ""},
+		{90, false, `<svg width="64px" height="72px"`, `<g transform="translate(64 0) rotate(90)">`},
+		{180, false, `<svg width="72px" height="64px"`, `<g transform="translate(72 64) rotate(180)">`},
+		{-90, false, `<svg width="64px" height="72px"`, `<g transform="translate(0 72) rotate(270)">`},
+		{0, true, `<svg width="72px" height="64px"`, `<g transform="translate(72 0) scale(-1 1)">`},
+		{90, true, `<svg width="64px" height="72px"`, `<g transform="translate(64 0) rotate(90) translate(72 0) scale(-1 1)">`},
+	}
+	for i, line := range data {
+		actual := string(CanvasToSVGWithOptions(canvas, RenderOptions{Rotate: line.rotate, Mirror: line.mirror}))
+		ut.AssertEqualIndex(t, i, true, strings.Contains(actual, line.svg))
+		if line.transform == "" {
+			ut.AssertEqualIndex(t, i, false, strings.Contains(actual, "<g transform="))
+			continue
+		}
+		ut.AssertEqualIndex(t, i, true, strings.Contains(actual, "  "+line.transform+"\n"))
+		ut.AssertEqualIndex(t, i, true, strings.HasSuffix(actual, "  </g>\n  </g>\n</svg>\n"))
+	}
+}
+
+func TestCanvasToSVGRoundTo(t *testing.T) {
+	t.Parallel()
+	input := []string{
+		"+-----+",
+		"| foo |",
+		"+-----+",
+	}
+	canvas, err := NewCanvas([]byte(strings.Join(input, "\n")), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	data := []struct {
+		roundTo   int
+		rotate    int
+		svg       string
+		transform string
+	}{
+		{0, 0, `<svg width="72px" height="64px"`, ""},
+		{8, 0, `<svg width="72px" height="64px"`, ""},
+		{10, 0, `<svg width="80px" height="70px"`, `<g transform="translate(4 3)">`},
+		{25, 0, `<svg width="75px" height="75px"`, `<g transform="translate(1.5 5.5)">`},
+		{10, 90, `<svg width="70px" height="80px"`, `<g transform="translate(3 4) translate(64 0) rotate(90)">`},
+	}
+	for i, line := range data {
+		actual := string(CanvasToSVGWithOptions(canvas, RenderOptions{RoundTo: line.roundTo, Rotate: line.rotate}))
+		ut.AssertEqualIndex(t, i, true, strings.Contains(actual, line.svg))
+		if line.transform == "" {
+			ut.AssertEqualIndex(t, i, false, strings.Contains(actual, "<g transform="))
+			continue
+		}
+		ut.AssertEqualIndex(t, i, true, strings.Contains(actual, "  "+line.transform+"\n"))
+	}
+}
+
+func TestCanvasToSVGOrigin(t *testing.T) {
+	t.Parallel()
+	input := []string{
+		"+--+",
+		"|Hi|--->",
+		"+--+",
+	}
+	canvas, err := NewCanvas([]byte(strings.Join(input, "\n")), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	actual := string(CanvasToSVGWithOptions(canvas, RenderOptions{OriginX: 100, OriginY: 50.5}))
+	for _, expected := range []string{
+		"<svg width=\"81px\" height=\"64px\" viewBox=\"100 50.5 81 64\" ",
+		"<path id=\"closed0\" fill=\"#fff\" filter=\"url(#dsFilter)\" d=\"M 104.5 58.5 L 113.5 58.5 L 122.5 58.5 L 131.5 58.5 L 131.5 74.5 L 131.5 90.5 L 122.5 90.5 L 113.5 90.5 L 104.5 90.5 L 104.5 74.5 Z\" />",
+		"<path id=\"open1\" marker-end=\"url(#Pointer)\" d=\"M 140.5 74.5 L 149.5 74.5 L 158.5 74.5 L 167.5 74.5 \" />",
+		"<text id=\"obj2\" x=\"113.5\" y=\"74.5\" fill=\"#000\">Hi</text>",
+	} {
+		ut.AssertEqual(t, true, strings.Contains(actual, expected))
+	}
+
+	// Transforms of the diagram apply around the origin.
+	actual = string(CanvasToSVGWithOptions(canvas, RenderOptions{OriginX: 100, OriginY: 50.5, Mirror: true}))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<g transform=\"translate(100 50.5) translate(81 0) scale(-1 1) translate(-100 -50.5)\">"))
+}
+
+func TestCanvasToSVGHighlight(t *testing.T) {
+	t.Parallel()
+	input := []string{
+		"+--+  +---+",
+		"|  |  |[a]|-->",
+		"+--+  +---+",
+		"",
+		"[a]: {\"fill\":\"#eee\"}",
+	}
+	canvas, err := NewCanvas([]byte(strings.Join(input, "\n")), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	data := []struct {
+		highlight []string
+		expected  []string
+	}{
+		{nil, nil},
+		{[]string{"closed0"}, []string{"<rect id=\"highlight-closed0\" x=\"0\" y=\"0\" width=\"36\" height=\"48\" rx=\"3\" />"}},
+		{[]string{"a", "missing"}, []string{"<rect id=\"highlight-closed1\" x=\"54\" y=\"0\" width=\"45\" height=\"48\" rx=\"3\" />", "<rect id=\"highlight-obj3\" x=\"63\" y=\"16\" width=\"27\" height=\"16\" rx=\"3\" />"}},
+	}
+	for i, line := range data {
+		actual := string(CanvasToSVGWithOptions(canvas, RenderOptions{Highlight: line.highlight}))
+		ut.AssertEqualIndex(t, i, len(line.expected) != 0, strings.Contains(actual, "<g id=\"highlights\" fill=\"#ffd400\" fill-opacity=\"0.3\""))
+		ut.AssertEqualIndex(t, i, len(line.expected), strings.Count(actual, "<rect id=\"highlight-"))
+		for _, expected := range line.expected {
+			ut.AssertEqualIndex(t, i, true, strings.Contains(actual, expected))
+		}
+	}
+}
+
+func TestCanvasToSVGInvalidFill(t *testing.T) {
+	t.Parallel()
+	input := []string{
+		"+------+",
+		"| [a]  |",
+		"+------+",
+		"",
+		"[a]: {\"fill\":\"chartruese\"}",
+	}
+	canvas, err := NewCanvas([]byte(strings.Join(input, "\n")), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	actual := string(CanvasToSVG(canvas, false, "", 9, 16))
+	ut.AssertEqual(t, false, strings.Contains(actual, "chartruese"))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<path id=\"closed0\" fill=\"#fff\" filter=\"url(#dsFilter)\" d="))
+	ut.AssertEqual(t, "chartruese", canvas.Options()["a"]["fill"])
+
+	// So is a fill that isn't a string.
+	input[4] = "[a]: {\"fill\":1}"
+	canvas, err = NewCanvas([]byte(strings.Join(input, "\n")), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	actual = string(CanvasToSVG(canvas, false, "", 9, 16))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<path id=\"closed0\" fill=\"#fff\" filter=\"url(#dsFilter)\" d="))
+}
+
+func TestCanvasToSVGColorMarkers(t *testing.T) {
+	t.Parallel()
+	input := []string{
+		"--->",
+		"",
+		"--->",
+		"",
+		"<---",
+		"",
+		"[0,0]: {\"stroke\":\"#f00\"}",
+		"[0,2]: {\"stroke\":\"blue\"}",
+		"[0,4]: {\"stroke\":\"red\"}",
+	}
+	canvas, err := NewCanvas([]byte(strings.Join(input, "\n")), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	actual := string(CanvasToSVG(canvas, false, "", 9, 16))
+	// Lines of the same color share their markers.
+	ut.AssertEqual(t, 2, strings.Count(actual, "<marker id=\"Pointer-"))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<marker id=\"Pointer-ff0000\""))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<marker id=\"Pointer-0000ff\""))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<path d=\"M 0 0 L 10 5 L 0 10 z\" fill=\"#0000ff\" />"))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<path id=\"open0\" marker-end=\"url(#Pointer-ff0000)\" stroke=\"#f00\" d="))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<path id=\"open1\" marker-end=\"url(#Pointer-0000ff)\" stroke=\"blue\" d="))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<path id=\"open2\" marker-start=\"url(#iPointer-ff0000)\" stroke=\"red\" d="))
+}
+
+func TestCanvasToSVGClip(t *testing.T) {
+	t.Parallel()
+	input := []string{
+		"+--+  +---+",
+		"|A |  | B |",
+		"+--+  +---+",
+		"",
+		"  +-+",
+		"  |C|",
+		"  +-+",
+	}
+	canvas, err := NewCanvas([]byte(strings.Join(input, "\n")), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	actual := string(CanvasToSVGWithOptions(canvas, RenderOptions{Clip: image.Rect(5, 0, 11, 5)}))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<svg width=\"63px\" height=\"96px\" version="))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<g transform=\"translate(-45 0)\">"))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<path id=\"closed1\" fill=\"#fff\" filter=\"url(#dsFilter)\" d=\"M 58.5 8 L 67.5 8 "))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<text id=\"obj4\" x=\"76.5\" y=\"24\" fill=\"#000\">B</text>"))
+	for _, id := range []string{"closed0", "closed2", "obj3", "obj5"} {
+		ut.AssertEqual(t, false, strings.Contains(actual, "id=\""+id+"\""))
+	}
+}
+
+func TestCanvasToSVGCallout(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		callout  string
+		expected []string
+	}{
+		// 0 Label inside its box
+		{
+			"",
+			[]string{"<text id=\"obj1\" x=\"13.5\" y=\"56\" fill=\"#000\">Storage</text>"},
+		},
+		// 1 Label above its box
+		{
+			"above",
+			[]string{
+				"<line id=\"leader1\" x1=\"22.5\" y1=\"40\" x2=\"22.5\" y2=\"32\" stroke=\"#000\" stroke-width=\"1\" />",
+				"<text id=\"obj1\" x=\"22.5\" y=\"24\" text-anchor=\"middle\" fill=\"#000\">Storage</text>",
+			},
+		},
+		// 2 Label to the right of its box
+		{
+			"right",
+			[]string{
+				"<line id=\"leader1\" x1=\"40.5\" y1=\"56\" x2=\"54\" y2=\"56\" stroke=\"#000\" stroke-width=\"1\" />",
+				"<text id=\"obj1\" x=\"58.5\" y=\"60\" fill=\"#000\">Storage</text>",
+			},
+		},
+	}
+	for i, line := range data {
+		input := []string{
+			"",
+			"",
+			"+---+",
+			"|[a]|",
+			"+---+",
+			"",
+			"[a]: {\"a2s:label\":\"Storage\",\"a2s:callout\":\"" + line.callout + "\"}",
+		}
+		canvas, err := NewCanvas([]byte(strings.Join(input, "\n")), 9, false)
+		if err != nil {
+			t.Fatalf("Test %d: error creating canvas: %s", i, err)
+		}
+		actual := string(CanvasToSVG(canvas, false, "", 9, 16))
+		for _, e := range line.expected {
+			ut.AssertEqualIndex(t, i, true, strings.Contains(actual, e))
+		}
+		ut.AssertEqualIndex(t, i, len(line.expected) == 2, strings.Contains(actual, "<line id=\"leader1\""))
+	}
+}
+
+func TestCanvasToSVGClipFrame(t *testing.T) {
+	t.Parallel()
+	input := []string{
+		".----------.",
+		"| [f]      |",
+		"| +--+ hi  |",
+		"| |  |---->|",
+		"| +--+     |",
+		"'----------'",
+		"",
+		"+--+",
+		"|  |",
+		"+--+",
+		"",
+		"[f]: {\"a2s:clip\":true}",
+	}
+	canvas, err := NewCanvas([]byte(strings.Join(input, "\n")), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	actual := string(CanvasToSVG(canvas, false, "", 9, 16))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<clipPath id=\"clip0\"><path d=\"M 4.5 18 Q 4.5 8 14.5 8 L "))
+	ut.AssertEqual(t, 1, strings.Count(actual, "<clipPath "))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<path id=\"closed1\" fill=\"#fff\" filter=\"url(#dsFilter)\" clip-path=\"url(#clip0)\" d="))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<path id=\"open2\" marker-end=\"url(#Pointer)\" clip-path=\"url(#clip0)\" d="))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<text id=\"obj5\" x=\"67.5\" y=\"40\" clip-path=\"url(#clip0)\" "))
+	// Neither the frame nor the objects outside of it are clipped.
+	ut.AssertEqual(t, true, strings.Contains(actual, "<path id=\"closed0\" filter=\"url(#dsFilter)\" d="))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<path id=\"closed3\" fill=\"#fff\" filter=\"url(#dsFilter)\" d="))
+
+	// Uses of symbols are clipped by a group, as their own clip path would be translated along
+	// with them.
+	actual = string(CanvasToSVGWithOptions(canvas, RenderOptions{Symbols: true}))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<g clip-path=\"url(#clip0)\"><use id=\"closed1\" fill=\"#fff\" filter=\"url(#dsFilter)\" xlink:href=\"#shape1\" transform=\"translate(18 32)\" /></g>"))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<use id=\"closed3\" fill=\"#fff\" filter=\"url(#dsFilter)\" xlink:href=\"#shape1\" transform=\"translate(0 112)\" />"))
+	ut.AssertEqual(t, 4, strings.Count(actual, "clip-path="))
+}
+
+func TestCanvasToSVGPalette(t *testing.T) {
+	t.Parallel()
+	input := []string{
+		"+---+ +---+ +---+ +---+",
+		"|[a]| |[a]| |[b]| |[c]|",
+		"+---+ +---+ +---+ +---+",
+		"",
+		"[c]: {\"fill\":\"#123\"}",
+	}
+	canvas, err := NewCanvas([]byte(strings.Join(input, "\n")), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	opts := RenderOptions{Palette: []string{"#fdd", "#dfd", "#ddf", "#ffd"}}
+	colors := Render(canvas, nil, opts).Colors
+	ut.AssertEqual(t, "#fdd", colors[0].Fill)
+	ut.AssertEqual(t, colors[0].Fill, colors[1].Fill)
+	ut.AssertEqual(t, "#dfd", colors[2].Fill)
+	// Fills set by tag are kept.
+	ut.AssertEqual(t, "#123", colors[3].Fill)
+
+	// The fills don't depend on the rest of the diagram.
+	canvas, err = NewCanvas([]byte("+---+\n|[b]|\n+---+"), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	actual := string(CanvasToSVGWithOptions(canvas, opts))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<path id=\"closed0\" fill=\"#dfd\" filter=\"url(#dsFilter)\" d="))
+}
+
+func TestCanvasToSVGMinimap(t *testing.T) {
+	t.Parallel()
+	input := []string{
+		"+--+",
+		"|Hi|--->",
+		"+--+",
+	}
+	canvas, err := NewCanvas([]byte(strings.Join(input, "\n")), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	actual := string(CanvasToSVGWithOptions(canvas, RenderOptions{}))
+	ut.AssertEqual(t, false, strings.Contains(actual, "minimap"))
+
+	actual = string(CanvasToSVGWithOptions(canvas, RenderOptions{Minimap: 0.25}))
+	expected := "  <g id=\"minimap\" transform=\"translate(51.75 9) scale(0.25)\" fill=\"#ccc\" stroke=\"#666\" stroke-width=\"4\">\n" +
+		"    <rect id=\"minimap-frame\" x=\"0\" y=\"0\" width=\"81\" height=\"64\" fill=\"#fff\" fill-opacity=\"0.8\" />\n" +
+		"    <rect id=\"minimap-closed0\" x=\"0\" y=\"0\" width=\"36\" height=\"48\" />\n" +
+		"    <rect id=\"minimap-open1\" x=\"36\" y=\"16\" width=\"36\" height=\"16\" />\n" +
+		"    <rect id=\"minimap-obj2\" x=\"9\" y=\"16\" width=\"18\" height=\"16\" />\n" +
+		"  </g>\n" +
+		"</svg>\n"
+	ut.AssertEqual(t, true, strings.HasSuffix(actual, expected))
+	ut.AssertEqual(t, len(canvas.Objects()), strings.Count(actual, "<rect id=\"minimap-")-1)
+
+	// The minimap of a clipped view shows the view, in its top right corner. It is drawn within
+	// the transforms of the view, so that it isn't moved out of the output.
+	input = []string{
+		"+--+                             +--+",
+		"|Hi|---------------------------->|Yo|",
+		"+--+                             +--+",
+	}
+	canvas, err = NewCanvas([]byte(strings.Join(input, "\n")), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	actual = string(CanvasToSVGWithOptions(canvas, RenderOptions{Minimap: 0.25, Clip: image.Rect(30, 0, 37, 2)}))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<svg width=\"72px\" height=\"48px\" "))
+	ut.AssertEqual(t, true, strings.Contains(actual, "  <g transform=\"translate(-270 0)\">\n"))
+	expected = "  <g id=\"minimap\" transform=\"translate(315 9) scale(0.25)\" fill=\"#ccc\" stroke=\"#666\" stroke-width=\"4\">\n" +
+		"    <rect id=\"minimap-frame\" x=\"0\" y=\"0\" width=\"72\" height=\"48\" fill=\"#fff\" fill-opacity=\"0.8\" />\n" +
+		"    <rect id=\"minimap-closed1\" x=\"27\" y=\"0\" width=\"36\" height=\"48\" />\n" +
+		"    <rect id=\"minimap-open2\" x=\"0\" y=\"16\" width=\"27\" height=\"16\" />\n" +
+		"    <rect id=\"minimap-obj4\" x=\"36\" y=\"16\" width=\"18\" height=\"16\" />\n" +
+		"  </g>\n" +
+		"  </g>\n" +
+		"</svg>\n"
+	ut.AssertEqual(t, true, strings.HasSuffix(actual, expected))
+
+	// The minimap of a rotated view turns with it.
+	actual = string(CanvasToSVGWithOptions(canvas, RenderOptions{Minimap: 0.25, Rotate: 90}))
+	ut.AssertEqual(t, true, strings.Contains(actual, "  <g transform=\"translate(64 0) rotate(90)\">\n"))
+	ut.AssertEqual(t, true, strings.Contains(actual, "  <g id=\"minimap\" transform=\"translate(247.5 9) scale(0.25)\" "))
+	ut.AssertEqual(t, true, strings.HasSuffix(actual, "  </g>\n  </g>\n</svg>\n"))
+}
+
+func TestCanvasToSVGDoubleMarkers(t *testing.T) {
+	t.Parallel()
+	input := []string{
+		"-->>",
+		"",
+		"<<-->",
+		"",
+		"--->>",
+		"",
+		"[0,4]: {\"stroke\":\"#f00\"}",
+	}
+	canvas, err := NewCanvas([]byte(strings.Join(input, "\n")), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	actual := string(CanvasToSVG(canvas, false, "", 9, 16))
+	ut.AssertEqual(t, 1, strings.Count(actual, "<marker id=\"DoublePointer\""))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<path id=\"open0\" marker-end=\"url(#DoublePointer)\" d=\"M 4.5 8 L 13.5 8 L 22.5 8 L 31.5 8 \" />"))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<path id=\"open1\" marker-start=\"url(#iDoublePointer)\" marker-end=\"url(#Pointer)\" "))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<marker id=\"DoublePointer-ff0000\""))
+	ut.AssertEqual(t, true, strings.Contains(actual, "marker-end=\"url(#DoublePointer-ff0000)\""))
+
+	// A single marker doesn't define the double chevrons.
+	canvas, err = NewCanvas([]byte("-->"), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	actual = string(CanvasToSVG(canvas, false, "", 9, 16))
+	ut.AssertEqual(t, false, strings.Contains(actual, "DoublePointer"))
+}
+
+func TestCanvasToSVGMixedDashes(t *testing.T) {
+	t.Parallel()
+	canvas, err := NewCanvas([]byte("<--==--"), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	actual := string(CanvasToSVG(canvas, false, "", 9, 16))
+	expected := "    <g id=\"open0\" >\n" +
+		"      <path marker-start=\"url(#iPointer)\" d=\"M 4.5 8 L 13.5 8 L 22.5 8 \" />\n" +
+		"      <path stroke-dasharray=\"5 5\" d=\"M 22.5 8 L 31.5 8 L 40.5 8 L 49.5 8 \" />\n" +
+		"      <path d=\"M 49.5 8 L 58.5 8 \" />\n" +
+		"    </g>\n"
+	ut.AssertEqual(t, true, strings.Contains(actual, expected))
+
+	// Lines that are dashed throughout remain a single path.
+	canvas, err = NewCanvas([]byte("====>"), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	actual = string(CanvasToSVG(canvas, false, "", 9, 16))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<path id=\"open0\" stroke-dasharray=\"5 5\" marker-end=\"url(#Pointer)\" d="))
+}
+
+func TestCanvasToSVGTaper(t *testing.T) {
+	t.Parallel()
+	canvas, err := NewCanvas([]byte("---->\n\n->"), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	actual := string(CanvasToSVGWithOptions(canvas, RenderOptions{Taper: true}))
+	expected := "    <g id=\"open0\" >\n" +
+		"      <path d=\"M 4.5 8 L 13.5 8 L 22.5 8 L 31.5 8 \" />\n" +
+		"      <path stroke-width=\"1\" d=\"M 31.5 8 L 40.5 8 \" />\n" +
+		"      <path stroke=\"none\" marker-end=\"url(#Pointer)\" d=\"M 31.5 8 L 40.5 8 \" />\n" +
+		"    </g>\n"
+	ut.AssertEqual(t, true, strings.Contains(actual, expected))
+	// Lines too short to taper are left as they are.
+	ut.AssertEqual(t, true, strings.Contains(actual, "<path id=\"open1\" marker-end=\"url(#Pointer)\" d=\"M 4.5 40 L 13.5 40 \" />"))
+
+	// Without the option, lines are a single path.
+	actual = string(CanvasToSVGWithOptions(canvas, RenderOptions{}))
+	ut.AssertEqual(t, false, strings.Contains(actual, "<g id=\"open0\""))
+}
+
+func TestCanvasToSVGAnimate(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		input    []string
+		expected []string
+	}{
+		// 0 Box fading in after a delay, along with its text
+		{
+			[]string{
+				"+----+",
+				"|[a] |",
+				"+----+",
+				"",
+				"[a]: {\"a2s:animate\":\"fade\",\"a2s:delay\":\"1s\"}",
+			},
+			[]string{
+				"<path id=\"closed0\" filter=\"url(#dsFilter)\" opacity=\"0\" d=\"M 4.5 8 L 13.5 8 L 22.5 8 L 31.5 8 L 40.5 8 L 49.5 8 L 49.5 24 L 49.5 40 L 40.5 40 L 31.5 40 L 22.5 40 L 13.5 40 L 4.5 40 L 4.5 24 Z\"><animate attributeName=\"opacity\" from=\"0\" to=\"1\" dur=\"1s\" begin=\"1s\" fill=\"freeze\" /></path>",
+				"<text id=\"obj1\" x=\"13.5\" y=\"24\" opacity=\"0\" fill=\"#000\"><animate attributeName=\"opacity\" from=\"0\" to=\"1\" dur=\"1s\" begin=\"1s\" fill=\"freeze\" />[a]</text>",
+			},
+		},
+		// 1 Line drawn from its start
+		{
+			[]string{
+				"---->",
+				"",
+				"[0,0]: {\"a2s:animate\":\"draw\"}",
+			},
+			[]string{
+				"<path id=\"open0\" marker-end=\"url(#Pointer)\" pathLength=\"1\" stroke-dasharray=\"1\" stroke-dashoffset=\"1\" d=\"M 4.5 8 L 13.5 8 L 22.5 8 L 31.5 8 L 40.5 8 \"><animate attributeName=\"stroke-dashoffset\" from=\"1\" to=\"0\" dur=\"1s\" begin=\"0s\" fill=\"freeze\" /></path>",
+			},
+		},
+		// 2 Dashed line faded in rather than drawn
+		{
+			[]string{
+				"--==>",
+				"",
+				"[0,0]: {\"a2s:animate\":\"draw\"}",
+			},
+			[]string{
+				"<g id=\"open0\" opacity=\"0\" >\n      <animate attributeName=\"opacity\"",
+			},
+		},
+	}
+	for i, line := range data {
+		canvas, err := NewCanvas([]byte(strings.Join(line.input, "\n")), 9, false)
+		if err != nil {
+			t.Fatalf("Error creating canvas: %s", err)
+		}
+		actual := string(CanvasToSVG(canvas, false, "", 9, 16))
+		for _, expected := range line.expected {
+			ut.AssertEqualIndex(t, i, true, strings.Contains(actual, expected))
+		}
+	}
+}
+
+func TestCanvasToSVGReducedMotion(t *testing.T) {
+	t.Parallel()
+	input := []string{
+		"+----+",
+		"|[a] |---->",
+		"+----+",
+		"",
+		"[a]: {\"a2s:animate\":\"fade\",\"a2s:delay\":\"1s\"}",
+		"[6,1]: {\"a2s:animate\":\"draw\"}",
+	}
+	canvas, err := NewCanvas([]byte(strings.Join(input, "\n")), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	actual := string(CanvasToSVGWithOptions(canvas, RenderOptions{}))
+	ut.AssertEqual(t, 3, strings.Count(actual, "<animate "))
+
+	actual = string(CanvasToSVGWithOptions(canvas, RenderOptions{ReducedMotion: true}))
+	ut.AssertEqual(t, false, strings.Contains(actual, "<animate "))
+	ut.AssertEqual(t, false, strings.Contains(actual, "opacity=\"0\""))
+	ut.AssertEqual(t, false, strings.Contains(actual, "stroke-dashoffset"))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<path id=\"closed0\" filter=\"url(#dsFilter)\" d="))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<path id=\"open1\" marker-end=\"url(#Pointer)\" d="))
+}
+
+func TestCanvasToSVGStylesheet(t *testing.T) {
+	t.Parallel()
+	input := []string{
+		".-----.",
+		"|[a]  |--x-->",
+		"|Hi   |  :",
+		"'-----'  o",
+		"  Label",
+		"",
+		"[a]: {\"fill\":\"#00f\"}",
+	}
+	canvas, err := NewCanvas([]byte(strings.Join(input, "\n")), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	actual := string(CanvasToSVGWithOptions(canvas, RenderOptions{Stylesheet: "a2s.css?v=1&x"}))
+	ut.AssertEqual(t, true, strings.HasPrefix(actual, "<?xml-stylesheet href=\"a2s.css?v=1&amp;x\" type=\"text/css\"?>\n<!DOCTYPE"))
+	for _, class := range []string{
+		"<g id=\"closed\" class=\"a2s-closed\">",
+		"<g id=\"lines\" class=\"a2s-lines\">",
+		"<g id=\"text\" class=\"a2s-text\" >",
+		"class=\"a2s-dashed\"",
+		"class=\"a2s-tick\"",
+		"class=\"a2s-dot\"",
+		"class=\"a2s-light\">Hi</text>",
+		"class=\"a2s-dark\">Label</text>",
+	} {
+		ut.AssertEqual(t, true, strings.Contains(actual, class))
+	}
+	// The default presentation attributes are left to the stylesheet, while the fill of the tag
+	// is kept.
+	body := actual[strings.Index(actual, "</defs>"):]
+	for _, attr := range []string{"stroke=", "stroke-width=", "stroke-dasharray=", "style=", "text-anchor=", "fill=\"none\""} {
+		ut.AssertEqual(t, false, strings.Contains(body, attr))
+	}
+	ut.AssertEqual(t, 1, strings.Count(body, "fill="))
+	ut.AssertEqual(t, 1, strings.Count(body, "fill=\"#00f\""))
+
+	// Without a stylesheet, no class is emitted.
+	actual = string(CanvasToSVGWithOptions(canvas, RenderOptions{}))
+	ut.AssertEqual(t, false, strings.Contains(actual, "class="))
+	ut.AssertEqual(t, false, strings.Contains(actual, "xml-stylesheet"))
+}
+
+func TestCanvasToSVGOpenArrows(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		input      []string
+		openArrows bool
+		expected   []string
+	}{
+		// 0 Filled by default
+		{
+			[]string{"--->"},
+			false,
+			[]string{"marker-end=\"url(#Pointer)\""},
+		},
+		// 1 Open chevrons selected by option
+		{
+			[]string{"<--->"},
+			true,
+			[]string{"marker-start=\"url(#iOpenPointer)\" marker-end=\"url(#OpenPointer)\""},
+		},
+		// 2 Open chevron selected by tag
+		{
+			[]string{
+				"--->",
+				"",
+				"[0,0]: {\"a2s:marker\":\"open\"}",
+			},
+			false,
+			[]string{"marker-end=\"url(#OpenPointer)\""},
+		},
+		// 3 Filled arrowhead selected by tag, with open chevrons by option
+		{
+			[]string{
+				"--->",
+				"",
+				"--->",
+				"",
+				"[0,0]: {\"a2s:marker\":\"filled\"}",
+			},
+			true,
+			[]string{"id=\"open0\" marker-end=\"url(#Pointer)\"", "id=\"open1\" marker-end=\"url(#OpenPointer)\""},
+		},
+	}
+	for i, line := range data {
+		canvas, err := NewCanvas([]byte(strings.Join(line.input, "\n")), 9, false)
+		if err != nil {
+			t.Fatalf("Test %d: error creating canvas: %s", i, err)
+		}
+		actual := string(CanvasToSVGWithOptions(canvas, RenderOptions{OpenArrows: line.openArrows}))
+		for _, e := range line.expected {
+			ut.AssertEqualIndex(t, i, true, strings.Contains(actual, e))
+		}
+		// The open chevrons are only defined when used.
+		ut.AssertEqualIndex(t, i, i != 0, strings.Contains(actual, "<marker id=\"OpenPointer\""))
+	}
+}
+
+func TestCanvasToSVGWatermark(t *testing.T) {
+	t.Parallel()
+	canvas, err := NewCanvas([]byte("--->"), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	data := []struct {
+		opts     RenderOptions
+		expected string
+	}{
+		// 0 Default
+		{RenderOptions{}, "<!-- Created with ASCIItoSVG -->\n<svg "},
+		// 1 Custom
+		{RenderOptions{Watermark: "Drawn by Example Inc."}, "<!-- Drawn by Example Inc. -->\n<svg "},
+		// 2 Custom, with hyphens that may not appear in a comment
+		{RenderOptions{Watermark: "a--b---c"}, "<!-- a- -b- - -c -->\n<svg "},
+		// 3 Removed
+		{RenderOptions{NoWatermark: true}, "svg11.dtd\">\n<svg "},
+	}
+	for i, line := range data {
+		actual := string(CanvasToSVGWithOptions(canvas, line.opts))
+		ut.AssertEqualIndex(t, i, true, strings.Contains(actual, line.expected))
+	}
+}
+
+func TestCanvasToSVGWrapText(t *testing.T) {
+	t.Parallel()
+	input := []string{
+		"+------------+",
+		"| [a]        |",
+		"|            |",
+		"+------------+",
+		"",
+		"[a]: {\"a2s:label\":\"hello there world\"}",
+	}
+	canvas, err := NewCanvas([]byte(strings.Join(input, "\n")), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	actual := string(CanvasToSVGWithOptions(canvas, RenderOptions{WrapText: true}))
+	expected := "<tspan x=\"22.5\">hello there</tspan><tspan x=\"22.5\" dy=\"16\">world</tspan></text>"
+	ut.AssertEqual(t, true, strings.Contains(actual, expected))
+
+	// Without the option, the label stays on a single line.
+	actual = string(CanvasToSVG(canvas, false, "", 9, 16))
+	ut.AssertEqual(t, true, strings.Contains(actual, ">hello there world</text>"))
+}
+
+func TestWrapText(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		text     string
+		width    int
+		expected []string
+	}{
+		{"hello there world", 11, []string{"hello there", "world"}},
+		{"hello there world", 17, []string{"hello there world"}},
+		{"a verylongword b", 4, []string{"a", "verylongword", "b"}},
+		{"", 4, []string{""}},
+		// Double-width runes take two cells each.
+		{"日本 語", 4, []string{"日本", "語"}},
+	}
+	for i, line := range data {
+		ut.AssertEqualIndex(t, i, line.expected, wrapText(line.text, line.width))
+	}
+}
+
+func TestCanvasToSVGInvert(t *testing.T) {
+	t.Parallel()
+	input := []string{
+		"+-----+  +-----+",
+		"| [a] |  | [b] |",
+		"|  x  |  |  y  |",
+		"+-----+  +-----+",
+		"",
+		"[a]: {\"a2s:invert\":true}",
+		"[b]: {\"a2s:invert\":true,\"fill\":\"#ff0\"}",
+	}
+	canvas, err := NewCanvas([]byte(strings.Join(input, "\n")), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	actual := string(CanvasToSVG(canvas, false, "", 9, 16))
+
+	// The inverted box is filled dark, and its text is white.
+	ut.AssertEqual(t, true, strings.Contains(actual, "<path id=\"closed0\" fill=\"#333\" "))
+	ut.AssertEqual(t, true, strings.Contains(actual, "fill=\"#fff\">x</text>"))
+
+	// A fill of its own takes precedence.
+	ut.AssertEqual(t, true, strings.Contains(actual, "<path id=\"closed1\" fill=\"#ff0\" "))
+	ut.AssertEqual(t, true, strings.Contains(actual, "fill=\"#000\">y</text>"))
+}
+
+func TestCanvasToSVGSeparators(t *testing.T) {
+	t.Parallel()
+	input := []string{
+		"Part one",
+		"",
+		"------------",
+		"",
+		"+--+  ----->",
+		"|  |",
+		"+--+",
+		"",
+		" +---------",
+		" |",
+	}
+	canvas, err := NewCanvas([]byte(strings.Join(input, "\n")), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	actual := string(CanvasToSVGWithOptions(canvas, RenderOptions{Separators: true}))
+
+	// The full-width rule spans the output.
+	ut.AssertEqual(t, true, strings.Contains(actual, "<line id=\"open0\" x1=\"0\" y1=\"40\" x2=\"117\" y2=\"40\" stroke-width=\"1\" />"))
+	// Short lines, lines with markers, and lines with others connected to them are left as is.
+	ut.AssertEqual(t, 1, strings.Count(actual, "<line id="))
+
+	// Without the option, the rule is a plain line.
+	actual = string(CanvasToSVG(canvas, false, "", 9, 16))
+	ut.AssertEqual(t, 0, strings.Count(actual, "<line id="))
+}
+
+func TestCanvasToSVGLegend(t *testing.T) {
+	t.Parallel()
+	input := []string{
+		"+-----+  +-----+  +-----+",
+		"| [a] |  | [b] |  | [c] |",
+		"+-----+  +-----+  +-----+",
+		"",
+		"[a]: {\"fill\":\"#f00\",\"a2s:label\":\"Service\"}",
+		"[b]: {\"fill\":\"#00f\",\"a2s:label\":\"Database\"}",
+		"[c]: {\"fill\":\"#0f0\"}",
+	}
+	canvas, err := NewCanvas([]byte(strings.Join(input, "\n")), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	actual := string(CanvasToSVGWithOptions(canvas, RenderOptions{Legend: true}))
+	expected := "    <rect x=\"9\" y=\"128\" width=\"18\" height=\"16\" fill=\"#f00\" />\n" +
+		"    <text x=\"36\" y=\"140\" stroke=\"none\" fill=\"#000\">Service</text>\n" +
+		"    <rect x=\"9\" y=\"152\" width=\"18\" height=\"16\" fill=\"#00f\" />\n" +
+		"    <text x=\"36\" y=\"164\" stroke=\"none\" fill=\"#000\">Database</text>\n" +
+		"  </g>\n"
+	ut.AssertEqual(t, true, strings.Contains(actual, expected))
+	// The output grows to fit the legend.
+	ut.AssertEqual(t, true, strings.Contains(actual, "<svg width=\"234px\" height=\"184px\""))
+
+	// Without the option, there is no legend.
+	actual = string(CanvasToSVG(canvas, false, "", 9, 16))
+	ut.AssertEqual(t, false, strings.Contains(actual, "id=\"legend\""))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<svg width=\"234px\" height=\"128px\""))
+}
+
+func TestCanvasToSVGRouting(t *testing.T) {
+	t.Parallel()
+	input := []string{
+		"|",
+		"|",
+		"+---->",
+	}
+	data := []struct {
+		routing  string
+		expected string
+	}{
+		// 0 As drawn
+		{"", "d=\"M 4.5 8 L 4.5 24 L 4.5 40 L 13.5 40 L 22.5 40 L 31.5 40 L 40.5 40 L 49.5 40 \""},
+		// 1 Elbow
+		{"elbow", "d=\"M 4.5 8 L 4.5 30 Q 4.5 40 14.5 40 L 49.5 40 \""},
+		// 2 Straight
+		{"straight", "d=\"M 4.5 8 L 49.5 40 \""},
+	}
+	canvas, err := NewCanvas([]byte(strings.Join(input, "\n")), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	for i, line := range data {
+		actual := string(CanvasToSVGWithOptions(canvas, RenderOptions{Routing: line.routing}))
+		ut.AssertEqualIndex(t, i, true, strings.Contains(actual, "marker-end=\"url(#Pointer)\" "+line.expected))
+	}
+
+	// A line may select its own routing.
+	input = append(input, "", "[0,0]: {\"a2s:routing\":\"straight\"}")
+	canvas, err = NewCanvas([]byte(strings.Join(input, "\n")), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	actual := string(CanvasToSVGWithOptions(canvas, RenderOptions{Routing: "elbow"}))
+	ut.AssertEqual(t, true, strings.Contains(actual, data[2].expected))
+
+	// Ticks are carried onto the routed line, at the same fraction of its length.
+	canvas, err = NewCanvas([]byte("|\n|\n+-x-->"), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	actual = string(CanvasToSVGWithOptions(canvas, RenderOptions{Routing: "straight"}))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<line x1=\"29.72\" y1=\"24.78\" x2=\"37.72\" y2=\"32.78\" "))
+	actual = string(CanvasToSVGWithOptions(canvas, RenderOptions{Routing: "elbow"}))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<line x1=\"18.5\" y1=\"36\" x2=\"26.5\" y2=\"44\" "))
+}
+
+func TestCanvasToSVGFontUnit(t *testing.T) {
+	t.Parallel()
+	canvas, err := NewCanvas([]byte("foo"), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	data := []struct {
+		unit     string
+		expected string
+	}{
+		{"", "font-size:15.2px"},
+		{"px", "font-size:15.2px"},
+		{"pt", "font-size:11.4pt"},
+		{"em", "font-size:0.95em"},
+		{"rem", "font-size:0.95rem"},
+		{"furlong", "font-size:15.2px"},
+	}
+	for i, line := range data {
+		actual := string(CanvasToSVGWithOptions(canvas, RenderOptions{FontUnit: line.unit}))
+		ut.AssertEqualIndex(t, i, true, strings.Contains(actual, line.expected))
+	}
+}
+
+func TestCanvasToSVGLetterSpacing(t *testing.T) {
+	t.Parallel()
+	input := []string{
+		"+------+",
+		"|[a]   |  bar",
+		"+------+",
+		"",
+		"[a]: {\"letter-spacing\":\"2\"}",
+	}
+	canvas, err := NewCanvas([]byte(strings.Join(input, "\n")), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	data := []struct {
+		spacing  float64
+		group    string
+		expected []string
+	}{
+		{0, "monospace;font-size:15.2px\" >", []string{"<text id=\"obj1\" x=\"13.5\" y=\"24\" letter-spacing=\"2\" fill=\"#000\">[a]</text>", "<text id=\"obj2\" x=\"94.5\" y=\"24\" fill=\"#000\">bar</text>"}},
+		{-0.5, "monospace;font-size:15.2px\" letter-spacing=\"-0.5\" >", []string{"letter-spacing=\"2\" fill=\"#000\">[a]</text>"}},
+	}
+	for i, line := range data {
+		actual := string(CanvasToSVGWithOptions(canvas, RenderOptions{LetterSpacing: line.spacing}))
+		ut.AssertEqualIndex(t, i, true, strings.Contains(actual, line.group))
+		for _, expected := range line.expected {
+			ut.AssertEqualIndex(t, i, true, strings.Contains(actual, expected))
+		}
+	}
+}
+
+func TestCanvasToSVGGlyphs(t *testing.T) {
+	t.Parallel()
+	canvas, err := NewCanvas([]byte("--x--o--"), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	data := []struct {
+		opts     RenderOptions
+		expected []string
+	}{
+		// 0 Defaults
+		{
+			RenderOptions{},
+			[]string{
+				"<line x1=\"18.5\" y1=\"4\" x2=\"26.5\" y2=\"12\" stroke-width=\"1\" />",
+				"<line x1=\"26.5\" y1=\"4\" x2=\"18.5\" y2=\"12\" stroke-width=\"1\" />",
+				"<circle cx=\"49.5\" cy=\"8\" r=\"3\" fill=\"#000\" />",
+			},
+		},
+		// 1 Hollow circle ticks and square dots
+		{
+			RenderOptions{TickGlyph: "circle", DotGlyph: "square"},
+			[]string{
+				"<circle cx=\"22.5\" cy=\"8\" r=\"3\" fill=\"#fff\" stroke-width=\"1\" />",
+				"<rect x=\"46.5\" y=\"5\" width=\"6\" height=\"6\" fill=\"#000\" />",
+			},
+		},
+		// 2 Plus ticks, and an unknown glyph
+		{
+			RenderOptions{TickGlyph: "plus", DotGlyph: "star"},
+			[]string{
+				"<line x1=\"18.5\" y1=\"8\" x2=\"26.5\" y2=\"8\" stroke-width=\"1\" />",
+				"<line x1=\"22.5\" y1=\"4\" x2=\"22.5\" y2=\"12\" stroke-width=\"1\" />",
+				"<circle cx=\"49.5\" cy=\"8\" r=\"3\" fill=\"#000\" />",
+			},
+		},
+	}
+	for i, line := range data {
+		actual := string(CanvasToSVGWithOptions(canvas, line.opts))
+		for _, e := range line.expected {
+			ut.AssertEqualIndex(t, i, true, strings.Contains(actual, e))
+		}
+	}
+
+	// A line may select its own glyphs.
+	canvas, err = NewCanvas([]byte("--x--o--\n\n[0,0]: {\"a2s:tick\":\"circle\"}"), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	actual := string(CanvasToSVG(canvas, false, "", 9, 16))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<circle cx=\"22.5\" cy=\"8\" r=\"3\" fill=\"#fff\" stroke-width=\"1\" />"))
+}
+
+func TestCanvasToSVGCurves(t *testing.T) {
+	t.Parallel()
+	input := []string{
+		"--+",
+		"  |",
+		"  +------->",
+		"",
+		"|",
+		"+->",
+		"",
+		"------------>",
+	}
+	canvas, err := NewCanvas([]byte(strings.Join(input, "\n")), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	data := []struct {
+		curveLength int
+		expected    []string
+	}{
+		{
+			0,
+			[]string{
+				"<path id=\"open0\" marker-end=\"url(#Pointer)\" d=\"M 4.5 8 L 13.5 8 L 22.5 8 L 22.5 24 L 22.5 40 L 31.5 40 ",
+				"<path id=\"open1\" marker-end=\"url(#Pointer)\" d=\"M 4.5 72 L 4.5 88 L 13.5 88 L 22.5 88 \" />",
+			},
+		},
+		{
+			10,
+			[]string{
+				"<path id=\"open0\" marker-end=\"url(#Pointer)\" d=\"M 4.5 8 C 22.5 8 22.5 40 94.5 40 \" />",
+				"<path id=\"open1\" marker-end=\"url(#Pointer)\" d=\"M 4.5 72 L 4.5 88 L 13.5 88 L 22.5 88 \" />",
+				"<path id=\"open2\" marker-end=\"url(#Pointer)\" d=\"M 4.5 120 L 112.5 120 \" />",
+			},
+		},
+		{
+			4,
+			[]string{
+				"<path id=\"open1\" marker-end=\"url(#Pointer)\" d=\"M 4.5 72 Q 4.5 88 22.5 88 \" />",
+			},
+		},
+	}
+	for i, line := range data {
+		actual := string(CanvasToSVGWithOptions(canvas, RenderOptions{CurveLength: line.curveLength}))
+		for _, expected := range line.expected {
+			ut.AssertEqualIndex(t, i, true, strings.Contains(actual, expected))
+		}
+	}
+}
+
+func TestCanvasToSVGEdges(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		input    []string
+		expected []string
+	}{
+		// 0 Edge from A to B, from the wall of A to the marker touching B
+		{
+			[]string{
+				"+---+            +---+",
+				"| A |-- label -->| B |",
+				"+---+            +---+",
+			},
+			[]string{
+				"<path id=\"open2\" marker-end=\"url(#Pointer)\" d=\"M 40.5 24 L 148.5 24 \" />",
+				"<text id=\"obj5\" x=\"94.5\" y=\"16\" text-anchor=\"middle\" fill=\"#000\">label</text>",
+			},
+		},
+		// 1 Edge from B to A, dashed along its tail only
+		{
+			[]string{
+				"+---+           +---+",
+				"| A |<=- yes ---| B |",
+				"+---+           +---+",
+			},
+			[]string{
+				"<g id=\"open2\" >\n",
+				"<path stroke-dasharray=\"5 5\" marker-start=\"url(#iPointer)\" d=\"M 49.5 24 L 67.5 24 \" />\n",
+				"<path d=\"M 67.5 24 L 148.5 24 \" />\n",
+				"<text id=\"obj5\" x=\"99\" y=\"16\" text-anchor=\"middle\" fill=\"#000\">yes</text>",
+			},
+		},
+		// 2 Labeled line without boxes
+		{
+			[]string{
+				"-- label -->",
+			},
+			[]string{
+				"<path id=\"open0\" d=\"M 4.5 8 L 13.5 8 \" />",
+				"<path id=\"open1\" marker-end=\"url(#Pointer)\" d=\"M 85.5 8 L 94.5 8 L 103.5 8 \" />",
+				"<text id=\"obj2\" x=\"31.5\" y=\"8\" fill=\"#000\">label</text>",
+			},
+		},
+	}
+	for i, line := range data {
+		canvas, err := NewCanvas([]byte(strings.Join(line.input, "\n")), 9, false)
+		if err != nil {
+			t.Fatalf("Error creating canvas: %s", err)
+		}
+		actual := string(CanvasToSVGWithOptions(canvas, RenderOptions{Edges: true}))
+		for _, expected := range line.expected {
+			ut.AssertEqualIndex(t, i, true, strings.Contains(actual, expected))
+		}
+	}
+
+	// Without the option, the line is drawn as it is in the diagram.
+	canvas, err := NewCanvas([]byte(strings.Join(data[0].input, "\n")), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	actual := string(CanvasToSVG(canvas, false, "", 9, 16))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<path id=\"open3\" marker-end=\"url(#Pointer)\" d=\"M 130.5 24 L 139.5 24 L 148.5 24 \" />"))
+}
+
+func TestCanvasToSVGSnapEnds(t *testing.T) {
+	t.Parallel()
+	input := []string{
+		"+--+",
+		"|  |------+",
+		"+--+      |",
+		"          v",
+	}
+	canvas, err := NewCanvas([]byte(strings.Join(input, "\n")), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+
+	// The right wall of the box is at x = 31.5.
+	actual := string(CanvasToSVGWithOptions(canvas, RenderOptions{SnapEnds: true}))
+	ut.AssertEqual(t, true, strings.Contains(actual, "L 31.5 8 L 31.5 24 L 31.5 40 "))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<path id=\"open1\" marker-end=\"url(#Pointer)\" d=\"M 31.5 24 L 49.5 24 "))
+
+	// Without the option, the line starts in the cell next to the wall.
+	actual = string(CanvasToSVG(canvas, false, "", 9, 16))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<path id=\"open1\" marker-end=\"url(#Pointer)\" d=\"M 40.5 24 L 49.5 24 "))
+}
+
+func TestCanvasToSVGBubbles(t *testing.T) {
+	t.Parallel()
+	input := []string{
+		"+-----+",
+		"| hi  |",
+		"+-----+",
+		"     \\",
+	}
+	canvas, err := NewCanvas([]byte(strings.Join(input, "\n")), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+
+	// The bottom wall of the box runs out to the tip of the tail, below it.
+	actual := string(CanvasToSVGWithOptions(canvas, RenderOptions{Bubbles: true}))
+	ut.AssertEqual(t, true, strings.Contains(actual, "L 49.5 40 L 49.5 56 L 31.5 40 "))
+	ut.AssertEqual(t, false, strings.Contains(actual, "id=\"open1\""))
+
+	// Without the option, the tail is a line of its own.
+	actual = string(CanvasToSVG(canvas, false, "", 9, 16))
+	ut.AssertEqual(t, false, strings.Contains(actual, "L 49.5 56 L 31.5 40 "))
+	ut.AssertEqual(t, true, strings.Contains(actual, "id=\"open1\""))
+}
+
+func TestCanvasToSVGSketch(t *testing.T) {
+	t.Parallel()
+	input := []string{
+		"+--+",
+		"|  |--->",
+		"+--+",
+	}
+	canvas, err := NewCanvas([]byte(strings.Join(input, "\n")), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	actual := string(CanvasToSVGWithOptions(canvas, RenderOptions{Sketch: true}))
+	ut.AssertEqual(t, true, strings.Contains(actual, "seed=\"0\""))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<g id=\"closed\" stroke=\"#000\" stroke-width=\"2\" fill=\"none\" filter=\"url(#sketch)\">"))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<g id=\"lines\" stroke=\"#000\" stroke-width=\"2\" fill=\"none\" filter=\"url(#sketch)\">"))
+
+	// Renders with the same seed are identical, and the seed is only passed through to the
+	// turbulence of the filter.
+	seeded := string(CanvasToSVGWithOptions(canvas, RenderOptions{Sketch: true, Seed: 42}))
+	ut.AssertEqual(t, seeded, string(CanvasToSVGWithOptions(canvas, RenderOptions{Sketch: true, Seed: 42})))
+	ut.AssertEqual(t, strings.Replace(actual, "seed=\"0\"", "seed=\"42\"", 1), seeded)
+
+	// Without the option, nothing is jittered.
+	actual = string(CanvasToSVG(canvas, false, "", 9, 16))
+	ut.AssertEqual(t, false, strings.Contains(actual, "sketch"))
+}
+
+func TestCanvasToSVGFrame(t *testing.T) {
+	t.Parallel()
+	input := []string{
+		"",
+		" +--+",
+		" |  |",
+		" +--+",
+		"",
+		"      x",
+	}
+	canvas, err := NewCanvas([]byte(strings.Join(input, "\n")), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+
+	// The combined bounds of the box and the text span cells (1,1) to (7,6).
+	actual := string(CanvasToSVGWithOptions(canvas, RenderOptions{Frame: true}))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<rect id=\"frame\" x=\"9\" y=\"16\" width=\"54\" height=\"80\" "))
+
+	actual = string(CanvasToSVG(canvas, false, "", 9, 16))
+	ut.AssertEqual(t, false, strings.Contains(actual, "id=\"frame\""))
+}
+
+func TestCanvasToSVGAvoid(t *testing.T) {
+	t.Parallel()
+	input := []string{
+		"----------.",
+		"          |",
+		" +------+ |",
+		" |  B   | |",
+		" |      | |",
+		" +------+ |",
+		"          '-->",
+	}
+	canvas, err := NewCanvas([]byte(strings.Join(input, "\n")), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+
+	// The straight line crosses the box, which the elbow bending below it avoids.
+	actual := string(CanvasToSVGWithOptions(canvas, RenderOptions{Routing: "straight"}))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<path id=\"open0\" marker-end=\"url(#Pointer)\" d=\"M 4.5 8 L 121.5 104 \" />"))
+	actual = string(CanvasToSVGWithOptions(canvas, RenderOptions{Routing: "straight", Avoid: true}))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<path id=\"open0\" marker-end=\"url(#Pointer)\" d=\"M 4.5 8 L 4.5 94 Q 4.5 104 14.5 104 L 121.5 104 \" />"))
+
+	// Lines drawn as they are in the diagram aren't rerouted.
+	actual = string(CanvasToSVGWithOptions(canvas, RenderOptions{Avoid: true}))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<path id=\"open0\" marker-end=\"url(#Pointer)\" d=\"M 4.5 8 L 13.5 8 "))
+}
+
+func TestAvoid(t *testing.T) {
+	t.Parallel()
+	input := []string{
+		"    +--+    ",
+		"    |  |    ",
+		"    +--+    ",
+		"            ",
+	}
+	line := []Point{{X: 0, Y: 1}, {X: 11, Y: 1}}
+	data := []struct {
+		rows     int
+		expected []Point
+	}{
+		// The detour above the box would leave the grid, so the line goes below it.
+		{4, []Point{{X: 0, Y: 1}, {X: 0, Y: 3, Hint: RoundedCorner}, {X: 11, Y: 3, Hint: RoundedCorner}, {X: 11, Y: 1}}},
+		// Without a row below the box, the line is left as it is.
+		{3, line},
+	}
+	for i, l := range data {
+		canvas, err := NewCanvas([]byte(strings.Join(input[:l.rows], "\n")), 9, false)
+		if err != nil {
+			t.Fatalf("Test %d: error creating canvas: %s", i, err)
+		}
+		ut.AssertEqualIndex(t, i, l.expected, avoid(line, canvas.Objects(), canvas.Size()))
+	}
+}
+
+func TestPathData(t *testing.T) {
+	t.Parallel()
+	input := []string{
+		".--+",
+		"|Hi|--->",
+		"+--'",
+	}
+	canvas, err := NewCanvas([]byte(strings.Join(input, "\n")), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	actual := string(CanvasToSVG(canvas, false, "", 10, 20))
+	for i, obj := range canvas.Objects() {
+		if obj.IsText() {
+			ut.AssertEqualIndex(t, i, "", PathData(obj, 10, 20))
+			continue
+		}
+		ut.AssertEqualIndex(t, i, true, strings.Contains(actual, " id=\""+objectID(i, obj)+"\" ") && strings.Contains(actual, "d=\""+PathData(obj, 10, 20)+"\""))
+	}
+	ut.AssertEqual(t, "M 5 20 Q 5 10 15 10 L 25 10 L 35 10 L 35 30 L 35 40 Q 35 50 25 50 L 15 50 L 5 50 L 5 30 Z", PathData(canvas.Objects()[0], 10, 20))
+}
+
+func TestCanvasToSVGLegacy(t *testing.T) {
+	t.Parallel()
+	input := []string{
+		"+--+",
+		"|Hi|-->",
+		"+--+",
+	}
+	canvas, err := NewCanvas([]byte(strings.Join(input, "\n")), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	actual := string(CanvasToSVGWithOptions(canvas, RenderOptions{ScaleX: 10, ScaleY: 20, Legacy: true}))
+	ut.AssertEqual(t, true, strings.Contains(actual, "font-size:19px"))
+	ut.AssertEqual(t, true, strings.Contains(actual, "markerWidth=\"9\" markerHeight=\"19\""))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<text id=\"obj2\" x=\"9\" y=\"36\" "))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<filter id=\"dsFilterNoBlur\""))
+	ut.AssertEqual(t, true, strings.Contains(actual, "filter=\"url(#dsFilter)\""))
+
+	// Without blur, closed objects cast the unblurred drop-shadow.
+	noBlur, err := NewCanvas([]byte(strings.Join(input, "\n")), 9, true)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	actual = string(CanvasToSVGWithOptions(noBlur, RenderOptions{ScaleX: 10, ScaleY: 20, Legacy: true, NoBlur: true}))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<path id=\"closed0\" fill=\"#fff\" filter=\"url(#dsFilterNoBlur)\" "))
+
+	actual = string(CanvasToSVGWithOptions(canvas, RenderOptions{ScaleX: 10, ScaleY: 20}))
+	ut.AssertEqual(t, true, strings.Contains(actual, "font-size:15.2px"))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<text id=\"obj2\" x=\"15\" y=\"30\" "))
+	ut.AssertEqual(t, false, strings.Contains(actual, "dsFilterNoBlur"))
+}
+
+func TestCanvasToSVGCaption(t *testing.T) {
+	t.Parallel()
+	input := []string{
+		"+------+",
+		"|      |",
+		"+------+",
+	}
+	canvas, err := NewCanvas([]byte(strings.Join(input, "\n")), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	actual := string(CanvasToSVG(canvas, false, "", 9, 16))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<svg width=\"81px\" height=\"64px\""))
+	ut.AssertEqual(t, false, strings.Contains(actual, "id=\"caption\""))
+
+	input = append(input, "[a2s]: {\"a2s:caption\":\"Figure 1 & 2\"}")
+	canvas, err = NewCanvas([]byte(strings.Join(input, "\n")), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+	actual = string(CanvasToSVG(canvas, false, "", 9, 16))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<svg width=\"81px\" height=\"112px\""))
+	ut.AssertEqual(t, true, strings.Contains(actual, "<text id=\"caption\" x=\"40.5\" y=\"100\" text-anchor=\"middle\" "))
+	ut.AssertEqual(t, true, strings.Contains(actual, ">Figure 1 &amp; 2</text>\n"))
+}
+
+func TestCanvasToSVGJoins(t *testing.T) {
+	t.Parallel()
+	input := []string{
+		"------",
+		"  |",
+		"  |",
+		"  v",
+		"",
+		"<--->",
+	}
+	canvas, err := NewCanvas([]byte(strings.Join(input, "\n")), 9, false)
+	if err != nil {
+		t.Fatalf("Error creating canvas: %s", err)
+	}
+
+	// The top of the vertical line is joined to the horizontal line above it, while its marker
+	// is left alone.
+	actual := string(CanvasToSVGWithOptions(canvas, RenderOptions{Joins: true}))
+	ut.AssertEqual(t, true, strings.Contains(actual, "    <path d=\"M 22.5 24 L 22.5 8\" />\n"))
+	ut.AssertEqual(t, 1, strings.Count(actual, "\n    <path d="))
+
+	actual = string(CanvasToSVG(canvas, false, "", 9, 16))
+	ut.AssertEqual(t, 0, strings.Count(actual, "\n    <path d="))
+}
+
+func TestCanvasToSVGRadius(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		input    []string
+		expected string
+	}{
+		// 0 Square corners rounded with a radius of two cells
+		{
+			[]string{
+				"+------+",
+				"|      |",
+				"|      |",
+				"+------+",
+				"",
+				"[0,0]: {\"a2s:radius\":2}",
+			},
+			"d=\"M 4.5 26 Q 4.5 8 22.5 8 L 31.5 8 L 40.5 8 L 49.5 8 Q 67.5 8 67.5 26 L 67.5 38 Q 67.5 56 49.5 56 L 40.5 56 L 31.5 56 L 22.5 56 Q 4.5 56 4.5 38 Z\"",
+		},
+
+		// 1 Rounded corners squared with a radius of zero
+		{
+			[]string{
+				".--.",
+				"|  |",
+				"'--'",
+				"",
+				"[0,0]: {\"a2s:radius\":0}",
+			},
+			"d=\"M 4.5 8 L 13.5 8 L 22.5 8 L 31.5 8 L 31.5 24 L 31.5 40 L 22.5 40 L 13.5 40 L 4.5 40 L 4.5 24 Z\"",
+		},
+	}
+	for i, line := range data {
+		canvas, err := NewCanvas([]byte(strings.Join(line.input, "\n")), 9, false)
+		if err != nil {
+			t.Fatalf("Test %d: error creating canvas: %s", i, err)
+		}
+		actual := string(CanvasToSVG(canvas, false, "", 9, 16))
+		ut.AssertEqualIndex(t, i, true, strings.Contains(actual, line.expected))
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright 2012 - 2018 The ASCIIToSVG Contributors
+// All rights reserved.
+
+package asciitosvg
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"strings"
+)
+
+// A Warning describes a likely authoring mistake found in a diagram.
+type Warning struct {
+	// Point is the grid location the warning refers to.
+	Point Point
+	// Message describes the problem.
+	Message string
+}
+
+// String implements fmt.Stringer on Warning.
+func (w Warning) String() string {
+	return fmt.Sprintf("%s: %s", w.Point, w.Message)
+}
+
+// Validate inspects the objects of a Canvas for likely authoring mistakes that do not prevent
+// rendering, but probably don't render as the author intended. Warnings are returned in the
+// order of the objects they refer to.
+func Validate(c Canvas) []Warning {
+	var warnings []Warning
+	for _, o := range c.Objects() {
+		warnings = append(warnings, checkFill(c, o)...)
+		if o.IsText() {
+			warnings = append(warnings, checkTextOverrun(c, o)...)
+		}
+	}
+	return warnings
+}
+
+// checkFill flags objects whose tag sets a fill or a chip color that isn't a valid color, like a
+// misspelled color name or a number, which is rendered as defaultFill or defaultChipFill instead. It also flags
+// boxes filled with a paint no text color can be picked for, like "rgb(1,2,3)" or a gradient, on
+// which text stays black. The text tagging a box is skipped, as the box is flagged itself.
+func checkFill(c Canvas, o Object) []Warning {
+	if o.Tag() == "" || IsReference(o) {
+		return nil
+	}
+	var warnings []Warning
+	options := c.Options()[o.Tag()]
+	if badFill(options) {
+		warnings = append(warnings, Warning{
+			Point:   o.Points()[0],
+			Message: fmt.Sprintf("fill %s of tag %q is not a known color; %q is used instead", jsonValue(options["fill"]), o.Tag(), defaultFill),
+		})
+	}
+	if fill, ok := options["fill"].(string); ok && o.IsClosed() && !o.IsText() && isValidColor(fill) && !strings.EqualFold(fill, "none") {
+		if _, _, _, err := colorToRGB(fill); err != nil {
+			warnings = append(warnings, Warning{
+				Point:   o.Points()[0],
+				Message: fmt.Sprintf("no text color can be picked for fill %q of tag %q; text inside is black", fill, o.Tag()),
+			})
+		}
+	}
+	if badChip(options) {
+		warnings = append(warnings, Warning{
+			Point:   o.Points()[0],
+			Message: fmt.Sprintf("chip %s of tag %q is not a known color; %q is used instead", jsonValue(options["a2s:chip"]), o.Tag(), defaultChipFill),
+		})
+	}
+	return warnings
+}
+
+// jsonValue formats the value of an option as it is written in the JSON of its tag definition.
+func jsonValue(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+// checkTextOverrun flags text that begins inside a box but runs into or past its right border.
+// Text scanning stops at path cells, so a label that is too long for its box usually overwrites
+// the border and breaks the box into open paths. The box is then recognized by the horizontal
+// edges directly above and below the start of the text.
+func checkTextOverrun(c Canvas, text Object) []Warning {
+	start := text.Points()[0]
+	end := Bounds(text).Max.X - 1
+
+	// edge finds the nearest path in the column of the text start, searching in direction dy,
+	// and returns it along with the right-most column it occupies on that row.
+	edge := func(dy int) (Object, int) {
+		for y := start.Y + dy; y >= 0 && y < c.Size().Y; y += dy {
+			for _, o := range c.Objects() {
+				if o.IsText() || !(image.Point{X: start.X, Y: y}).In(Bounds(o)) {
+					continue
+				}
+				right := -1
+				for _, p := range FullPoints(o) {
+					if p.Y == y && p.X > right {
+						right = p.X
+					}
+				}
+				if right >= start.X {
+					return o, right
+				}
+			}
+		}
+		return nil, 0
+	}
+
+	top, topRight := edge(-1)
+	bottom, bottomRight := edge(1)
+	if top == nil || bottom == nil || topRight > end || bottomRight > end {
+		return nil
+	}
+
+	// Text between two lines is only inside a box if there's also a border to its left.
+	left := false
+	for _, o := range c.Objects() {
+		if o.IsText() {
+			continue
+		}
+		for _, p := range FullPoints(o) {
+			if p.Y == start.Y && p.X < start.X && p.X >= Bounds(top).Min.X {
+				left = true
+			}
+		}
+	}
+	if !left {
+		return nil
+	}
+	return []Warning{{
+		Point:   start,
+		Message: fmt.Sprintf("text %q overruns the border of the box at %s", string(text.Text()), top.Corners()[0]),
+	}}
+}
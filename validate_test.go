@@ -0,0 +1,133 @@
+// Copyright 2012 - 2018 The ASCIIToSVG Contributors
+// All rights reserved.
+
+package asciitosvg
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/maruel/ut"
+)
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		input    []string
+		warnings []string
+	}{
+		// 0 Label fits its box
+		{
+			[]string{
+				"+--------+",
+				"| Editor |",
+				"+--------+",
+			},
+			nil,
+		},
+
+		// 1 Label overruns its box
+		{
+			[]string{
+				"+------+",
+				"| Editorial",
+				"+------+",
+			},
+			[]string{"(2,1): text \"Editorial\" overruns the border of the box at (0,0)"},
+		},
+
+		// 2 Text between two rules
+		{
+			[]string{
+				"-----",
+				" label text",
+				"-----",
+			},
+			nil,
+		},
+
+		// 3 Label outside of a connector
+		{
+			[]string{
+				"+----------+",
+				"|          |",
+				"|  label   v",
+			},
+			nil,
+		},
+
+		// 4 Misspelled fill
+		{
+			[]string{
+				"+------+",
+				"| [a]  |",
+				"+------+",
+				"",
+				"[a]: {\"fill\":\"chartruese\"}",
+			},
+			[]string{"(0,0): fill \"chartruese\" of tag \"a\" is not a known color; \"#fff\" is used instead"},
+		},
+
+		// 5 Named fill
+		{
+			[]string{
+				"+------+",
+				"| [a]  |",
+				"+------+",
+				"",
+				"[a]: {\"fill\":\"chartreuse\"}",
+			},
+			nil,
+		},
+
+		// 6 Misspelled chip of a line label
+		{
+			[]string{
+				"------>",
+				"",
+				"[0,0]: {\"a2s:label\":\"go\",\"a2s:chip\":\"blakc\"}",
+			},
+			[]string{"(0,0): chip \"blakc\" of tag \"0,0\" is not a known color; \"#fff\" is used instead"},
+		},
+
+		// 7 Fill no text color can be picked for
+		{
+			[]string{
+				"+------+",
+				"| [a]  |",
+				"| text |",
+				"+------+",
+				"",
+				"[a]: {\"fill\":\"rgb(1,2,3)\"}",
+			},
+			[]string{"(0,0): no text color can be picked for fill \"rgb(1,2,3)\" of tag \"a\"; text inside is black"},
+		},
+
+		// 8 Fill and chip that aren't strings
+		{
+			[]string{
+				"+------+",
+				"| [a]  |--->",
+				"+------+",
+				"",
+				"[a]: {\"fill\":1}",
+				"[8,1]: {\"a2s:label\":\"go\",\"a2s:chip\":[0,0]}",
+			},
+			[]string{
+				"(0,0): fill 1 of tag \"a\" is not a known color; \"#fff\" is used instead",
+				"(8,1): chip [0,0] of tag \"8,1\" is not a known color; \"#fff\" is used instead",
+			},
+		},
+	}
+	for i, line := range data {
+		c, err := NewCanvas([]byte(strings.Join(line.input, "\n")), 9, false)
+		if err != nil {
+			t.Fatalf("Test %d: error creating canvas: %s", i, err)
+		}
+		var warnings []string
+		for _, w := range Validate(c) {
+			warnings = append(warnings, w.String())
+		}
+		ut.AssertEqualIndex(t, i, line.warnings, warnings)
+	}
+}